@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "store.json")
+
+	assert.NoError(t, Write(path, []byte("first")))
+	assert.NoError(t, Write(path, []byte("second")))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	assert.Equal(t, "second", string(data))
+
+	// no temporary file is left behind
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	assert.Len(t, entries, 1)
+
+	// files can only be written in existing directories
+	assert.Error(t, Write(filepath.Join(dir, "missing", "store.json"), []byte("third")))
+}
@@ -6,9 +6,11 @@ package config
 import (
 	"context"
 	"fmt"
+	"math"
 	"regexp"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/v88/github"
 	"gopkg.in/yaml.v3"
@@ -27,6 +29,12 @@ type ArianeConfig struct {
 	AllowedTeams     []string                            `yaml:"allowed-teams,omitempty"`
 	RerunConfig      *RerunConfig                        `yaml:"rerun,omitempty"`
 	StagesConfig     *StagesConfig                       `yaml:"stages-config,omitempty"`
+	ReviewsConfig    *ReviewsConfig                      `yaml:"reviews,omitempty"`
+	TriageConfig     *TriageConfig                       `yaml:"triage,omitempty"`
+	KnownFlakes      []KnownFlake                        `yaml:"known-flakes,omitempty"`
+	QuarantineConfig *QuarantineConfig                   `yaml:"quarantine,omitempty"`
+	PreRerunJobs     map[string][]PreRerunJob            `yaml:"pre-rerun-jobs,omitempty"`
+	ChecksConfig     *ChecksConfig                       `yaml:"checks,omitempty"`
 	ReplaceDependsOn map[string][]string                 `yaml:"replace-depends-on,omitempty"`
 }
 
@@ -38,6 +46,18 @@ type FeedbackConfig struct {
 	WorkflowsReport *bool `yaml:"workflows-report,omitempty"`
 	// Whether to report on all workflows (incl. successful and skipped ones
 	ReportAllWorkflows *bool `yaml:"report-all-workflows,omitempty"`
+	// Whether to record received commands (accepted, rejected, skipped or failed) in an "Ariane" check run
+	CheckRun *bool `yaml:"check-run,omitempty"`
+	// Whether to gather feedback comments in a single sticky comment edited in place, instead of posting new comments
+	StickyComment *bool `yaml:"sticky-comment,omitempty"`
+	// Whether to minimize Ariane comments made outdated by the sticky comment
+	MinimizeOutdated *bool `yaml:"minimize-outdated,omitempty"`
+	// Go text templates overriding the feedback messages, by message type (e.g. command-not-found)
+	Templates map[string]string `yaml:"templates,omitempty"`
+	// Reactions overriding the default ones, by command lifecycle stage (e.g. processing)
+	Reactions map[string]string `yaml:"reactions,omitempty"`
+	// Channels through which feedback is reported, by feedback kind (errors, rejections, workflows-report, quarantine)
+	Channels map[string]string `yaml:"channels,omitempty"`
 }
 
 type TriggerConfig struct {
@@ -48,8 +68,34 @@ type TriggerConfig struct {
 type WorkflowPathsRegexConfig struct {
 	PathsRegex       string `yaml:"paths-regex"`
 	PathsIgnoreRegex string `yaml:"paths-ignore-regex"`
+	// Names of the check runs to mark as skipped when the workflow is skipped, instead of the workflow name
+	// (e.g. job names required by branch protection)
+	SkippedChecks []string `yaml:"skipped-checks,omitempty"`
+	// Whether to mark the check runs of the jobs of the workflow as skipped, including their matrix
+	// expansions, instead of the workflow name
+	SkippedChecksFromJobs bool `yaml:"skipped-checks-from-jobs,omitempty"`
 }
 
+// PreRerunJob selects jobs which are rerun, in order, before the failed jobs of a workflow run are
+// rerun by a command (e.g. a job setting a pending commit status)
+type PreRerunJob struct {
+	// Regex matched against the job names of the run
+	Job string `yaml:"job"`
+	// Whether to wait for the rerun job to complete, instead of waiting for a fixed delay
+	WaitForCompletion bool `yaml:"wait-for-completion,omitempty"`
+	// Fixed delay to wait for after rerunning the job, the server's run delay by default
+	Delay time.Duration `yaml:"delay,omitempty"`
+	// Maximum time to wait for the rerun job to complete, DefaultPreRerunTimeout by default
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+}
+
+// DefaultPreRerunJobs are the jobs rerun before the failed jobs of the workflows not listed under
+// pre-rerun-jobs
+var DefaultPreRerunJobs = []PreRerunJob{{Job: "^Commit Status Start$"}}
+
+// DefaultPreRerunTimeout is how long Ariane waits for a pre-rerun job to complete, unless configured
+const DefaultPreRerunTimeout = 10 * time.Minute
+
 type Stage struct {
 	Workflows []string `yaml:"workflows"`
 	Command   string   `yaml:"command"`
@@ -60,10 +106,148 @@ type StagesConfig struct {
 	Stages []Stage `yaml:"stages,omitempty"`
 }
 
+// ReviewsConfig contains configuration for trigger phrases sent through pull request reviews
+type ReviewsConfig struct {
+	// Whether to handle trigger phrases in pull request review comments (comments on the diff)
+	ReviewComments *bool `yaml:"review-comments,omitempty"`
+	// Trigger phrase to run automatically when a pull request review is approved
+	OnApproval string `yaml:"on-approval,omitempty"`
+}
+
+// TriageConfig contains configuration for the triage comment Ariane posts when a workflow run fails
+// for good, i.e. once it is not rerun anymore
+type TriageConfig struct {
+	// Number of log lines extracted from each failed job
+	LogLines int `yaml:"log-lines,omitempty"`
+	// Regexes matching the log lines to extract (e.g. "^Error:"), instead of the last lines of the log
+	ErrorPatterns []string `yaml:"error-patterns,omitempty"`
+	// Maximum number of failed jobs detailed in the triage comment
+	MaxJobs int `yaml:"max-jobs,omitempty"`
+}
+
+const (
+	DefaultTriageLogLines = 20
+	DefaultTriageMaxJobs  = 5
+)
+
+// KnownFlake is the signature of a known flaky failure. When known flakes are configured, failed runs
+// are only rerun if all their failed jobs match one of them.
+type KnownFlake struct {
+	// Name of the flake, reported when it matches
+	Name string `yaml:"name"`
+	// Regex matched against the log lines and check annotations of failed jobs
+	Pattern string `yaml:"pattern"`
+	// Optional link to the issue tracking the flake
+	Issue string `yaml:"issue,omitempty"`
+}
+
+// ChecksConfig contains configuration for the check runs Ariane maintains on pull requests on behalf of
+// the workflows it dispatches
+type ChecksConfig struct {
+	// Whether to create a pending check run named after each workflow when dispatching it, completed with
+	// the conclusion of its run, so that pull request checks are accurate before the run starts
+	Pending *bool `yaml:"pending,omitempty"`
+	// Aggregate check run summarizing a set of workflows, so that branch protection can require a single check
+	Required *RequiredCheckConfig `yaml:"required,omitempty"`
+	// Which check runs to mark as skipped when a workflow is skipped: SkippedChecksAll (default) or
+	// SkippedChecksRequired
+	Skipped string `yaml:"skipped,omitempty"`
+	// How the required checks of merge groups are completed: MergeGroupChecksSuccess (default) or
+	// MergeGroupChecksPaths
+	MergeGroup string `yaml:"merge-group,omitempty"`
+}
+
+const (
+	// SkippedChecksRequired only marks as skipped the check runs required to merge into the base branch
+	SkippedChecksRequired = "required"
+	// SkippedChecksAll marks as skipped all the check runs of skipped workflows
+	SkippedChecksAll = "all"
+)
+
+const (
+	// MergeGroupChecksSuccess marks the "any source" required checks of merge groups as successful without
+	// running anything
+	MergeGroupChecksSuccess = "success"
+	// MergeGroupChecksPaths runs the workflows of the required checks of merge groups whose paths are
+	// changed by the merge group, and marks the checks of the other workflows as skipped
+	MergeGroupChecksPaths = "paths"
+)
+
+// DefaultRequiredCheckName is the name of the aggregate check run when none is configured
+const DefaultRequiredCheckName = "ariane/required"
+
+// RequiredCheckConfig contains configuration for the aggregate check run maintained by Ariane on the head
+// commit of pull requests. It succeeds once all its workflows succeeded or were skipped by path rules, and
+// fails once they all completed otherwise.
+type RequiredCheckConfig struct {
+	// Name of the check run, "ariane/required" by default
+	Name string `yaml:"name,omitempty"`
+	// Workflow files summarized by the check run
+	Workflows []string `yaml:"workflows"`
+}
+
+// QuarantineConfig contains configuration for the automatic quarantine of persistently flaky workflows.
+// Failures of a quarantined workflow are flagged as known flakes: Ariane adds a neutral check named after
+// each failed job, linking to the real job, until a maintainer un-quarantines it.
+type QuarantineConfig struct {
+	// Flake rate (between 0 and 1) from which a workflow is quarantined
+	FlakeRate float64 `yaml:"flake-rate"`
+	// Minimum number of runs of the workflow over the period before it can be quarantined
+	MinRuns int `yaml:"min-runs,omitempty"`
+	// Period the flake rate is computed over, in days (e.g. 7d) or as a duration (e.g. 72h)
+	Period string `yaml:"period,omitempty"`
+}
+
+const (
+	DefaultQuarantineMinRuns = 10
+	DefaultQuarantinePeriod  = "30d"
+)
+
 type RerunConfig struct {
 	Workflows        []string `yaml:"workflows,omitempty"`
 	ExcludeWorkflows []string `yaml:"exclude-workflows,omitempty"`
 	MaxRetries       int      `yaml:"max-retries,omitempty"`
+	// Regexes of the job names whose failures are rerun, all jobs by default
+	Jobs        []string `yaml:"jobs,omitempty"`
+	ExcludeJobs []string `yaml:"exclude-jobs,omitempty"`
+	// Regexes of the step names whose failures are rerun, all steps by default
+	Steps        []string `yaml:"steps,omitempty"`
+	ExcludeSteps []string `yaml:"exclude-steps,omitempty"`
+	// Delay before rerunning the failed jobs of a run (e.g. 2m), instead of rerunning them right away
+	Delay time.Duration `yaml:"delay,omitempty"`
+	// Factor the delay is multiplied by at each attempt, for exponential backoff (e.g. 2)
+	BackoffFactor float64 `yaml:"backoff-factor,omitempty"`
+	// Upper limit of the delay once backed off (e.g. 30m)
+	MaxDelay time.Duration `yaml:"max-delay,omitempty"`
+	// Policies overriding the default ones, by workflow run conclusion (failure, timed_out, startup_failure)
+	Conclusions map[string]string `yaml:"conclusions,omitempty"`
+	// Label added to a pull request once a workflow run exhausted its retries (e.g. ci/retries-exhausted),
+	// and removed once a later run of that workflow succeeds
+	ExhaustedLabel string `yaml:"exhausted-label,omitempty"`
+	// Maximum number of automatic reruns across all the workflow runs of a pull request's head commit,
+	// unlimited if unset
+	PRBudget int `yaml:"pr-budget,omitempty"`
+}
+
+// Rerun policies, i.e. what Ariane does when a workflow run concludes with a given conclusion
+const (
+	// RerunPolicyFailedJobs reruns the failed jobs of the run
+	RerunPolicyFailedJobs = "rerun-failed-jobs"
+	// RerunPolicyAll reruns the whole run, e.g. when its jobs never started
+	RerunPolicyAll = "rerun-all"
+	// RerunPolicyReport does not rerun the run, only reporting it (see triage)
+	RerunPolicyReport = "report"
+)
+
+// ValidRerunPolicies are the supported rerun policies
+var ValidRerunPolicies = []string{RerunPolicyFailedJobs, RerunPolicyAll, RerunPolicyReport}
+
+// DefaultConclusionPolicies are the rerun policies of the conclusions Ariane handles, unless customized
+// under rerun.conclusions. Runs which never started are rerun as a whole, as they have no failed jobs.
+var DefaultConclusionPolicies = map[string]string{
+	"failure":         RerunPolicyFailedJobs,
+	"timed_out":       RerunPolicyFailedJobs,
+	"startup_failure": RerunPolicyAll,
 }
 
 func getArianeConfigFromRepository(client *github.Client, ctx context.Context, owner string, repoName string, configPath string, ref string) (*ArianeConfig, error) {
@@ -133,6 +317,145 @@ func (c *ArianeConfig) GetReportAllWorkflows() bool {
 	return *c.Feedback.ReportAllWorkflows
 }
 
+func (c *ArianeConfig) GetCheckRun() bool {
+	if c.Feedback.CheckRun == nil {
+		return false
+	}
+	return *c.Feedback.CheckRun
+}
+
+// GetPendingChecks returns whether to create pending check runs for the workflows Ariane dispatches
+func (c *ArianeConfig) GetPendingChecks() bool {
+	if c.ChecksConfig == nil || c.ChecksConfig.Pending == nil {
+		return false
+	}
+	return *c.ChecksConfig.Pending
+}
+
+// GetSkippedChecks returns which check runs to mark as skipped when a workflow is skipped
+func (c *ArianeConfig) GetSkippedChecks() string {
+	if c.ChecksConfig == nil || c.ChecksConfig.Skipped == "" {
+		return SkippedChecksAll
+	}
+	return c.ChecksConfig.Skipped
+}
+
+// GetMergeGroupChecks returns how the required checks of merge groups are completed
+func (c *ArianeConfig) GetMergeGroupChecks() string {
+	if c.ChecksConfig == nil || c.ChecksConfig.MergeGroup == "" {
+		return MergeGroupChecksSuccess
+	}
+	return c.ChecksConfig.MergeGroup
+}
+
+// GetRequiredCheck returns the name of the aggregate check run and the workflows it summarizes, if any
+func (c *ArianeConfig) GetRequiredCheck() (string, []string) {
+	if c.ChecksConfig == nil || c.ChecksConfig.Required == nil || len(c.ChecksConfig.Required.Workflows) == 0 {
+		return "", nil
+	}
+	if c.ChecksConfig.Required.Name == "" {
+		return DefaultRequiredCheckName, c.ChecksConfig.Required.Workflows
+	}
+	return c.ChecksConfig.Required.Name, c.ChecksConfig.Required.Workflows
+}
+
+func (c *ArianeConfig) GetStickyComment() bool {
+	if c.Feedback.StickyComment == nil {
+		return false
+	}
+	return *c.Feedback.StickyComment
+}
+
+func (c *ArianeConfig) GetMinimizeOutdated() bool {
+	if c.Feedback.MinimizeOutdated == nil {
+		return false
+	}
+	return *c.Feedback.MinimizeOutdated
+}
+
+func (c *ArianeConfig) GetTriageLogLines() int {
+	if c.TriageConfig == nil || c.TriageConfig.LogLines <= 0 {
+		return DefaultTriageLogLines
+	}
+	return c.TriageConfig.LogLines
+}
+
+func (c *ArianeConfig) GetTriageMaxJobs() int {
+	if c.TriageConfig == nil || c.TriageConfig.MaxJobs <= 0 {
+		return DefaultTriageMaxJobs
+	}
+	return c.TriageConfig.MaxJobs
+}
+
+// GetRerunDelay returns the delay before rerunning the failed jobs of the given attempt of a run (1 for
+// the first attempt), backed off exponentially by the configured factor and capped by the max delay
+func (c *ArianeConfig) GetRerunDelay(attempt int) time.Duration {
+	if c.RerunConfig == nil || c.RerunConfig.Delay <= 0 {
+		return 0
+	}
+	delay := float64(c.RerunConfig.Delay)
+	if factor := c.RerunConfig.BackoffFactor; factor > 1 {
+		delay *= math.Pow(factor, float64(attempt-1))
+	}
+	if maxDelay := c.RerunConfig.MaxDelay; maxDelay > 0 && delay > float64(maxDelay) {
+		return maxDelay
+	}
+	return time.Duration(delay)
+}
+
+// GetPreRerunJobs returns the jobs to rerun, in order, before the failed jobs of workflow. An empty list
+// configured for workflow disables the default ones.
+func (c *ArianeConfig) GetPreRerunJobs(workflow string) []PreRerunJob {
+	if jobs, ok := c.PreRerunJobs[workflow]; ok {
+		return jobs
+	}
+	return DefaultPreRerunJobs
+}
+
+// GetConclusionPolicy returns the rerun policy of workflow runs with the given conclusion, or an empty
+// string if Ariane does not handle that conclusion. Conclusions other than the ones of
+// DefaultConclusionPolicies are not handled, and invalid policies fall back to the default one.
+func (c *ArianeConfig) GetConclusionPolicy(conclusion string) string {
+	defaultPolicy, ok := DefaultConclusionPolicies[conclusion]
+	if !ok {
+		return ""
+	}
+	if c.RerunConfig != nil {
+		if policy, ok := c.RerunConfig.Conclusions[conclusion]; ok && slices.Contains(ValidRerunPolicies, policy) {
+			return policy
+		}
+	}
+	return defaultPolicy
+}
+
+func (c *ArianeConfig) GetQuarantineMinRuns() int {
+	if c.QuarantineConfig == nil || c.QuarantineConfig.MinRuns <= 0 {
+		return DefaultQuarantineMinRuns
+	}
+	return c.QuarantineConfig.MinRuns
+}
+
+func (c *ArianeConfig) GetQuarantinePeriod() string {
+	if c.QuarantineConfig == nil || c.QuarantineConfig.Period == "" {
+		return DefaultQuarantinePeriod
+	}
+	return c.QuarantineConfig.Period
+}
+
+func (c *ArianeConfig) GetReviewComments() bool {
+	if c.ReviewsConfig == nil || c.ReviewsConfig.ReviewComments == nil {
+		return false
+	}
+	return *c.ReviewsConfig.ReviewComments
+}
+
+func (c *ArianeConfig) GetOnApproval() string {
+	if c.ReviewsConfig == nil {
+		return ""
+	}
+	return c.ReviewsConfig.OnApproval
+}
+
 // ChangeAffectsWorkflow returns true if file list indicates that `workflow` should be run
 func (config *ArianeConfig) ChangeAffectsWorkflow(ctx context.Context, workflow string, files []*github.CommitFile) bool {
 
@@ -238,6 +561,32 @@ func (config *ArianeConfig) ShouldRunWorkflow(ctx context.Context, workflow stri
 	return numberIgnoredFiles < len(files)
 }
 
+// SkipReason explains why ShouldRunWorkflow returned false for the given workflow and list of files,
+// to be reported to users.
+func (config *ArianeConfig) SkipReason(workflow string, files []*github.CommitFile) string {
+	if len(files) == 0 {
+		return "no files changed"
+	}
+
+	workflowConfig, exists := config.Workflows[workflow]
+	if !exists {
+		return "only other workflows changed"
+	}
+	if workflowConfig.PathsRegex != "" {
+		if _, err := regexp.Compile(`^` + workflowConfig.PathsRegex); err != nil {
+			return fmt.Sprintf("invalid paths-regex `%s`", workflowConfig.PathsRegex)
+		}
+		return fmt.Sprintf("no changed file matches paths-regex `%s`", workflowConfig.PathsRegex)
+	}
+	if workflowConfig.PathsIgnoreRegex != "" {
+		if _, err := regexp.Compile(`^` + workflowConfig.PathsIgnoreRegex); err != nil {
+			return fmt.Sprintf("invalid paths-ignore-regex `%s`", workflowConfig.PathsIgnoreRegex)
+		}
+		return fmt.Sprintf("all changed files match paths-ignore-regex `%s`", workflowConfig.PathsIgnoreRegex)
+	}
+	return "only other workflows changed"
+}
+
 // Merge merges the ariane configuration given in other into the one given in config. A trigger or
 // workflow specified in other will take precedence over the one in config.
 func (config *ArianeConfig) Merge(other *ArianeConfig) *ArianeConfig {
@@ -304,11 +653,63 @@ func (config *ArianeConfig) Merge(other *ArianeConfig) *ArianeConfig {
 	if other.Feedback.ReportAllWorkflows != nil {
 		config.Feedback.ReportAllWorkflows = other.Feedback.ReportAllWorkflows
 	}
+	if other.Feedback.CheckRun != nil {
+		config.Feedback.CheckRun = other.Feedback.CheckRun
+	}
+	if other.Feedback.StickyComment != nil {
+		config.Feedback.StickyComment = other.Feedback.StickyComment
+	}
+	if other.Feedback.MinimizeOutdated != nil {
+		config.Feedback.MinimizeOutdated = other.Feedback.MinimizeOutdated
+	}
+	for name, text := range other.Feedback.Templates {
+		if config.Feedback.Templates == nil {
+			config.Feedback.Templates = make(map[string]string)
+		}
+		config.Feedback.Templates[name] = text
+	}
+	for stage, reaction := range other.Feedback.Reactions {
+		if config.Feedback.Reactions == nil {
+			config.Feedback.Reactions = make(map[string]string)
+		}
+		config.Feedback.Reactions[stage] = reaction
+	}
+	for kind, channel := range other.Feedback.Channels {
+		if config.Feedback.Channels == nil {
+			config.Feedback.Channels = make(map[string]string)
+		}
+		config.Feedback.Channels[kind] = channel
+	}
 
 	if other.StagesConfig != nil {
 		config.StagesConfig = other.StagesConfig
 	}
 
+	if other.ReviewsConfig != nil {
+		config.ReviewsConfig = other.ReviewsConfig
+	}
+
+	if other.TriageConfig != nil {
+		config.TriageConfig = other.TriageConfig
+	}
+
+	config.KnownFlakes = append(config.KnownFlakes, other.KnownFlakes...)
+
+	if other.QuarantineConfig != nil {
+		config.QuarantineConfig = other.QuarantineConfig
+	}
+
+	if other.ChecksConfig != nil {
+		config.ChecksConfig = other.ChecksConfig
+	}
+
+	for workflow, jobs := range other.PreRerunJobs {
+		if config.PreRerunJobs == nil {
+			config.PreRerunJobs = make(map[string][]PreRerunJob)
+		}
+		config.PreRerunJobs[workflow] = jobs
+	}
+
 	return config
 }
 
@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/google/go-github/v88/github"
 	"github.com/rs/zerolog"
@@ -606,6 +607,110 @@ func TestGetWorkflowsReport(t *testing.T) {
 	}
 }
 
+func TestGetCheckRun(t *testing.T) {
+	testCases := []struct {
+		name           string
+		config         *config.ArianeConfig
+		expectedResult bool
+	}{
+		{
+			name: "Feedback.CheckRun is nil (default zero value)",
+			config: &config.ArianeConfig{
+				Feedback: config.FeedbackConfig{
+					CheckRun: nil,
+				},
+			},
+			expectedResult: false,
+		},
+		{
+			name: "CheckRun is true",
+			config: &config.ArianeConfig{
+				Feedback: config.FeedbackConfig{
+					CheckRun: boolPtr(true),
+				},
+			},
+			expectedResult: true,
+		},
+		{
+			name: "CheckRun is false",
+			config: &config.ArianeConfig{
+				Feedback: config.FeedbackConfig{
+					CheckRun: boolPtr(false),
+				},
+			},
+			expectedResult: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := tc.config.GetCheckRun()
+			assert.Equal(t, tc.expectedResult, result)
+		})
+	}
+}
+
+func TestGetStickyComment(t *testing.T) {
+	testCases := []struct {
+		name                     string
+		config                   *config.ArianeConfig
+		expectedStickyComment    bool
+		expectedMinimizeOutdated bool
+	}{
+		{
+			name:                     "Empty config with zero value Feedback",
+			config:                   &config.ArianeConfig{},
+			expectedStickyComment:    false,
+			expectedMinimizeOutdated: false,
+		},
+		{
+			name: "StickyComment is true",
+			config: &config.ArianeConfig{
+				Feedback: config.FeedbackConfig{
+					StickyComment: boolPtr(true),
+				},
+			},
+			expectedStickyComment:    true,
+			expectedMinimizeOutdated: false,
+		},
+		{
+			name: "StickyComment and MinimizeOutdated are true",
+			config: &config.ArianeConfig{
+				Feedback: config.FeedbackConfig{
+					StickyComment:    boolPtr(true),
+					MinimizeOutdated: boolPtr(true),
+				},
+			},
+			expectedStickyComment:    true,
+			expectedMinimizeOutdated: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedStickyComment, tc.config.GetStickyComment())
+			assert.Equal(t, tc.expectedMinimizeOutdated, tc.config.GetMinimizeOutdated())
+		})
+	}
+}
+
+func TestSkipReason(t *testing.T) {
+	cfg := &config.ArianeConfig{
+		Workflows: map[string]config.WorkflowPathsRegexConfig{
+			"foo.yaml":     {PathsRegex: "foo/"},
+			"bar.yaml":     {PathsIgnoreRegex: "docs/"},
+			"invalid.yaml": {PathsRegex: "("},
+		},
+	}
+	files := []*github.CommitFile{{Filename: github.Ptr("docs/README.md")}}
+
+	assert.Equal(t, "no files changed", cfg.SkipReason("foo.yaml", nil))
+	assert.Equal(t, "no changed file matches paths-regex `foo/`", cfg.SkipReason("foo.yaml", files))
+	assert.Equal(t, "all changed files match paths-ignore-regex `docs/`", cfg.SkipReason("bar.yaml", files))
+	assert.Equal(t, "invalid paths-regex `(`", cfg.SkipReason("invalid.yaml", files))
+	assert.Equal(t, "only other workflows changed", cfg.SkipReason("baz.yaml", []*github.CommitFile{{Filename: github.Ptr(".github/workflows/other.yaml")}}))
+}
+
 // boolPtr is a helper function to create a pointer to a bool
 func boolPtr(b bool) *bool {
 	return &b
@@ -738,3 +843,221 @@ triggers:
 		})
 	}
 }
+
+func TestGetReviewsConfig_WithYAMLParsing(t *testing.T) {
+	testCases := []struct {
+		name                   string
+		yamlContent            string
+		expectedReviewComments bool
+		expectedOnApproval     string
+	}{
+		{
+			name: "reviews configured",
+			yamlContent: `
+reviews:
+  review-comments: true
+  on-approval: /test
+`,
+			expectedReviewComments: true,
+			expectedOnApproval:     "/test",
+		},
+		{
+			name: "reviews without review comments",
+			yamlContent: `
+reviews:
+  on-approval: /test
+`,
+			expectedReviewComments: false,
+			expectedOnApproval:     "/test",
+		},
+		{
+			name:                   "reviews not configured",
+			yamlContent:            `triggers: {}`,
+			expectedReviewComments: false,
+			expectedOnApproval:     "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg config.ArianeConfig
+			err := yaml.Unmarshal([]byte(tc.yamlContent), &cfg)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedReviewComments, cfg.GetReviewComments())
+			assert.Equal(t, tc.expectedOnApproval, cfg.GetOnApproval())
+		})
+	}
+}
+
+func TestGetRerunDelay_WithYAMLParsing(t *testing.T) {
+	testCases := []struct {
+		name           string
+		yamlContent    string
+		expectedDelays []time.Duration
+	}{
+		{
+			name: "fixed delay",
+			yamlContent: `
+rerun:
+  delay: 2m
+`,
+			expectedDelays: []time.Duration{2 * time.Minute, 2 * time.Minute, 2 * time.Minute},
+		},
+		{
+			name: "exponential backoff",
+			yamlContent: `
+rerun:
+  delay: 1m
+  backoff-factor: 2
+  max-delay: 3m
+`,
+			expectedDelays: []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute},
+		},
+		{
+			name: "no delay",
+			yamlContent: `
+rerun:
+  max-retries: 3
+`,
+			expectedDelays: []time.Duration{0, 0, 0},
+		},
+		{
+			name:           "rerun not configured",
+			yamlContent:    `triggers: {}`,
+			expectedDelays: []time.Duration{0, 0, 0},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg config.ArianeConfig
+			err := yaml.Unmarshal([]byte(tc.yamlContent), &cfg)
+			assert.NoError(t, err)
+			for i, expected := range tc.expectedDelays {
+				assert.Equal(t, expected, cfg.GetRerunDelay(i+1), "attempt %d", i+1)
+			}
+		})
+	}
+}
+
+func TestGetConclusionPolicy_WithYAMLParsing(t *testing.T) {
+	var cfg config.ArianeConfig
+	err := yaml.Unmarshal([]byte(`
+rerun:
+  conclusions:
+    timed_out: report
+    startup_failure: rerun-everything
+    cancelled: rerun-all
+`), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, config.RerunPolicyFailedJobs, cfg.GetConclusionPolicy("failure"))
+	assert.Equal(t, config.RerunPolicyReport, cfg.GetConclusionPolicy("timed_out"))
+	assert.Equal(t, config.RerunPolicyAll, cfg.GetConclusionPolicy("startup_failure"), "invalid policies fall back to the default one")
+	assert.Equal(t, "", cfg.GetConclusionPolicy("cancelled"), "unsupported conclusions are not handled")
+	assert.Equal(t, "", cfg.GetConclusionPolicy("neutral"))
+
+	assert.Equal(t, config.RerunPolicyFailedJobs, (&config.ArianeConfig{}).GetConclusionPolicy("timed_out"))
+}
+
+func TestGetPreRerunJobs_WithYAMLParsing(t *testing.T) {
+	var cfg config.ArianeConfig
+	err := yaml.Unmarshal([]byte(`
+pre-rerun-jobs:
+  conformance-e2e.yaml:
+    - job: '^Setup'
+      wait-for-completion: true
+      timeout: 5m
+    - job: '^Commit Status Start$'
+      delay: 10s
+  lint.yaml: []
+`), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []config.PreRerunJob{
+		{Job: "^Setup", WaitForCompletion: true, Timeout: 5 * time.Minute},
+		{Job: "^Commit Status Start$", Delay: 10 * time.Second},
+	}, cfg.GetPreRerunJobs("conformance-e2e.yaml"))
+	assert.Empty(t, cfg.GetPreRerunJobs("lint.yaml"))
+	assert.Equal(t, config.DefaultPreRerunJobs, cfg.GetPreRerunJobs("unit.yaml"))
+}
+
+func TestGetPendingChecks_WithYAMLParsing(t *testing.T) {
+	var cfg config.ArianeConfig
+	assert.False(t, cfg.GetPendingChecks())
+
+	err := yaml.Unmarshal([]byte(`
+checks:
+  pending: true
+`), &cfg)
+	assert.NoError(t, err)
+	assert.True(t, cfg.GetPendingChecks())
+
+	merged := cfg.Merge(&config.ArianeConfig{ChecksConfig: &config.ChecksConfig{Pending: new(bool)}})
+	assert.False(t, merged.GetPendingChecks())
+}
+
+func TestGetRequiredCheck_WithYAMLParsing(t *testing.T) {
+	var cfg config.ArianeConfig
+	name, workflows := cfg.GetRequiredCheck()
+	assert.Empty(t, name)
+	assert.Empty(t, workflows)
+
+	err := yaml.Unmarshal([]byte(`
+checks:
+  required:
+    workflows:
+      - ci.yaml
+      - e2e.yaml
+`), &cfg)
+	assert.NoError(t, err)
+	name, workflows = cfg.GetRequiredCheck()
+	assert.Equal(t, config.DefaultRequiredCheckName, name)
+	assert.Equal(t, []string{"ci.yaml", "e2e.yaml"}, workflows)
+
+	cfg.ChecksConfig.Required.Name = "ci/required"
+	name, _ = cfg.GetRequiredCheck()
+	assert.Equal(t, "ci/required", name)
+}
+
+func TestWorkflowSkippedChecks_WithYAMLParsing(t *testing.T) {
+	var cfg config.ArianeConfig
+	err := yaml.Unmarshal([]byte(`
+workflows:
+  conformance-e2e.yaml:
+    paths-ignore-regex: Documentation/
+    skipped-checks:
+      - Installation and Connectivity Test (ipv4)
+      - Installation and Connectivity Test (ipv6)
+  tests-unit.yaml:
+    paths-regex: pkg/
+    skipped-checks-from-jobs: true
+`), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Installation and Connectivity Test (ipv4)", "Installation and Connectivity Test (ipv6)"}, cfg.Workflows["conformance-e2e.yaml"].SkippedChecks)
+	assert.False(t, cfg.Workflows["conformance-e2e.yaml"].SkippedChecksFromJobs)
+	assert.Empty(t, cfg.Workflows["tests-unit.yaml"].SkippedChecks)
+	assert.True(t, cfg.Workflows["tests-unit.yaml"].SkippedChecksFromJobs)
+}
+
+func TestGetSkippedChecks_WithYAMLParsing(t *testing.T) {
+	var cfg config.ArianeConfig
+	assert.Equal(t, config.SkippedChecksAll, cfg.GetSkippedChecks())
+
+	err := yaml.Unmarshal([]byte(`
+checks:
+  skipped: required
+`), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, config.SkippedChecksRequired, cfg.GetSkippedChecks())
+}
+
+func TestGetMergeGroupChecks_WithYAMLParsing(t *testing.T) {
+	var cfg config.ArianeConfig
+	assert.Equal(t, config.MergeGroupChecksSuccess, cfg.GetMergeGroupChecks())
+
+	err := yaml.Unmarshal([]byte(`
+checks:
+  merge-group: paths
+`), &cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, config.MergeGroupChecksPaths, cfg.GetMergeGroupChecks())
+}
@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// Feedback message types, which can be customized with Go text templates under feedback.templates
+const (
+	// TemplateNotAllowed is posted when the author of a command is not a member of an allowed team
+	TemplateNotAllowed = "not-allowed"
+	// TemplateCommandNotFound is posted when a command does not match any trigger
+	TemplateCommandNotFound = "command-not-found"
+	// TemplateTriggerSkipped is posted when a trigger is postponed until its dependencies complete
+	TemplateTriggerSkipped = "trigger-skipped"
+	// TemplateTriggerFailed is posted when the workflows of a trigger could not be processed
+	TemplateTriggerFailed = "trigger-failed"
+	// TemplateWorkflowsReport is posted with the status of the workflows of a trigger
+	TemplateWorkflowsReport = "workflows-report"
+	// TemplateRunFailed is posted with the triage summary of a workflow run which failed for good
+	TemplateRunFailed = "run-failed"
+	// TemplateFlakeRetry is posted when the failed jobs of a run are rerun because they match known flakes
+	TemplateFlakeRetry = "flake-retry"
+	// TemplateFlakesReport is posted in response to the /ariane flakes command, with the flake rates of the repository
+	TemplateFlakesReport = "flakes-report"
+	// TemplateQuarantine is posted when a workflow is quarantined or un-quarantined, and when the failure
+	// of a quarantined workflow is flagged as a known flake
+	TemplateQuarantine = "quarantine"
+	// TemplateRetriesExhausted is posted once a workflow run exhausted its retries, with its attempts
+	TemplateRetriesExhausted = "retries-exhausted"
+	// TemplateRerunBudget is posted when a workflow run is not rerun because a rerun budget is exhausted
+	TemplateRerunBudget = "rerun-budget"
+	// TemplatePullRequestFailed is posted when the pull request of a command or trigger could not be retrieved
+	TemplatePullRequestFailed = "pull-request-failed"
+	// TemplateConfigFailed is posted when the configuration applying to a pull request could not be retrieved
+	TemplateConfigFailed = "config-failed"
+	// TemplateFilesFailed is posted when the files changed by a pull request could not be retrieved
+	TemplateFilesFailed = "files-failed"
+	// TemplateUnsupportedBot is posted when a command is sent by a bot which does not belong to the
+	// repository owner
+	TemplateUnsupportedBot = "unsupported-bot"
+)
+
+// DefaultFeedbackTemplates are the templates used for message types not customized by the repository
+var DefaultFeedbackTemplates = map[string]string{
+	TemplateNotAllowed:        "Comment by {{.Author}} not allowed",
+	TemplateCommandNotFound:   "Command {{.Command}} not found",
+	TemplateTriggerSkipped:    "{{.Reason}}",
+	TemplateTriggerFailed:     "Failed to process workflows for trigger: {{.Reason}}",
+	TemplateWorkflowsReport:   "{{.Table}}",
+	TemplateRunFailed:         "{{.Triage}}",
+	TemplateFlakeRetry:        "{{.Retry}}",
+	TemplateFlakesReport:      "{{.Table}}",
+	TemplateQuarantine:        "{{.Quarantine}}",
+	TemplateRetriesExhausted:  "{{.Exhausted}}",
+	TemplateRerunBudget:       "{{.Budget}}",
+	TemplatePullRequestFailed: "Failed to retrieve pull request: {{.Reason}}",
+	TemplateConfigFailed:      "Failed to retrieve config file",
+	TemplateFilesFailed:       "Failed to retrieve pull request files: {{.Reason}}",
+	TemplateUnsupportedBot:    "{{.Source}} was created by an unsupported bot: {{.Author}}",
+}
+
+// Feedback kinds, whose channel can be chosen under feedback.channels
+const (
+	// FeedbackErrors are messages about triggers which could not be processed or were postponed, and
+	// about workflow runs which failed, are retried or exhausted their retries or rerun budget
+	FeedbackErrors = "errors"
+	// FeedbackRejections are messages about commands which were not accepted
+	FeedbackRejections = "rejections"
+	// FeedbackWorkflowsReport is the report on the workflows of a trigger, or on their flakiness
+	FeedbackWorkflowsReport = "workflows-report"
+	// FeedbackQuarantine are the quarantine decisions about flaky workflows
+	FeedbackQuarantine = "quarantine"
+)
+
+// Feedback channels, i.e. where Ariane reports feedback on a pull request
+const (
+	// ChannelComment posts a new comment for each message
+	ChannelComment = "comment"
+	// ChannelStickyComment updates a section of a single comment edited in place
+	ChannelStickyComment = "sticky-comment"
+	// ChannelPRDescription updates a section of a block managed by Ariane at the end of the pull request description
+	ChannelPRDescription = "pr-description"
+	// ChannelCheckRun updates a section of the summary of an "Ariane feedback" check run on the pull request head
+	ChannelCheckRun = "check-run"
+	// ChannelNone discards the messages
+	ChannelNone = "none"
+)
+
+// ValidChannels are the supported feedback channels
+var ValidChannels = []string{ChannelComment, ChannelStickyComment, ChannelPRDescription, ChannelCheckRun, ChannelNone}
+
+// feedbackKinds maps each message type to its feedback kind
+var feedbackKinds = map[string]string{
+	TemplateNotAllowed:        FeedbackRejections,
+	TemplateCommandNotFound:   FeedbackRejections,
+	TemplateTriggerSkipped:    FeedbackErrors,
+	TemplateTriggerFailed:     FeedbackErrors,
+	TemplateWorkflowsReport:   FeedbackWorkflowsReport,
+	TemplateRunFailed:         FeedbackErrors,
+	TemplateFlakeRetry:        FeedbackErrors,
+	TemplateFlakesReport:      FeedbackWorkflowsReport,
+	TemplateQuarantine:        FeedbackQuarantine,
+	TemplateRetriesExhausted:  FeedbackErrors,
+	TemplateRerunBudget:       FeedbackErrors,
+	TemplatePullRequestFailed: FeedbackErrors,
+	TemplateConfigFailed:      FeedbackErrors,
+	TemplateFilesFailed:       FeedbackErrors,
+	TemplateUnsupportedBot:    FeedbackRejections,
+}
+
+// Command lifecycle stages, whose reactions can be customized under feedback.reactions
+const (
+	// ReactionProcessing is added when Ariane starts processing a command
+	ReactionProcessing = "processing"
+	// ReactionDependencyInProgress is added when a command waits for its dependencies to complete
+	ReactionDependencyInProgress = "dependency-in-progress"
+	// ReactionFailed is added when the workflows of a command could not be processed
+	ReactionFailed = "failed"
+	// ReactionTriggered is added when the workflows of a command were triggered
+	ReactionTriggered = "triggered"
+)
+
+// DefaultReactions are the reactions used for lifecycle stages not customized by the repository
+var DefaultReactions = map[string]string{
+	ReactionProcessing:           "eyes",
+	ReactionDependencyInProgress: "+1",
+	ReactionFailed:               "confused",
+	ReactionTriggered:            "rocket",
+}
+
+// ValidReactions are the reactions supported by GitHub
+// See https://docs.github.com/en/rest/reactions/reactions?apiVersion=2022-11-28#about-reactions
+var ValidReactions = []string{"+1", "-1", "laugh", "confused", "heart", "hooray", "rocket", "eyes"}
+
+// FeedbackData is the data available to feedback templates. Fields irrelevant to a message type are
+// left empty.
+type FeedbackData struct {
+	// Author is the user who sent the command, and Source where it was sent from, e.g. "Issue comment"
+	Author string
+	Source string
+	// Command is the command the message is about, Commands all the commands of a rejected comment
+	Command  string
+	Commands []string
+	// Reason explains why a trigger was skipped or failed, or why the pull request, its configuration
+	// or its files could not be retrieved
+	Reason string
+	// Table is the default rendering of the workflows report (or of the flakes report), and Workflows
+	// the content of the workflows report
+	Table     string
+	Workflows []WorkflowReport
+	// Triage is the default rendering of the triage summary of a failed run, Workflow the name of its
+	// workflow, and FailedJobs its content
+	Triage     string
+	Workflow   string
+	FailedJobs []FailedJob
+	// Retry is the default rendering of the retry of a run matching known flakes, and Flakes the flakes
+	// matched by its failed jobs
+	Retry  string
+	Flakes []MatchedFlake
+	// Quarantine is the default rendering of a quarantine decision about Workflow
+	Quarantine string
+	// Exhausted is the default rendering of the attempts of a run of Workflow which exhausted its
+	// retries, and Attempts their failed jobs
+	Exhausted string
+	Attempts  []RunAttempt
+	// Budget is the default rendering of the rerun budget a run of Workflow exceeded
+	Budget string
+}
+
+// RunAttempt describes an attempt of a workflow run
+type RunAttempt struct {
+	Attempt    int
+	FailedJobs []string
+}
+
+// WorkflowReport describes a workflow in the workflows report
+type WorkflowReport struct {
+	Name    string
+	Status  string
+	Reason  string
+	RunURL  string
+	Attempt int
+}
+
+// FailedJob describes a failed job in the triage summary of a failed run
+type FailedJob struct {
+	Name        string
+	URL         string
+	FailedSteps []string
+	// LogExcerpt contains the log lines matching the error patterns, or the last lines of the log
+	LogExcerpt []string
+}
+
+// MatchedFlake describes a failed job matching a known flake
+type MatchedFlake struct {
+	Job   string
+	Name  string
+	Issue string
+	// Match is the log line or check annotation which matched the flake pattern
+	Match string
+}
+
+// RenderFeedback renders the feedback message of the given type with the repository's template, or
+// the default one. If the repository's template is invalid, the default message is returned along
+// with the error.
+func (c *ArianeConfig) RenderFeedback(name string, data FeedbackData) (string, error) {
+	text, ok := c.Feedback.Templates[name]
+	if !ok {
+		return renderTemplate(name, DefaultFeedbackTemplates[name], data)
+	}
+	message, err := renderTemplate(name, text, data)
+	if err != nil {
+		message, _ = renderTemplate(name, DefaultFeedbackTemplates[name], data)
+		return message, fmt.Errorf("invalid feedback template %q: %w", name, err)
+	}
+	return message, nil
+}
+
+func renderTemplate(name, text string, data FeedbackData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var builder strings.Builder
+	if err := tmpl.Execute(&builder, data); err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// ValidateFeedback returns the errors found in the feedback templates and reactions of the configuration
+func (c *ArianeConfig) ValidateFeedback() []error {
+	var errs []error
+	for name, text := range c.Feedback.Templates {
+		if _, ok := DefaultFeedbackTemplates[name]; !ok {
+			errs = append(errs, fmt.Errorf("feedback template %q is not a known message type", name))
+			continue
+		}
+		if _, err := renderTemplate(name, text, FeedbackData{}); err != nil {
+			errs = append(errs, fmt.Errorf("feedback template %q is invalid: %v", name, err))
+		}
+	}
+	for stage, reaction := range c.Feedback.Reactions {
+		if _, ok := DefaultReactions[stage]; !ok {
+			errs = append(errs, fmt.Errorf("feedback reaction %q is not a known lifecycle stage", stage))
+			continue
+		}
+		if !slices.Contains(ValidReactions, reaction) {
+			errs = append(errs, fmt.Errorf("feedback reaction %q for %q is not one of %s", reaction, stage, strings.Join(ValidReactions, ", ")))
+		}
+	}
+	for kind, channel := range c.Feedback.Channels {
+		if kind != FeedbackErrors && kind != FeedbackRejections && kind != FeedbackWorkflowsReport && kind != FeedbackQuarantine {
+			errs = append(errs, fmt.Errorf("feedback channel %q is not a known feedback kind", kind))
+			continue
+		}
+		if !slices.Contains(ValidChannels, channel) {
+			errs = append(errs, fmt.Errorf("feedback channel %q for %q is not one of %s", channel, kind, strings.Join(ValidChannels, ", ")))
+		}
+	}
+	return errs
+}
+
+// GetFeedbackChannel returns the channel through which the messages of the given type are reported.
+// Unless configured otherwise, messages are posted as new comments, or in the sticky comment if
+// feedback.sticky-comment is enabled.
+func (c *ArianeConfig) GetFeedbackChannel(name string) string {
+	if channel, ok := c.Feedback.Channels[feedbackKinds[name]]; ok {
+		return channel
+	}
+	if c.GetStickyComment() {
+		return ChannelStickyComment
+	}
+	return ChannelComment
+}
+
+// GetReaction returns the reaction to add for the given command lifecycle stage
+func (c *ArianeConfig) GetReaction(stage string) string {
+	if reaction, ok := c.Feedback.Reactions[stage]; ok {
+		return reaction
+	}
+	return DefaultReactions[stage]
+}
@@ -0,0 +1,193 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func TestRenderFeedback(t *testing.T) {
+	testCases := []struct {
+		name            string
+		templates       map[string]string
+		template        string
+		data            config.FeedbackData
+		expectedMessage string
+		expectedError   bool
+	}{
+		{
+			name:            "default template",
+			template:        config.TemplateCommandNotFound,
+			data:            config.FeedbackData{Command: "/tset"},
+			expectedMessage: "Command /tset not found",
+		},
+		{
+			name: "custom template",
+			templates: map[string]string{
+				config.TemplateNotAllowed: "Sorry @{{.Author}}, {{range .Commands}}`{{.}}` {{end}}can only be run by maintainers, see CONTRIBUTING.md",
+			},
+			template:        config.TemplateNotAllowed,
+			data:            config.FeedbackData{Author: "user", Commands: []string{"/test", "/lint"}},
+			expectedMessage: "Sorry @user, `/test` `/lint` can only be run by maintainers, see CONTRIBUTING.md",
+		},
+		{
+			name: "custom workflows report",
+			templates: map[string]string{
+				config.TemplateWorkflowsReport: "{{.Table}}\n{{len .Workflows}} workflow(s) for {{.Command}}",
+			},
+			template: config.TemplateWorkflowsReport,
+			data: config.FeedbackData{
+				Command:   "/test",
+				Table:     "## Workflow Status\n",
+				Workflows: []config.WorkflowReport{{Name: "foo.yaml"}},
+			},
+			expectedMessage: "## Workflow Status\n\n1 workflow(s) for /test",
+		},
+		{
+			name:            "default unsupported bot template",
+			template:        config.TemplateUnsupportedBot,
+			data:            config.FeedbackData{Author: "other[bot]", Source: "Issue comment"},
+			expectedMessage: "Issue comment was created by an unsupported bot: other[bot]",
+		},
+		{
+			name: "custom pull request files template",
+			templates: map[string]string{
+				config.TemplateFilesFailed: "Could not list the files of this PR for {{.Command}} ({{.Reason}}), please retry later",
+			},
+			template:        config.TemplateFilesFailed,
+			data:            config.FeedbackData{Command: "/test", Reason: "500"},
+			expectedMessage: "Could not list the files of this PR for /test (500), please retry later",
+		},
+		{
+			name: "invalid template falls back to the default one",
+			templates: map[string]string{
+				config.TemplateTriggerFailed: "{{.Unknown}}",
+			},
+			template:        config.TemplateTriggerFailed,
+			data:            config.FeedbackData{Reason: "boom"},
+			expectedMessage: "Failed to process workflows for trigger: boom",
+			expectedError:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ArianeConfig{Feedback: config.FeedbackConfig{Templates: tc.templates}}
+			message, err := cfg.RenderFeedback(tc.template, tc.data)
+			assert.Equal(t, tc.expectedMessage, message)
+			if tc.expectedError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateFeedback(t *testing.T) {
+	yamlConfig := `
+feedback:
+  templates:
+    command-not-found: "Unknown command {{.Command}}"
+    trigger-failed: "{{.Unknown}}"
+    trigger-skiped: "{{.Reason}}"
+    not-allowed: "{{.Author"
+  reactions:
+    processing: heart
+    triggered: party
+    done: rocket
+  channels:
+    errors: check-run
+    rejections: slack
+    workflows: comment
+`
+	var cfg config.ArianeConfig
+	err := yaml.Unmarshal([]byte(yamlConfig), &cfg)
+	assert.NoError(t, err)
+
+	errs := cfg.ValidateFeedback()
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+	assert.Len(t, messages, 7)
+	assert.Contains(t, messages, `feedback template "trigger-skiped" is not a known message type`)
+	assert.Contains(t, messages, `feedback reaction "done" is not a known lifecycle stage`)
+	assert.Contains(t, messages, `feedback reaction "party" for "triggered" is not one of +1, -1, laugh, confused, heart, hooray, rocket, eyes`)
+	assert.Contains(t, messages, `feedback channel "workflows" is not a known feedback kind`)
+	assert.Contains(t, messages, `feedback channel "slack" for "rejections" is not one of comment, sticky-comment, pr-description, check-run, none`)
+
+	assert.Empty(t, (&config.ArianeConfig{}).ValidateFeedback())
+}
+
+func TestGetReaction(t *testing.T) {
+	cfg := &config.ArianeConfig{
+		Feedback: config.FeedbackConfig{
+			Reactions: map[string]string{config.ReactionTriggered: "hooray"},
+		},
+	}
+	assert.Equal(t, "eyes", cfg.GetReaction(config.ReactionProcessing))
+	assert.Equal(t, "hooray", cfg.GetReaction(config.ReactionTriggered))
+	assert.Equal(t, "confused", (&config.ArianeConfig{}).GetReaction(config.ReactionFailed))
+}
+
+func TestGetFeedbackChannel(t *testing.T) {
+	testCases := []struct {
+		name     string
+		feedback config.FeedbackConfig
+		expected map[string]string
+	}{
+		{
+			name: "default channel",
+			expected: map[string]string{
+				config.TemplateNotAllowed:      config.ChannelComment,
+				config.TemplateTriggerFailed:   config.ChannelComment,
+				config.TemplateWorkflowsReport: config.ChannelComment,
+			},
+		},
+		{
+			name:     "sticky comment enabled",
+			feedback: config.FeedbackConfig{StickyComment: boolPtr(true)},
+			expected: map[string]string{
+				config.TemplateCommandNotFound: config.ChannelStickyComment,
+				config.TemplateTriggerSkipped:  config.ChannelStickyComment,
+				config.TemplateWorkflowsReport: config.ChannelStickyComment,
+			},
+		},
+		{
+			name: "channels by feedback kind",
+			feedback: config.FeedbackConfig{
+				StickyComment: boolPtr(true),
+				Channels: map[string]string{
+					config.FeedbackErrors:          config.ChannelCheckRun,
+					config.FeedbackRejections:      config.ChannelNone,
+					config.FeedbackWorkflowsReport: config.ChannelPRDescription,
+				},
+			},
+			expected: map[string]string{
+				config.TemplateNotAllowed:      config.ChannelNone,
+				config.TemplateCommandNotFound: config.ChannelNone,
+				config.TemplateTriggerSkipped:  config.ChannelCheckRun,
+				config.TemplateTriggerFailed:   config.ChannelCheckRun,
+				config.TemplateWorkflowsReport: config.ChannelPRDescription,
+				config.TemplateConfigFailed:    config.ChannelCheckRun,
+				config.TemplateUnsupportedBot:  config.ChannelNone,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config.ArianeConfig{Feedback: tc.feedback}
+			for name, expected := range tc.expected {
+				assert.Equal(t, expected, cfg.GetFeedbackChannel(name), name)
+			}
+		})
+	}
+}
@@ -22,10 +22,14 @@ const (
 )
 
 type ServerConfig struct {
-	Server  HTTPConfig       `yaml:"server"`
-	Github  githubapp.Config `yaml:"github"`
-	Client  ClientConfig     `yaml:"client"`
-	Version string           `yaml:"version"`
+	Server    HTTPConfig       `yaml:"server"`
+	Github    githubapp.Config `yaml:"github"`
+	Client    ClientConfig     `yaml:"client"`
+	Flakes    FlakesConfig     `yaml:"flakes"`
+	Scheduler SchedulerConfig  `yaml:"scheduler"`
+	Dispatch  DispatchConfig   `yaml:"dispatch"`
+	Reruns    RerunsConfig     `yaml:"reruns"`
+	Version   string           `yaml:"version"`
 }
 
 type HTTPConfig struct {
@@ -34,12 +38,41 @@ type HTTPConfig struct {
 }
 
 type ClientConfig struct {
-	// RunDelay represents delay between running Commit Status Start job and re-running failed tests
+	// RunDelay represents delay between rerunning a pre-rerun job (e.g. Commit Status Start) and re-running
+	// failed tests, unless configured otherwise by the repository
 	RunDelay         time.Duration `yaml:"runDelay"`
 	Timeout          time.Duration `yaml:"timeout"`
 	MaxRetryAttempts int           `yaml:"maxRetryAttempts"`
 }
 
+type FlakesConfig struct {
+	// StorePath is the file recording the flakiness history of workflow runs. If empty, the history is
+	// only kept in memory and lost on restart.
+	StorePath string `yaml:"storePath"`
+	// APIToken is the bearer token authenticating the requests to the flake rates endpoint. If empty, the
+	// endpoint is not served.
+	APIToken string `yaml:"apiToken"`
+}
+
+type SchedulerConfig struct {
+	// StorePath is the file persisting the pending scheduled tasks (e.g. delayed reruns), so that they
+	// survive a restart. If empty, they are only kept in memory.
+	StorePath string `yaml:"storePath"`
+}
+
+type DispatchConfig struct {
+	// StorePath is the file persisting the workflow runs dispatched by Ariane, along with the pull request
+	// commit and the check runs they were dispatched for, so that they are still reported on after a
+	// restart. If empty, they are only kept in memory.
+	StorePath string `yaml:"storePath"`
+}
+
+type RerunsConfig struct {
+	// DailyBudget is the maximum number of automatic reruns per installation and per day (UTC), across
+	// all its repositories. If 0, reruns are unlimited.
+	DailyBudget int `yaml:"dailyBudget"`
+}
+
 func ReadServerConfig(path string) (*ServerConfig, error) {
 	var c ServerConfig
 
@@ -95,6 +128,29 @@ func (s *ServerConfig) SetValuesFromEnv(prefix string) {
 		s.Version = v
 	}
 
+	if v, ok := os.LookupEnv(prefix + "ARIANE_FLAKES_STORE_PATH"); ok {
+		s.Flakes.StorePath = v
+	}
+
+	if v, ok := os.LookupEnv(prefix + "ARIANE_FLAKES_API_TOKEN"); ok {
+		s.Flakes.APIToken = v
+	}
+
+	if v, ok := os.LookupEnv(prefix + "ARIANE_SCHEDULER_STORE_PATH"); ok {
+		s.Scheduler.StorePath = v
+	}
+
+	if v, ok := os.LookupEnv(prefix + "ARIANE_DISPATCH_STORE_PATH"); ok {
+		s.Dispatch.StorePath = v
+	}
+
+	if v, ok := os.LookupEnv(prefix + "ARIANE_RERUNS_DAILY_BUDGET"); ok {
+		budget, err := strconv.Atoi(v)
+		if err == nil && budget > 0 {
+			s.Reruns.DailyBudget = budget
+		}
+	}
+
 	s.Client.RunDelay = DefaultRunDelay
 	if v, ok := os.LookupEnv(prefix + "ARIANE_RUN_DELAY"); ok {
 		delay, err := time.ParseDuration(v)
@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package flakes
+
+import "sort"
+
+// Kinds of records tracking exhausted retries
+const (
+	// KindExhausted records that a run of a workflow exhausted its retries on a pull request
+	KindExhausted = "exhausted"
+	// KindRecovered records that a workflow which exhausted its retries on a pull request succeeded since
+	KindRecovered = "recovered"
+)
+
+// ExhaustedTracker tracks the workflows which exhausted their retries on pull requests, until they
+// succeed again
+type ExhaustedTracker struct {
+	store *Store
+}
+
+// ExhaustedRetries returns the tracker of the exhausted retries recorded in s
+func (s *Store) ExhaustedRetries() *ExhaustedTracker {
+	return &ExhaustedTracker{store: s}
+}
+
+// Workflows returns the workflows which exhausted their retries on the given pull request of repository
+// and did not succeed since, sorted by name
+func (t *ExhaustedTracker) Workflows(repository string, pr int) []string {
+	t.store.mu.Lock()
+	exhausted := make(map[string]bool)
+	for _, record := range t.store.records {
+		if (record.Kind == KindExhausted || record.Kind == KindRecovered) && record.Repository == repository && record.PR == pr {
+			exhausted[record.Workflow] = record.Kind == KindExhausted
+		}
+	}
+	t.store.mu.Unlock()
+
+	var workflows []string
+	for workflow, isExhausted := range exhausted {
+		if isExhausted {
+			workflows = append(workflows, workflow)
+		}
+	}
+	sort.Strings(workflows)
+	return workflows
+}
@@ -0,0 +1,31 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package flakes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExhaustedTracker_Workflows(t *testing.T) {
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	records := []Record{
+		{Kind: KindExhausted, Repository: "owner/repo", Workflow: "e2e", PR: 1, RunID: 1},
+		{Kind: KindExhausted, Repository: "owner/repo", Workflow: "unit", PR: 1, RunID: 2},
+		{Kind: KindRecovered, Repository: "owner/repo", Workflow: "unit", PR: 1, RunID: 3},
+		{Kind: KindExhausted, Repository: "owner/repo", Workflow: "lint", PR: 2, RunID: 4},
+		{Kind: KindExhausted, Repository: "owner/other", Workflow: "build", PR: 1, RunID: 5},
+	}
+	for _, record := range records {
+		assert.NoError(t, s.Add(record))
+	}
+
+	assert.Equal(t, []string{"e2e"}, s.ExhaustedRetries().Workflows("owner/repo", 1))
+	assert.Equal(t, []string{"lint"}, s.ExhaustedRetries().Workflows("owner/repo", 2))
+	assert.Empty(t, s.ExhaustedRetries().Workflows("owner/repo", 3))
+}
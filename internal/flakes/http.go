@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package flakes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Handler returns an HTTP handler responding with the flake rates as JSON, to requests authenticated
+// with token as a bearer token. The repository query parameter (owner/repo) restricts them to a
+// repository, and the period parameter sets the period they are computed over (see ParsePeriod,
+// DefaultPeriod by default). All requests are rejected if token is empty.
+func (s *Store) Handler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || !ok || subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		period := DefaultPeriod
+		if value := r.URL.Query().Get("period"); value != "" {
+			var err error
+			if period, err = ParsePeriod(value); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		rates := s.Rates(r.URL.Query().Get("repository"), time.Now().Add(-period))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(rates)
+	})
+}
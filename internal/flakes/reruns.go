@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package flakes
+
+import "time"
+
+// Kinds of records accounting reruns
+const (
+	// KindRerun records that the failed jobs of an attempt were rerun, or are scheduled to be
+	KindRerun = "rerun"
+	// KindCancelledRerun records that a rerun recorded beforehand did not happen, releasing its budget
+	KindCancelledRerun = "cancelled-rerun"
+)
+
+// RerunBudgets limits the reruns of a head commit, and the reruns by an installation since a given
+// time. A budget of 0 is unlimited.
+type RerunBudgets struct {
+	Commit       int
+	Installation int
+	Since        time.Time
+}
+
+// RerunLedger accounts the reruns of workflow runs against their budgets. Reruns are recorded in the
+// history of the store backing the ledger, as they also count in the flake rates of the workflows.
+type RerunLedger struct {
+	store *Store
+}
+
+// Reruns returns the ledger of the reruns recorded in s
+func (s *Store) Reruns() *RerunLedger {
+	return &RerunLedger{store: s}
+}
+
+// Reserve records the rerun r, of kind KindRerun, unless it would exceed budgets. Checking the budgets
+// and recording the rerun is atomic, so that concurrent reruns can't exceed them. It returns the reruns
+// of the head commit and by the installation of r which were recorded beforehand, and whether r was
+// recorded. A reserved rerun which does not happen must be cancelled with a KindCancelledRerun record.
+func (l *RerunLedger) Reserve(r Record, budgets RerunBudgets) (commitReruns, installationReruns int, reserved bool, err error) {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	commitReruns = l.count(func(record Record) bool {
+		return record.Repository == r.Repository && record.SHA == r.SHA
+	})
+	installationReruns = l.count(func(record Record) bool {
+		return record.Installation == r.Installation && !record.Time.Before(budgets.Since)
+	})
+	if (budgets.Commit > 0 && commitReruns >= budgets.Commit) || (budgets.Installation > 0 && installationReruns >= budgets.Installation) {
+		return commitReruns, installationReruns, false, nil
+	}
+	return commitReruns, installationReruns, true, l.store.add(r)
+}
+
+// CommitReruns returns the number of reruns of the workflow runs of the given head commit of repository
+func (l *RerunLedger) CommitReruns(repository, sha string) int {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	return l.count(func(record Record) bool {
+		return record.Repository == repository && record.SHA == sha
+	})
+}
+
+// InstallationReruns returns the number of reruns by the given installation since the given time
+func (l *RerunLedger) InstallationReruns(installation int64, since time.Time) int {
+	l.store.mu.Lock()
+	defer l.store.mu.Unlock()
+
+	return l.count(func(record Record) bool {
+		return record.Installation == installation && !record.Time.Before(since)
+	})
+}
+
+// count returns the number of reruns matching filter, not counting the cancelled ones. The store must
+// be locked.
+func (l *RerunLedger) count(filter func(Record) bool) int {
+	reruns := 0
+	for _, record := range l.store.records {
+		if !filter(record) {
+			continue
+		}
+		switch record.Kind {
+		case KindRerun:
+			reruns++
+		case KindCancelledRerun:
+			reruns--
+		}
+	}
+	return reruns
+}
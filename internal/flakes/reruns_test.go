@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package flakes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRerunLedger_Reserve(t *testing.T) {
+	now := time.Now()
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	budgets := RerunBudgets{Commit: 2, Installation: 3, Since: now.Add(-time.Hour)}
+	rerun := func(sha string, runID int64) Record {
+		return Record{Kind: KindRerun, Repository: "owner/repo", SHA: sha, Installation: 1, RunID: runID}
+	}
+
+	for runID := int64(1); runID <= 2; runID++ {
+		_, _, reserved, err := s.Reruns().Reserve(rerun("abc", runID), budgets)
+		assert.NoError(t, err)
+		assert.True(t, reserved)
+	}
+	commitReruns, installationReruns, reserved, err := s.Reruns().Reserve(rerun("abc", 3), budgets)
+	assert.NoError(t, err)
+	assert.False(t, reserved, "the budget of the commit is exhausted")
+	assert.Equal(t, 2, commitReruns)
+	assert.Equal(t, 2, installationReruns)
+
+	assert.NoError(t, s.Add(Record{Kind: KindCancelledRerun, Repository: "owner/repo", SHA: "abc", Installation: 1, RunID: 2}))
+	_, _, reserved, err = s.Reruns().Reserve(rerun("abc", 3), budgets)
+	assert.NoError(t, err)
+	assert.True(t, reserved, "cancelled reruns release their budget")
+
+	_, _, reserved, err = s.Reruns().Reserve(rerun("def", 4), budgets)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	_, installationReruns, reserved, err = s.Reruns().Reserve(rerun("def", 5), budgets)
+	assert.NoError(t, err)
+	assert.False(t, reserved, "the budget of the installation is exhausted")
+	assert.Equal(t, 3, installationReruns)
+}
+
+func TestRerunLedger_Count(t *testing.T) {
+	now := time.Now()
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	records := []Record{
+		{Kind: KindRerun, Repository: "owner/repo", SHA: "abc", Installation: 1, RunID: 1, Time: now},
+		{Kind: KindRerun, Repository: "owner/repo", SHA: "abc", Installation: 1, RunID: 2, Time: now},
+		{Kind: KindOutcome, Repository: "owner/repo", SHA: "abc", Installation: 1, RunID: 2, Time: now},
+		{Kind: KindRerun, Repository: "owner/repo", SHA: "def", Installation: 1, RunID: 3, Time: now.Add(-48 * time.Hour)},
+		{Kind: KindRerun, Repository: "owner/other", SHA: "abc", Installation: 2, RunID: 4, Time: now},
+	}
+	for _, record := range records {
+		assert.NoError(t, s.Add(record))
+	}
+
+	assert.Equal(t, 2, s.Reruns().CommitReruns("owner/repo", "abc"))
+	assert.Equal(t, 1, s.Reruns().CommitReruns("owner/repo", "def"))
+	assert.Equal(t, 0, s.Reruns().CommitReruns("owner/repo", "ghi"))
+	assert.Equal(t, 2, s.Reruns().InstallationReruns(1, now.Add(-time.Hour)))
+	assert.Equal(t, 3, s.Reruns().InstallationReruns(1, now.Add(-72*time.Hour)))
+	assert.Equal(t, 1, s.Reruns().InstallationReruns(2, now.Add(-time.Hour)))
+}
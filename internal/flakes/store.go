@@ -0,0 +1,338 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+// Package flakes records the failures, reruns and outcomes of the workflow runs Ariane handles, and
+// aggregates them into flake rates per workflow and job.
+package flakes
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cilium/ariane/internal/atomicfile"
+)
+
+// Retention is how long records are kept, older records are dropped when the store is opened and
+// periodically while it is in use. Quarantine decisions are kept regardless of their age, as they remain
+// in effect until reverted.
+const Retention = 90 * 24 * time.Hour
+
+// pruneInterval is how often expired records are dropped from memory while the store is in use
+const pruneInterval = time.Hour
+
+// Kinds of records. The kinds accounting reruns and exhausted retries are declared along with their
+// trackers, in reruns.go and exhausted.go.
+const (
+	// KindFailure records a job which failed during an attempt of a run
+	KindFailure = "failure"
+	// KindOutcome records the conclusion of an attempt of a run
+	KindOutcome = "outcome"
+	// KindQuarantine records that a workflow was quarantined
+	KindQuarantine = "quarantine"
+	// KindRelease records that a workflow was un-quarantined
+	KindRelease = "release"
+)
+
+// Record is an event in the history of a workflow run
+type Record struct {
+	Time       time.Time `json:"time"`
+	Kind       string    `json:"kind"`
+	Repository string    `json:"repository"`
+	Workflow   string    `json:"workflow"`
+	Job        string    `json:"job,omitempty"`
+	SHA        string    `json:"sha,omitempty"`
+	PR         int       `json:"pr,omitempty"`
+	RunID      int64     `json:"run_id"`
+	Attempt    int       `json:"attempt"`
+	Conclusion string    `json:"conclusion,omitempty"`
+	// Installation is the GitHub App installation which reran the run, to account for its rerun budget
+	Installation int64 `json:"installation,omitempty"`
+	// Actor and Reason explain quarantine decisions
+	Actor  string `json:"actor,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// isDecision returns whether r is a quarantine decision rather than an event of a run
+func (r Record) isDecision() bool {
+	return r.Kind == KindQuarantine || r.Kind == KindRelease
+}
+
+// Store keeps records in memory, and appends them to a JSON lines file if it was opened with a path
+type Store struct {
+	mu      sync.Mutex
+	file    *os.File
+	records []Record
+	// pruned is when expired records were last dropped from memory
+	pruned time.Time
+}
+
+// Open loads the records stored at path, dropping the ones older than Retention, and returns a store
+// appending new records to it. If path is empty, records are only kept in memory.
+func Open(path string) (*Store, error) {
+	s := &Store{pruned: time.Now()}
+	if path == "" {
+		return s, nil
+	}
+
+	cutoff := time.Now().Add(-Retention)
+	f, err := os.Open(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed opening flakes store: %w", err)
+	default:
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var record Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				// skip a record truncated by a crash
+				continue
+			}
+			if record.Time.After(cutoff) || record.isDecision() {
+				s.records = append(s.records, record)
+			}
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed reading flakes store: %w", err)
+		}
+	}
+
+	// rewrite the store without the expired records, then append to it
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	for _, record := range s.records {
+		if err := encoder.Encode(record); err != nil {
+			return nil, fmt.Errorf("failed compacting flakes store: %w", err)
+		}
+	}
+	if err := atomicfile.Write(path, data.Bytes()); err != nil {
+		return nil, fmt.Errorf("failed compacting flakes store: %w", err)
+	}
+
+	s.file, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed opening flakes store: %w", err)
+	}
+	return s, nil
+}
+
+// Add records r, setting its time if unset
+func (s *Store) Add(r Record) error {
+	if r.Time.IsZero() {
+		r.Time = time.Now()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(r)
+}
+
+// add records r. The store must be locked.
+func (s *Store) add(r Record) error {
+	if now := time.Now(); now.Sub(s.pruned) >= pruneInterval {
+		s.prune(now)
+	}
+	s.records = append(s.records, r)
+	if s.file == nil {
+		return nil
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// prune drops the records older than Retention from memory, except quarantine decisions. They are
+// dropped from the file when the store is opened again.
+func (s *Store) prune(now time.Time) {
+	cutoff := now.Add(-Retention)
+	s.records = slices.DeleteFunc(s.records, func(record Record) bool {
+		return !record.Time.After(cutoff) && !record.isDecision()
+	})
+	s.pruned = now
+}
+
+// Close closes the file of the store
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// Rate is the flakiness of a workflow, or of a job of a workflow when Job is set, over a period
+type Rate struct {
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	Job        string `json:"job,omitempty"`
+	// Runs is the number of runs of the workflow
+	Runs int `json:"runs"`
+	// Failures is the number of runs which ultimately failed (for a job: during which the job failed)
+	Failures int `json:"failures"`
+	// Flaky is the number of runs which failed at first but ultimately succeeded (for a job: during
+	// which the job failed)
+	Flaky int `json:"flaky"`
+	// Reruns is the number of times failed jobs of the workflow were rerun
+	Reruns int `json:"reruns,omitempty"`
+	// FlakeRate is the ratio of flaky runs
+	FlakeRate float64 `json:"flake_rate"`
+}
+
+// runHistory is what is known of a workflow run
+type runHistory struct {
+	repository   string
+	workflow     string
+	finalAttempt int
+	conclusion   string
+	failed       bool
+	failedJobs   map[string]bool
+	reruns       int
+}
+
+// Rates returns the flake rates of the workflows and jobs of repository (or of all repositories if
+// empty) over the runs started since the given time, most flaky first
+func (s *Store) Rates(repository string, since time.Time) []Rate {
+	s.mu.Lock()
+	runs := make(map[string]map[int64]*runHistory)
+	for _, record := range s.records {
+		if record.isDecision() || record.Time.Before(since) || (repository != "" && record.Repository != repository) {
+			continue
+		}
+		if runs[record.Repository] == nil {
+			runs[record.Repository] = make(map[int64]*runHistory)
+		}
+		run := runs[record.Repository][record.RunID]
+		if run == nil {
+			run = &runHistory{repository: record.Repository, workflow: record.Workflow, failedJobs: make(map[string]bool)}
+			runs[record.Repository][record.RunID] = run
+		}
+		switch record.Kind {
+		case KindFailure:
+			run.failed = true
+			run.failedJobs[record.Job] = true
+		case KindRerun:
+			run.reruns++
+		case KindCancelledRerun:
+			run.reruns--
+		case KindOutcome:
+			if record.Conclusion != "success" {
+				run.failed = true
+			}
+			if record.Attempt >= run.finalAttempt {
+				run.finalAttempt = record.Attempt
+				run.conclusion = record.Conclusion
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	type key struct{ repository, workflow, job string }
+	rates := make(map[key]*Rate)
+	rate := func(k key) *Rate {
+		if rates[k] == nil {
+			rates[k] = &Rate{Repository: k.repository, Workflow: k.workflow, Job: k.job}
+		}
+		return rates[k]
+	}
+	for _, repositoryRuns := range runs {
+		for _, run := range repositoryRuns {
+			if run.conclusion == "" {
+				// the run did not complete yet
+				continue
+			}
+			succeeded := run.conclusion == "success"
+			workflowRate := rate(key{run.repository, run.workflow, ""})
+			workflowRate.Runs++
+			workflowRate.Reruns += run.reruns
+			if !succeeded {
+				workflowRate.Failures++
+			} else if run.failed {
+				workflowRate.Flaky++
+			}
+			for job := range run.failedJobs {
+				jobRate := rate(key{run.repository, run.workflow, job})
+				if succeeded {
+					jobRate.Flaky++
+				} else {
+					jobRate.Failures++
+				}
+			}
+		}
+	}
+
+	result := make([]Rate, 0, len(rates))
+	for k, r := range rates {
+		r.Runs = rates[key{k.repository, k.workflow, ""}].Runs
+		r.FlakeRate = float64(r.Flaky) / float64(r.Runs)
+		result = append(result, *r)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		switch {
+		case a.FlakeRate != b.FlakeRate:
+			return a.FlakeRate > b.FlakeRate
+		case a.Flaky != b.Flaky:
+			return a.Flaky > b.Flaky
+		case a.Repository != b.Repository:
+			return a.Repository < b.Repository
+		case a.Workflow != b.Workflow:
+			return a.Workflow < b.Workflow
+		default:
+			return a.Job < b.Job
+		}
+	})
+	return result
+}
+
+// Decision returns the latest quarantine decision about workflow in repository, and whether there is one
+func (s *Store) Decision(repository, workflow string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.records) - 1; i >= 0; i-- {
+		record := s.records[i]
+		if record.isDecision() && record.Repository == repository && record.Workflow == workflow {
+			return record, true
+		}
+	}
+	return Record{}, false
+}
+
+// Quarantined returns the quarantine decisions of the workflows of repository which are currently
+// quarantined, sorted by workflow
+func (s *Store) Quarantined(repository string) []Record {
+	s.mu.Lock()
+	latest := make(map[string]Record)
+	for _, record := range s.records {
+		if record.isDecision() && record.Repository == repository {
+			latest[record.Workflow] = record
+		}
+	}
+	s.mu.Unlock()
+
+	var quarantined []Record
+	for _, record := range latest {
+		if record.Kind == KindQuarantine {
+			quarantined = append(quarantined, record)
+		}
+	}
+	sort.Slice(quarantined, func(i, j int) bool { return quarantined[i].Workflow < quarantined[j].Workflow })
+	return quarantined
+}
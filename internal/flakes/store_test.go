@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package flakes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func addRecords(t *testing.T, s *Store, now time.Time) {
+	records := []Record{
+		// run 1 failed, then succeeded once rerun: flaky
+		{Kind: KindFailure, Workflow: "e2e", Job: "test (1)", RunID: 1, Attempt: 1},
+		{Kind: KindOutcome, Workflow: "e2e", RunID: 1, Attempt: 1, Conclusion: "failure"},
+		{Kind: KindRerun, Workflow: "e2e", RunID: 1, Attempt: 1},
+		{Kind: KindOutcome, Workflow: "e2e", RunID: 1, Attempt: 2, Conclusion: "success"},
+		// run 2 failed for good
+		{Kind: KindFailure, Workflow: "e2e", Job: "test (2)", RunID: 2, Attempt: 1},
+		{Kind: KindOutcome, Workflow: "e2e", RunID: 2, Attempt: 1, Conclusion: "failure"},
+		// runs 3 and 4 succeeded
+		{Kind: KindOutcome, Workflow: "e2e", RunID: 3, Attempt: 1, Conclusion: "success"},
+		{Kind: KindOutcome, Workflow: "lint", RunID: 4, Attempt: 1, Conclusion: "success"},
+		// run 5 is still being rerun
+		{Kind: KindFailure, Workflow: "lint", Job: "lint", RunID: 5, Attempt: 1},
+		{Kind: KindRerun, Workflow: "lint", RunID: 5, Attempt: 1},
+	}
+	for _, record := range records {
+		record.Repository = "owner/repo"
+		record.Time = now
+		assert.NoError(t, s.Add(record))
+	}
+	assert.NoError(t, s.Add(Record{Kind: KindOutcome, Repository: "owner/other", Workflow: "e2e", RunID: 1, Attempt: 1, Conclusion: "success", Time: now}))
+	assert.NoError(t, s.Add(Record{Kind: KindOutcome, Repository: "owner/repo", Workflow: "old", RunID: 6, Attempt: 1, Conclusion: "success", Time: now.Add(-48 * time.Hour)}))
+}
+
+func TestStore_Rates(t *testing.T) {
+	now := time.Now()
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	addRecords(t, s, now)
+
+	rates := s.Rates("owner/repo", now.Add(-time.Hour))
+	assert.Equal(t, []Rate{
+		{Repository: "owner/repo", Workflow: "e2e", Runs: 3, Failures: 1, Flaky: 1, Reruns: 1, FlakeRate: 1.0 / 3},
+		{Repository: "owner/repo", Workflow: "e2e", Job: "test (1)", Runs: 3, Flaky: 1, FlakeRate: 1.0 / 3},
+		{Repository: "owner/repo", Workflow: "e2e", Job: "test (2)", Runs: 3, Failures: 1},
+		{Repository: "owner/repo", Workflow: "lint", Runs: 1},
+	}, rates)
+
+	assert.Len(t, s.Rates("", now.Add(-time.Hour)), 5)
+	assert.Len(t, s.Rates("owner/repo", now.Add(-72*time.Hour)), 5)
+}
+
+func TestStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flakes.jsonl")
+	now := time.Now()
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	addRecords(t, s, now)
+	assert.NoError(t, s.Add(Record{Kind: KindOutcome, Repository: "owner/repo", Workflow: "expired", RunID: 7, Attempt: 1, Conclusion: "success", Time: now.Add(-Retention - time.Hour)}))
+	expected := s.Rates("", now.Add(-Retention))
+	assert.NoError(t, s.Close())
+
+	// simulate a record truncated by a crash
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatalf("Failed to open flakes store file: %v", err)
+	}
+	_, err = f.WriteString(`{"kind":"outc`)
+	if err != nil {
+		t.Fatalf("Failed to write flakes store file: %v", err)
+	}
+	assert.NoError(t, f.Close())
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	defer s.Close()
+	assert.Equal(t, expected, s.Rates("", now.Add(-Retention)))
+	assert.Len(t, s.records, 12)
+}
+
+func TestStore_Prune(t *testing.T) {
+	now := time.Now()
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	assert.NoError(t, s.Add(Record{Kind: KindOutcome, Repository: "owner/repo", Workflow: "expired", RunID: 1, Attempt: 1, Conclusion: "success", Time: now.Add(-Retention - time.Hour)}))
+	assert.NoError(t, s.Add(Record{Kind: KindQuarantine, Repository: "owner/repo", Workflow: "expired", Time: now.Add(-Retention - time.Hour)}))
+	assert.Len(t, s.records, 2, "records are not pruned more than once per interval")
+
+	s.pruned = now.Add(-pruneInterval)
+	assert.NoError(t, s.Add(Record{Kind: KindOutcome, Repository: "owner/repo", Workflow: "e2e", RunID: 2, Attempt: 1, Conclusion: "success"}))
+	assert.Len(t, s.records, 2, "expired records are pruned, except quarantine decisions")
+	assert.Equal(t, KindQuarantine, s.records[0].Kind)
+}
+
+func TestStore_Handler(t *testing.T) {
+	now := time.Now()
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	addRecords(t, s, now)
+
+	testCases := []struct {
+		name           string
+		token          string
+		authorization  string
+		query          string
+		expectedStatus int
+		expectedRates  int
+	}{
+		{name: "all repositories", token: "secret", authorization: "Bearer secret", expectedStatus: http.StatusOK, expectedRates: 6},
+		{name: "repository", token: "secret", authorization: "Bearer secret", query: "?repository=owner/other", expectedStatus: http.StatusOK, expectedRates: 1},
+		{name: "period", token: "secret", authorization: "Bearer secret", query: "?repository=owner/repo&period=1h", expectedStatus: http.StatusOK, expectedRates: 4},
+		{name: "invalid period", token: "secret", authorization: "Bearer secret", query: "?period=soon", expectedStatus: http.StatusBadRequest},
+		{name: "missing token", token: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", token: "secret", authorization: "Bearer secrets", expectedStatus: http.StatusUnauthorized},
+		{name: "token not sent as bearer", token: "secret", authorization: "secret", expectedStatus: http.StatusUnauthorized},
+		{name: "no token configured", authorization: "Bearer ", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/flakes"+tc.query, nil)
+			if tc.authorization != "" {
+				request.Header.Set("Authorization", tc.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			s.Handler(tc.token).ServeHTTP(recorder, request)
+			assert.Equal(t, tc.expectedStatus, recorder.Code)
+			if tc.expectedStatus != http.StatusOK {
+				assert.NotContains(t, recorder.Body.String(), "e2e", "flake rates are only served to authorized requests")
+				return
+			}
+			var rates []Rate
+			assert.NoError(t, json.NewDecoder(recorder.Body).Decode(&rates))
+			assert.Len(t, rates, tc.expectedRates)
+		})
+	}
+}
+
+func TestParsePeriod(t *testing.T) {
+	period, err := ParsePeriod("7d")
+	assert.NoError(t, err)
+	assert.Equal(t, 7*24*time.Hour, period)
+
+	period, err = ParsePeriod("36h")
+	assert.NoError(t, err)
+	assert.Equal(t, 36*time.Hour, period)
+
+	for _, invalid := range []string{"", "0d", "-1h", "d", "week"} {
+		_, err = ParsePeriod(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestStore_Quarantine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "flakes.jsonl")
+	old := time.Now().Add(-Retention - time.Hour)
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	assert.NoError(t, s.Add(Record{Kind: KindQuarantine, Repository: "owner/repo", Workflow: "e2e", Time: old}))
+	assert.NoError(t, s.Add(Record{Kind: KindQuarantine, Repository: "owner/repo", Workflow: "lint", Time: old}))
+	assert.NoError(t, s.Add(Record{Kind: KindRelease, Repository: "owner/repo", Workflow: "lint", Actor: "maintainer"}))
+	assert.NoError(t, s.Add(Record{Kind: KindQuarantine, Repository: "owner/other", Workflow: "unit"}))
+	assert.NoError(t, s.Close())
+
+	// quarantine decisions outlive the retention period
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	defer s.Close()
+
+	decision, ok := s.Decision("owner/repo", "lint")
+	assert.True(t, ok)
+	assert.Equal(t, KindRelease, decision.Kind)
+	assert.Equal(t, "maintainer", decision.Actor)
+
+	_, ok = s.Decision("owner/repo", "unit")
+	assert.False(t, ok)
+
+	quarantined := s.Quarantined("owner/repo")
+	if assert.Len(t, quarantined, 1) {
+		assert.Equal(t, "e2e", quarantined[0].Workflow)
+	}
+	assert.Empty(t, s.Rates("", old))
+}
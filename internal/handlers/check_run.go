@@ -0,0 +1,145 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// arianeCheckRunName is the name of the check run Ariane uses to record the commands it received
+	arianeCheckRunName = "Ariane"
+	// commandLogExternalID identifies the check run holding the command log among check runs named arianeCheckRunName
+	commandLogExternalID = "ariane-command-log"
+	// commandLogLimit is the maximum number of commands listed in the command log
+	commandLogLimit  = 50
+	commandLogIntro  = "Commands received by Ariane for this commit, most recent last.\n\n"
+	commandLogHeader = "| Time | Command | Sender | Source | Outcome | Details |\n|------|---------|--------|--------|---------|---------|\n"
+)
+
+type commandOutcome string
+
+const (
+	commandAccepted commandOutcome = "accepted"
+	commandRejected commandOutcome = "rejected"
+	commandSkipped  commandOutcome = "skipped"
+	commandFailed   commandOutcome = "failed"
+)
+
+// commandLogEntry describes a command received by Ariane and what happened to it
+type commandLogEntry struct {
+	time    time.Time
+	command string
+	sender  string
+	source  string
+	outcome commandOutcome
+	details string
+}
+
+func getOutcomeEmoji(outcome commandOutcome) string {
+	switch outcome {
+	case commandAccepted:
+		return "✅ Accepted"
+	case commandRejected:
+		return "⛔ Rejected"
+	case commandSkipped:
+		return "⏭️ Skipped"
+	case commandFailed:
+		return "❌ Failed"
+	default:
+		return string(outcome)
+	}
+}
+
+// escapeTableCell makes s safe to use within a markdown table cell
+func escapeTableCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// appendCommandLog adds entry to the command log table found in text, keeping at most commandLogLimit commands
+func appendCommandLog(text string, entry commandLogEntry) string {
+	if i := strings.Index(text, commandLogHeader); i >= 0 {
+		text = text[i+len(commandLogHeader):]
+	}
+	var rows []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "| ") {
+			rows = append(rows, line)
+		}
+	}
+	command := "`" + strings.ReplaceAll(escapeTableCell(entry.command), "`", "'") + "`"
+	rows = append(rows, fmt.Sprintf("| %s | %s | @%s | %s | %s | %s |",
+		entry.time.UTC().Format(time.RFC3339), command, entry.sender, entry.source, getOutcomeEmoji(entry.outcome), escapeTableCell(entry.details)))
+	if len(rows) > commandLogLimit {
+		rows = rows[len(rows)-commandLogLimit:]
+	}
+	return commandLogHeader + strings.Join(rows, "\n") + "\n"
+}
+
+// getArianeCheckRun returns the check run of the given SHA with the given name and external ID, or
+// nil if it does not exist yet
+func getArianeCheckRun(ctx context.Context, client *github.Client, owner, repo, sha, name, externalID string) (*github.CheckRun, error) {
+	opts := &github.ListCheckRunsOptions{CheckName: github.Ptr(name), Filter: github.Ptr("all")}
+	checks, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, check := range checks.CheckRuns {
+		if check.GetExternalID() == externalID {
+			return check, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordCommand adds entry to the command log held in the summary of the Ariane check run of the given
+// SHA. The check run always concludes as neutral, so that it never blocks a pull request. Commands
+// recorded concurrently for the same SHA are recorded one at a time, so that none is lost.
+func recordCommand(ctx context.Context, client *github.Client, owner, repo, sha string, entry commandLogEntry, logger zerolog.Logger) error {
+	defer lockFeedback(fmt.Sprintf("%s/%s@%s", owner, repo, sha))()
+
+	checkRun, err := getArianeCheckRun(ctx, client, owner, repo, sha, arianeCheckRunName, commandLogExternalID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to retrieve %s check run for sha=%s", arianeCheckRunName, sha)
+		return err
+	}
+
+	output := &github.CheckRunOutput{
+		Title:   github.Ptr(fmt.Sprintf("Command %s by @%s was %s", entry.command, entry.sender, entry.outcome)),
+		Summary: github.Ptr(commandLogIntro + appendCommandLog(checkRun.GetOutput().GetSummary(), entry)),
+	}
+
+	if checkRun == nil {
+		_, _, err = client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+			Name:        arianeCheckRunName,
+			HeadSHA:     sha,
+			ExternalID:  github.Ptr(commandLogExternalID),
+			Status:      github.Ptr("completed"),
+			Conclusion:  github.Ptr("neutral"),
+			CompletedAt: &github.Timestamp{Time: entry.time},
+			Output:      output,
+		})
+	} else {
+		_, _, err = client.Checks.UpdateCheckRun(ctx, owner, repo, checkRun.GetID(), github.UpdateCheckRunOptions{
+			Name:        arianeCheckRunName,
+			ExternalID:  github.Ptr(commandLogExternalID),
+			Status:      github.Ptr("completed"),
+			Conclusion:  github.Ptr("neutral"),
+			CompletedAt: &github.Timestamp{Time: entry.time},
+			Output:      output,
+		})
+	}
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to record command in %s check run for sha=%s", arianeCheckRunName, sha)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func Test_appendCommandLog(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	text := appendCommandLog("", commandLogEntry{
+		time:    now,
+		command: "/test",
+		sender:  "user",
+		source:  "Issue comment",
+		outcome: commandAccepted,
+		details: "workflows: foo.yaml",
+	})
+	assert.Equal(t, commandLogHeader+"| 2024-01-02T03:04:05Z | `/test` | @user | Issue comment | ✅ Accepted | workflows: foo.yaml |\n", text)
+
+	text = appendCommandLog(text, commandLogEntry{
+		time:    now,
+		command: "/test | grep",
+		sender:  "other",
+		source:  "Pull request review",
+		outcome: commandRejected,
+		details: "other is not a member of an allowed team",
+	})
+	assert.Contains(t, text, "| `/test \\| grep` | @other | Pull request review | ⛔ Rejected | other is not a member of an allowed team |")
+	assert.Equal(t, 2, strings.Count(text, "\n| 2024"))
+
+	for i := 0; i < commandLogLimit; i++ {
+		text = appendCommandLog(text, commandLogEntry{time: now, command: fmt.Sprintf("/test-%d", i), sender: "user", outcome: commandSkipped})
+	}
+	assert.NotContains(t, text, "@other")
+	assert.Equal(t, commandLogLimit, strings.Count(text, "\n| 2024"))
+}
+
+func Test_recordCommand(t *testing.T) {
+	testCases := []struct {
+		name           string
+		existing       []*github.CheckRun
+		expectedMethod string
+		expectedRows   int
+	}{
+		{
+			name:           "creates the check run",
+			existing:       []*github.CheckRun{},
+			expectedMethod: http.MethodPost,
+			expectedRows:   1,
+		},
+		{
+			name: "ignores check runs not holding the command log",
+			existing: []*github.CheckRun{
+				{ID: github.Ptr(int64(7)), Name: github.Ptr(arianeCheckRunName)},
+			},
+			expectedMethod: http.MethodPost,
+			expectedRows:   1,
+		},
+		{
+			name: "updates the existing check run",
+			existing: []*github.CheckRun{
+				{ID: github.Ptr(int64(8)), Name: github.Ptr(arianeCheckRunName), ExternalID: github.Ptr(commandLogExternalID), Output: &github.CheckRunOutput{
+					Summary: github.Ptr(commandLogIntro + commandLogHeader + "| 2024-01-02T03:04:05Z | `/lint` | @user | Issue comment | ✅ Accepted | |\n"),
+				}},
+			},
+			expectedMethod: http.MethodPatch,
+			expectedRows:   2,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var method string
+			var output github.CheckRunOutput
+			var conclusion string
+			mux := http.NewServeMux()
+			mux.HandleFunc("/repos/owner/repo/commits/sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, arianeCheckRunName, r.FormValue("check_name"))
+				_ = json.NewEncoder(w).Encode(github.ListCheckRunsResults{Total: github.Ptr(len(tc.existing)), CheckRuns: tc.existing})
+			})
+			saveCheckRun := func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+				var body struct {
+					Conclusion string                `json:"conclusion"`
+					Output     github.CheckRunOutput `json:"output"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&body)
+				conclusion = body.Conclusion
+				output = body.Output
+				_ = json.NewEncoder(w).Encode(github.CheckRun{ID: github.Ptr(int64(8))})
+			}
+			mux.HandleFunc("POST /repos/owner/repo/check-runs", saveCheckRun)
+			mux.HandleFunc("PATCH /repos/owner/repo/check-runs/8", saveCheckRun)
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			entry := commandLogEntry{time: time.Now(), command: "/test", sender: "user", outcome: commandRejected, details: "not allowed"}
+			err = recordCommand(context.Background(), client, "owner", "repo", "sha", entry, zerolog.Nop())
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMethod, method)
+			assert.Equal(t, "neutral", conclusion)
+			assert.Equal(t, "Command /test by @user was rejected", output.GetTitle())
+			assert.Empty(t, output.GetText())
+			assert.Contains(t, output.GetSummary(), "⛔ Rejected | not allowed |")
+			assert.Equal(t, tc.expectedRows, strings.Count(output.GetSummary(), "\n| 20"))
+		})
+	}
+}
+
+func TestHandle_RejectionRecordedInCheckRun(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+	configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		return &config.ArianeConfig{
+			Feedback:     config.FeedbackConfig{CheckRun: github.Ptr(true)},
+			AllowedTeams: []string{"organization-members"},
+			Triggers: map[string]config.TriggerConfig{
+				"/test": {Workflows: []string{"foo.yaml"}},
+			},
+		}, nil
+	}
+
+	var outputs []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls/0", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.PullRequest{
+			State: github.Ptr("open"),
+			Head:  &github.PullRequestBranch{SHA: github.Ptr("abc123"), Ref: github.Ptr("feature-branch")},
+		})
+	})
+	mux.HandleFunc("/orgs/owner/teams/organization-members/memberships/{author}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("/repos/owner/repo/commits/abc123/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.ListCheckRunsResults{Total: github.Ptr(0)})
+	})
+	mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		var body github.CreateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		assert.Equal(t, arianeCheckRunName, body.Name)
+		assert.Equal(t, "abc123", body.HeadSHA)
+		outputs = append(outputs, body.Output.GetSummary())
+		_ = json.NewEncoder(w).Encode(github.CheckRun{ID: github.Ptr(int64(1))})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
+
+	handler := &PRCommentHandler{
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
+	}
+
+	payload := []byte(`{
+		"issue": {
+			"pull_request": {},
+			"number": 0
+		},
+		"action": "created",
+		"comment": {
+			"id": 1,
+			"body": "/test",
+			"user": {
+				"login": "stranger"
+			}
+		},
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "issue_comment", "deliveryID", payload)
+	assert.NoError(t, err)
+	if assert.Len(t, outputs, 1) {
+		assert.Contains(t, outputs[0], "| `/test` | @stranger | Issue comment | ⛔ Rejected | stranger is not a member of an allowed team |")
+	}
+}
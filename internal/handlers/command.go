@@ -0,0 +1,279 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+	"github.com/cilium/ariane/internal/scheduler"
+)
+
+// commandRequest describes trigger commands sent by a user on a pull request, through an issue
+// comment, a pull request review or a pull request review comment
+type commandRequest struct {
+	// source describes where the commands come from, e.g. "Issue comment"
+	source   string
+	owner    string
+	repo     string
+	prNumber int
+	// author is who issued the commands, whose permissions are checked
+	author string
+	// target is the object reactions are added to, in order to report on the commands' progress
+	target reactionTarget
+	// replacePriorReactions is set when the target may hold reactions from earlier events (e.g. an
+	// edited comment), to be replaced by the reaction reporting the state of the new commands
+	replacePriorReactions bool
+	// commands returns the commands to process according to the repository's Ariane configuration
+	commands func(arianeConfig *config.ArianeConfig) []string
+	// done, if set, is called once each command was handled, with the error handling it if any
+	done func(command string, err error)
+}
+
+// commandRunner validates command requests and triggers the workflows associated to their commands
+type commandRunner struct {
+	client           *github.Client
+	runDelay         time.Duration
+	maxRetryAttempts int
+	flakeStore       *flakes.Store
+	// scheduler runs the reruns of failed workflow runs caused by commands, if set
+	scheduler      *scheduler.Scheduler
+	installationID int64
+	// dispatchedRuns remembers the runs dispatched by commands, if set
+	dispatchedRuns *DispatchedRunTracker
+	// appID is the ID of the Ariane app, and botLogin the login of its bot user
+	appID    int64
+	botLogin string
+	logger   zerolog.Logger
+}
+
+func (r *commandRunner) run(ctx context.Context, req commandRequest) error {
+	logger := r.logger
+	commenter := NewGithubCommenter(r.client, req.owner, req.repo, r.botLogin, logger)
+
+	// only handle the comments of users, and of the bots of the repository owner
+	var botUser, unsupportedBot bool
+	if strings.HasSuffix(req.author, "[bot]") {
+		unsupportedBot = !strings.HasPrefix(req.author, req.owner)
+		botUser = !unsupportedBot
+	}
+
+	// Get PR metadata and validate PR author permissions
+	pr, err := getPullRequest(ctx, r.client, req.owner, req.repo, req.prNumber, logger, r.maxRetryAttempts)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve pull request")
+		defaultConfig := fallbackConfig(ctx, r.client, req.owner, req.repo, logger)
+		comment := feedbackMessage(defaultConfig, config.TemplatePullRequestFailed, config.FeedbackData{Author: req.author, Source: req.source, Reason: err.Error()}, logger)
+		_ = commenter.report(ctx, defaultConfig, req.prNumber, config.TemplatePullRequestFailed, req.source, comment)
+		return err
+	}
+
+	contextRef, headSHA, baseSHA := determineContextRef(pr, req.owner, req.repo, logger)
+
+	// retrieve Ariane configuration (triggers, etc.) from repository based on chosen context
+	arianeConfig, err := configGetArianeConfigFromRepository(r.client, ctx, req.owner, req.repo, contextRef)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve config file")
+		defaultConfig := fallbackConfig(ctx, r.client, req.owner, req.repo, logger)
+		comment := feedbackMessage(defaultConfig, config.TemplateConfigFailed, config.FeedbackData{Author: req.author, Source: req.source, Reason: err.Error()}, logger)
+		_ = commenter.report(ctx, defaultConfig, req.prNumber, config.TemplateConfigFailed, req.source, comment)
+		return err
+	}
+
+	commands := req.commands(arianeConfig)
+	if len(commands) == 0 {
+		logger.Debug().Msgf("%s does not contain any command to process", req.source)
+		return nil
+	}
+
+	if unsupportedBot {
+		for _, command := range commands {
+			r.record(ctx, arianeConfig, req, headSHA, command, commandRejected, fmt.Sprintf("%s is an unsupported bot", req.author))
+		}
+		logger.Debug().Msgf("%s was created by an unsupported bot: %s", req.source, req.author)
+		comment := feedbackMessage(arianeConfig, config.TemplateUnsupportedBot, config.FeedbackData{Author: req.author, Source: req.source, Commands: commands}, logger)
+		_ = commenter.report(ctx, arianeConfig, req.prNumber, config.TemplateUnsupportedBot, req.author, comment)
+		return nil
+	}
+
+	// only handle comments coming from an allowed organization, if specified
+	if !botUser && !isAllowedTeamMember(ctx, r.client, arianeConfig, req.owner, req.author, logger) {
+		// Rejections are recorded in the Ariane check run when enabled, as none of the emojis available
+		// for reactions is entirely fitting to communicate the rejection status clearly.
+		for _, command := range commands {
+			r.record(ctx, arianeConfig, req, headSHA, command, commandRejected, fmt.Sprintf("%s is not a member of an allowed team", req.author))
+		}
+		if arianeConfig.GetVerbose() {
+			comment := feedbackMessage(arianeConfig, config.TemplateNotAllowed, config.FeedbackData{Author: req.author, Commands: commands}, logger)
+			_ = commenter.report(ctx, arianeConfig, req.prNumber, config.TemplateNotAllowed, strings.Join(commands, ", "), comment)
+		}
+		return nil
+	}
+
+	processor := WorkflowProcessor{
+		client:       r.client,
+		owner:        req.owner,
+		repo:         req.repo,
+		arianeConfig: arianeConfig,
+		logger:       logger,
+		runDelay:     r.runDelay,
+		sender:       req.author,
+		baseRef:      pr.GetBase().GetRef(),
+
+		scheduler:      r.scheduler,
+		installationID: r.installationID,
+		appID:          r.appID,
+		dispatchedRuns: r.dispatchedRuns,
+		flakeStore:     r.flakeStore,
+	}
+
+	lifecycle := newReactionLifecycle(commenter, req.target, req.replacePriorReactions)
+
+	var errs error
+	for _, command := range commands {
+		err := r.handleCommand(ctx, &processor, commenter, lifecycle, req, command, contextRef, headSHA, baseSHA)
+		if req.done != nil {
+			req.done(command, err)
+		}
+		errs = errors.Join(errs, err)
+	}
+	return errs
+}
+
+// fallbackConfig returns the Ariane configuration of the default branch, to report feedback through the
+// configured channels when the configuration applying to a pull request is not available, or the
+// default configuration if it can't be retrieved either
+func fallbackConfig(ctx context.Context, client *github.Client, owner, repo string, logger zerolog.Logger) *config.ArianeConfig {
+	arianeConfig, err := configGetArianeConfigFromRepository(client, ctx, owner, repo, "")
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to retrieve the config of the default branch, reporting feedback through the default channels")
+		return &config.ArianeConfig{}
+	}
+	return arianeConfig
+}
+
+// handleCommand runs the workflows of the trigger matching command, reacting on the request's target to report progress
+func (r *commandRunner) handleCommand(ctx context.Context, processor *WorkflowProcessor, commenter *GithubCommenter, lifecycle *reactionLifecycle, req commandRequest, command, contextRef, headSHA, baseSHA string) error {
+	logger := processor.logger
+	arianeConfig := processor.arianeConfig
+
+	if ok, period, err := parseFlakesCommand(command); ok {
+		return r.reportFlakes(ctx, commenter, lifecycle, arianeConfig, req, command, headSHA, period, err)
+	}
+	if ok, workflow := parseUnquarantineCommand(command); ok {
+		return r.unquarantine(ctx, commenter, lifecycle, arianeConfig, req, command, headSHA, workflow)
+	}
+
+	// only handle comments matching a registered trigger, and retrieve associated list of workflows to trigger
+	submatch, workflowsToTrigger, dependsOn := arianeConfig.CheckForTrigger(ctx, command)
+	// the command on commentBody (e.g. /test-this) does not match any "triggers"
+	if submatch == nil {
+		r.record(ctx, arianeConfig, req, headSHA, command, commandRejected, "command does not match any trigger")
+		if arianeConfig.GetVerbose() {
+			comment := feedbackMessage(arianeConfig, config.TemplateCommandNotFound, config.FeedbackData{Author: req.author, Command: command}, logger)
+			_ = commenter.report(ctx, arianeConfig, req.prNumber, config.TemplateCommandNotFound, command, comment)
+		}
+		return nil
+	}
+
+	if err := lifecycle.transition(ctx, arianeConfig, reactionStateProcessing); err != nil {
+		return err
+	}
+
+	err := processor.processWorkflowsForTrigger(ctx, submatch, req.prNumber, contextRef, headSHA, baseSHA, workflowsToTrigger, dependsOn, commenter)
+	if err != nil {
+		var name, comment string
+		skippedError, ok := err.(TriggerSkippedDependencyInProgressError)
+		if ok {
+			logger.Debug().Err(skippedError).Msg(skippedError.Error())
+			name = config.TemplateTriggerSkipped
+			comment = feedbackMessage(arianeConfig, name, config.FeedbackData{Author: req.author, Command: command, Reason: skippedError.Error()}, logger)
+			r.record(ctx, arianeConfig, req, headSHA, command, commandSkipped, skippedError.Error())
+			commentErr := lifecycle.transition(ctx, arianeConfig, reactionStateDependencyInProgress)
+			if commentErr != nil {
+				logger.Error().Err(skippedError).Msg("Failed to react to comment with thumbs up emoji")
+			}
+		} else {
+			logger.Error().Err(err).Msg("Failed to process workflows for trigger")
+			name = config.TemplateTriggerFailed
+			comment = feedbackMessage(arianeConfig, name, config.FeedbackData{Author: req.author, Command: command, Reason: err.Error()}, logger)
+			r.record(ctx, arianeConfig, req, headSHA, command, commandFailed, err.Error())
+			commentErr := lifecycle.transition(ctx, arianeConfig, reactionStateFailed)
+			if commentErr != nil {
+				logger.Error().Err(err).Msg("Failed to react to comment with confused emoji")
+			}
+		}
+		if arianeConfig.GetVerbose() {
+			_ = commenter.report(ctx, arianeConfig, req.prNumber, name, command, comment)
+		}
+		return err
+	}
+
+	r.record(ctx, arianeConfig, req, headSHA, command, commandAccepted, fmt.Sprintf("workflows: %s", strings.Join(workflowsToTrigger, ", ")))
+
+	if err := lifecycle.transition(ctx, arianeConfig, reactionStateTriggered); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// record adds the outcome of command to the Ariane check run of headSHA, if enabled
+func (r *commandRunner) record(ctx context.Context, arianeConfig *config.ArianeConfig, req commandRequest, headSHA, command string, outcome commandOutcome, details string) {
+	if !arianeConfig.GetCheckRun() {
+		return
+	}
+	entry := commandLogEntry{
+		time:    time.Now(),
+		command: command,
+		sender:  req.author,
+		source:  req.source,
+		outcome: outcome,
+		details: details,
+	}
+	_ = recordCommand(ctx, r.client, req.owner, req.repo, headSHA, entry, r.logger)
+}
+
+// commentCommands returns the commands found in a comment body, i.e. the lines starting with /
+// (with optional leading whitespace)
+func commentCommands(body string) []string {
+	var commands []string
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "/") {
+			commands = append(commands, line)
+		}
+	}
+	return commands
+}
+
+// commandAuthor returns who issued the commands of a comment: its author when it is created, and the
+// sender of the event when it is edited, as anyone allowed to edit the comment may introduce commands
+func commandAuthor(action string, author, sender *github.User) string {
+	if action == "edited" {
+		return sender.GetLogin()
+	}
+	return author.GetLogin()
+}
+
+// newCommands returns the commands of an edited comment which were not already present before the edit
+func newCommands(oldBody, newBody string) []string {
+	oldCommands := commentCommands(oldBody)
+	var commands []string
+	for _, command := range commentCommands(newBody) {
+		if !slices.Contains(oldCommands, command) && !slices.Contains(commands, command) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
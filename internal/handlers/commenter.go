@@ -8,24 +8,51 @@ import (
 
 	"github.com/google/go-github/v88/github"
 	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
 )
 
+// reactionTargetKind is the kind of GitHub object Ariane reacts on
+type reactionTargetKind int
+
+const (
+	reactionTargetIssueComment reactionTargetKind = iota
+	reactionTargetReviewComment
+	reactionTargetPullRequest
+)
+
+// reactionTarget identifies the GitHub object Ariane reacts on to give feedback on a command. id is
+// the comment ID for comments, and the pull request number for pull requests.
+type reactionTarget struct {
+	kind reactionTargetKind
+	id   int64
+}
+
 type GithubCommenter struct {
 	client *github.Client
 	owner  string
 	repo   string
-	logger zerolog.Logger
+	// botLogin is the login of the bot user of the Ariane app, authoring its comments: only its comments
+	// are edited or minimized, whatever other comments contain
+	botLogin string
+	logger   zerolog.Logger
 }
 
-func NewGithubCommenter(client *github.Client, owner, repo string, logger zerolog.Logger) *GithubCommenter {
+func NewGithubCommenter(client *github.Client, owner, repo, botLogin string, logger zerolog.Logger) *GithubCommenter {
 	return &GithubCommenter{
-		client: client,
-		owner:  owner,
-		repo:   repo,
-		logger: logger,
+		client:   client,
+		owner:    owner,
+		repo:     repo,
+		botLogin: botLogin,
+		logger:   logger,
 	}
 }
 
+// ownComment returns whether comment was posted by Ariane
+func (c *GithubCommenter) ownComment(comment *github.IssueComment) bool {
+	return c.botLogin != "" && comment.GetUser().GetLogin() == c.botLogin
+}
+
 func (c *GithubCommenter) commentOnPullRequest(ctx context.Context, prNumber int, replyBody string) error {
 	comment := &github.IssueComment{
 		Body: github.Ptr(replyBody),
@@ -38,24 +65,114 @@ func (c *GithubCommenter) commentOnPullRequest(ctx context.Context, prNumber int
 	return nil
 }
 
-func (c *GithubCommenter) reactToComment(ctx context.Context, commentID int64, emoji string) error {
+// report posts body on the pull request, through the channel configured for messages of the given
+// type. section identifies the feedback replaced by body (usually the trigger phrase it relates to) in
+// channels keeping a single message.
+func (c *GithubCommenter) report(ctx context.Context, arianeConfig *config.ArianeConfig, prNumber int, name, section, body string) error {
+	channel := c.channel(arianeConfig.GetFeedbackChannel(name), arianeConfig.GetMinimizeOutdated())
+	return channel.post(ctx, prNumber, section, body)
+}
+
+// feedbackMessage renders the feedback message of the given type with the repository's template,
+// falling back to the default message if the template is invalid
+func feedbackMessage(arianeConfig *config.ArianeConfig, name string, data config.FeedbackData, logger zerolog.Logger) string {
+	message, err := arianeConfig.RenderFeedback(name, data)
+	if err != nil {
+		logger.Warn().Err(err).Msg("Falling back to the default feedback message")
+	}
+	return message
+}
+
+func (c *GithubCommenter) reactToComment(ctx context.Context, commentID int64, emoji string) (*github.Reaction, error) {
 	if emoji == "" {
 		emoji = "rocket"
 	}
-	if _, _, err := c.client.Reactions.CreateIssueCommentReaction(ctx, c.owner, c.repo, commentID, emoji); err != nil {
+	reaction, _, err := c.client.Reactions.CreateIssueCommentReaction(ctx, c.owner, c.repo, commentID, emoji)
+	if err != nil {
 		c.logger.Error().Err(err).Msgf("Failed to react to comment with %s emoji", emoji)
-		return err
+		return nil, err
 	}
-	return nil
+	return reaction, nil
 }
 
-func (c *GithubCommenter) reactToPR(ctx context.Context, prNumber int, emoji string) error {
+func (c *GithubCommenter) reactToPR(ctx context.Context, prNumber int, emoji string) (*github.Reaction, error) {
 	if emoji == "" {
 		emoji = "rocket"
 	}
-	if _, _, err := c.client.Reactions.CreateIssueReaction(ctx, c.owner, c.repo, prNumber, emoji); err != nil {
+	reaction, _, err := c.client.Reactions.CreateIssueReaction(ctx, c.owner, c.repo, prNumber, emoji)
+	if err != nil {
 		c.logger.Error().Err(err).Msgf("Failed to react to issue with %s emoji", emoji)
-		return err
+		return nil, err
 	}
-	return nil
+	return reaction, nil
+}
+
+func (c *GithubCommenter) reactToReviewComment(ctx context.Context, commentID int64, emoji string) (*github.Reaction, error) {
+	if emoji == "" {
+		emoji = "rocket"
+	}
+	reaction, _, err := c.client.Reactions.CreatePullRequestCommentReaction(ctx, c.owner, c.repo, commentID, emoji)
+	if err != nil {
+		c.logger.Error().Err(err).Msgf("Failed to react to review comment with %s emoji", emoji)
+		return nil, err
+	}
+	return reaction, nil
+}
+
+// react adds the emoji reaction to the given target
+func (c *GithubCommenter) react(ctx context.Context, target reactionTarget, emoji string) (*github.Reaction, error) {
+	switch target.kind {
+	case reactionTargetReviewComment:
+		return c.reactToReviewComment(ctx, target.id, emoji)
+	case reactionTargetPullRequest:
+		return c.reactToPR(ctx, int(target.id), emoji)
+	default:
+		return c.reactToComment(ctx, target.id, emoji)
+	}
+}
+
+// listReactions returns the reactions of the given target
+func (c *GithubCommenter) listReactions(ctx context.Context, target reactionTarget) ([]*github.Reaction, error) {
+	var reactions []*github.Reaction
+	opts := &github.ListReactionOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		var page []*github.Reaction
+		var response *github.Response
+		var err error
+		switch target.kind {
+		case reactionTargetReviewComment:
+			page, response, err = c.client.Reactions.ListPullRequestCommentReactions(ctx, c.owner, c.repo, target.id, opts)
+		case reactionTargetPullRequest:
+			page, response, err = c.client.Reactions.ListIssueReactions(ctx, c.owner, c.repo, int(target.id), opts)
+		default:
+			page, response, err = c.client.Reactions.ListIssueCommentReactions(ctx, c.owner, c.repo, target.id, opts)
+		}
+		if err != nil {
+			c.logger.Error().Err(err).Msg("Failed to list reactions")
+			return nil, err
+		}
+		reactions = append(reactions, page...)
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+	return reactions, nil
+}
+
+// deleteReaction removes the reaction identified by reactionID from the given target
+func (c *GithubCommenter) deleteReaction(ctx context.Context, target reactionTarget, reactionID int64) error {
+	var err error
+	switch target.kind {
+	case reactionTargetReviewComment:
+		_, err = c.client.Reactions.DeletePullRequestCommentReaction(ctx, c.owner, c.repo, target.id, reactionID)
+	case reactionTargetPullRequest:
+		_, err = c.client.Reactions.DeleteIssueReaction(ctx, c.owner, c.repo, int(target.id), reactionID)
+	default:
+		_, err = c.client.Reactions.DeleteIssueCommentReaction(ctx, c.owner, c.repo, target.id, reactionID)
+	}
+	if err != nil {
+		c.logger.Error().Err(err).Msgf("Failed to delete reaction %d", reactionID)
+	}
+	return err
 }
@@ -5,7 +5,6 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"strings"
 	"time"
 
@@ -14,7 +13,8 @@ import (
 	"github.com/rs/zerolog"
 )
 
-func rerunFailedJobs(ctx context.Context, client *github.Client, owner, repo string, runID int64, workflowName string, logger zerolog.Logger) error {
+// rerunFailedJobs reruns the failed jobs of a workflow run, and returns whether there were any
+func rerunFailedJobs(ctx context.Context, client *github.Client, owner, repo string, runID int64, workflowName string, logger zerolog.Logger) (bool, error) {
 	jobListOpts := &github.ListWorkflowJobsOptions{
 		Filter:      "latest",
 		ListOptions: github.ListOptions{PerPage: 100},
@@ -23,12 +23,12 @@ func rerunFailedJobs(ctx context.Context, client *github.Client, owner, repo str
 	jobs, _, err := client.Actions.ListWorkflowJobs(ctx, owner, repo, runID, jobListOpts)
 	if err != nil {
 		logger.Error().Err(err).Msgf("Failed to list workflow jobs for run ID %d", runID)
-		return err
+		return false, err
 	}
 
 	hasFailedJobs := false
 	for _, job := range jobs.Jobs {
-		if job.GetConclusion() == "failure" {
+		if isFailedJob(job) {
 			hasFailedJobs = true
 			logger.Debug().Msgf("Found failed job: %s (ID: %d)", job.GetName(), job.GetID())
 			break
@@ -37,17 +37,46 @@ func rerunFailedJobs(ctx context.Context, client *github.Client, owner, repo str
 
 	if !hasFailedJobs {
 		logger.Debug().Msgf("No failed jobs found for workflow '%s' (run ID: %d)", workflowName, runID)
-		return nil
+		return false, nil
 	}
 
 	logger.Info().Msgf("Re-running failed jobs for workflow '%s' (run ID: %d)", workflowName, runID)
 	if _, err := client.Actions.RerunFailedJobsByID(ctx, owner, repo, runID); err != nil {
 		logger.Error().Err(err).Msgf("Failed to re-run workflow '%s' (run ID: %d)", workflowName, runID)
-		return err
+		return false, err
 	}
 
 	logger.Info().Msgf("Successfully triggered rerun for failed jobs in workflow '%s' (run ID: %d)", workflowName, runID)
-	return nil
+	return true, nil
+}
+
+// isFailedJob returns whether a job failed, including by timing out
+func isFailedJob(job *github.WorkflowJob) bool {
+	return job.GetConclusion() == "failure" || job.GetConclusion() == "timed_out"
+}
+
+// failedSteps returns the names of the failed steps of a job
+func failedSteps(job *github.WorkflowJob) []string {
+	var steps []string
+	for _, step := range job.Steps {
+		if step.GetConclusion() == "failure" {
+			steps = append(steps, step.GetName())
+		}
+	}
+	return steps
+}
+
+// rerunWorkflow reruns all the jobs of a workflow run, e.g. when they never started. It returns
+// whether the run was rerun.
+func rerunWorkflow(ctx context.Context, client *github.Client, owner, repo string, runID int64, workflowName string, logger zerolog.Logger) (bool, error) {
+	logger.Info().Msgf("Re-running workflow '%s' (run ID: %d)", workflowName, runID)
+	if _, err := client.Actions.RerunWorkflowByID(ctx, owner, repo, runID); err != nil {
+		logger.Error().Err(err).Msgf("Failed to re-run workflow '%s' (run ID: %d)", workflowName, runID)
+		return false, err
+	}
+
+	logger.Info().Msgf("Successfully triggered rerun of workflow '%s' (run ID: %d)", workflowName, runID)
+	return true, nil
 }
 
 func prHasLabel(ctx context.Context, client *github.Client, pr *github.PullRequest, labelName string, logger zerolog.Logger) (bool, error) {
@@ -105,12 +134,11 @@ func buildWorkflowStatusTable(workflowStatuses []workflowStatus) string {
 
 	var commentBuilder strings.Builder
 	commentBuilder.WriteString("## Workflow Status\n\n")
-	commentBuilder.WriteString("| Workflow | Status |\n")
-	commentBuilder.WriteString("|----------|--------|\n")
+	commentBuilder.WriteString("| Workflow | Status | Attempt | Triggered by | Duration |\n")
+	commentBuilder.WriteString("|----------|--------|---------|--------------|----------|\n")
 
 	for _, ws := range workflowStatuses {
-		statusEmoji := getStatusEmoji(ws.status)
-		fmt.Fprintf(&commentBuilder, "| `%s` | %s |\n", ws.name, statusEmoji)
+		commentBuilder.WriteString(workflowStatusRow(ws) + "\n")
 	}
 
 	return commentBuilder.String()
@@ -133,6 +161,17 @@ func getStatusEmoji(status workflowStatusType) string {
 	}
 }
 
+// isMaintainer returns whether author has the admin or maintain role on the repository
+func isMaintainer(ctx context.Context, client *github.Client, owner, repo, author string, logger zerolog.Logger) bool {
+	level, _, err := client.Repositories.GetPermissionLevel(ctx, owner, repo, author)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to retrieve the permission level of %s", author)
+		return false
+	}
+	role := level.GetRoleName()
+	return role == "admin" || role == "maintain" || level.GetPermission() == "admin"
+}
+
 // isAllowedTeamMember uses the "Get team membership for a user" to infer if a user can run Ariane
 // See https://docs.github.com/en/rest/teams/members?apiVersion=2022-11-28#get-team-membership-for-a-user
 func isAllowedTeamMember(ctx context.Context, client *github.Client, config *config.ArianeConfig, owner, author string, logger zerolog.Logger) bool {
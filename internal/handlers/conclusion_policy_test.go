@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func TestWorkflowRunHandler_ConclusionPolicies(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		conclusion            string
+		conclusions           map[string]string
+		runAttempt            int
+		expectedRerunFailed   bool
+		expectedRerunAll      bool
+		expectedTriageComment string
+	}{
+		{
+			name:                "timed out run reruns failed jobs by default",
+			conclusion:          "timed_out",
+			runAttempt:          1,
+			expectedRerunFailed: true,
+		},
+		{
+			name:             "run which failed to start is rerun as a whole by default",
+			conclusion:       "startup_failure",
+			runAttempt:       1,
+			expectedRerunAll: true,
+		},
+		{
+			name:             "policy overridden by configuration",
+			conclusion:       "timed_out",
+			conclusions:      map[string]string{"timed_out": config.RerunPolicyAll},
+			runAttempt:       1,
+			expectedRerunAll: true,
+		},
+		{
+			name:                  "report only",
+			conclusion:            "startup_failure",
+			conclusions:           map[string]string{"startup_failure": config.RerunPolicyReport},
+			runAttempt:            1,
+			expectedTriageComment: "## ❌ [`test-workflow`](https://github.com/owner/repo/actions/runs/123) failed to start\n",
+		},
+		{
+			name:                  "retry budget shared with failures",
+			conclusion:            "timed_out",
+			runAttempt:            4,
+			expectedTriageComment: "## ⏱️ [`test-workflow`](https://github.com/owner/repo/actions/runs/123) timed out after 4 attempts\n",
+		},
+		{
+			name:       "conclusion not handled",
+			conclusion: "action_required",
+			runAttempt: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					RerunConfig:  &config.RerunConfig{MaxRetries: 3, Conclusions: tc.conclusions},
+					TriageConfig: &config.TriageConfig{},
+				}, nil
+			}
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			rerunFailedCalled, rerunAllCalled := false, false
+			var comments []string
+			mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+					Number: github.Ptr(1),
+					User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+				}})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(tc.runAttempt)})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+				var jobs []*github.WorkflowJob
+				if tc.conclusion == "timed_out" {
+					jobs = append(jobs, &github.WorkflowJob{ID: github.Ptr[int64](1), Name: github.Ptr("e2e"), Conclusion: github.Ptr("timed_out")})
+				}
+				_ = json.NewEncoder(w).Encode(&github.Jobs{TotalCount: github.Ptr(len(jobs)), Jobs: jobs})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+				rerunFailedCalled = true
+				w.WriteHeader(http.StatusCreated)
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun", func(w http.ResponseWriter, r *http.Request) {
+				rerunAllCalled = true
+				w.WriteHeader(http.StatusCreated)
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/jobs/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				comments = append(comments, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(comment)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator: mockClientCreator,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "completed",
+				"workflow": {
+					"name": "test-workflow",
+					"path": ".github/workflows/test.yaml"
+				},
+				"workflow_run": {
+					"id": 123,
+					"run_attempt": ` + strconv.Itoa(tc.runAttempt) + `,
+					"conclusion": "` + tc.conclusion + `",
+					"html_url": "https://github.com/owner/repo/actions/runs/123",
+					"pull_requests": [
+						{
+							"number": 1
+						}
+					]
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRerunFailed, rerunFailedCalled)
+			assert.Equal(t, tc.expectedRerunAll, rerunAllCalled)
+			if tc.expectedTriageComment == "" {
+				assert.Empty(t, comments)
+			} else if assert.Len(t, comments, 1) {
+				assert.Contains(t, comments[0], tc.expectedTriageComment)
+			}
+		})
+	}
+}
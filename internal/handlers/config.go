@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"time"
+
+	"github.com/cilium/ariane/internal/flakes"
+	"github.com/cilium/ariane/internal/scheduler"
+	"github.com/palantir/go-githubapp/githubapp"
+)
+
+// Config holds the dependencies and settings shared by the handlers which trigger, rerun and report on
+// workflows. Only the ClientCreator is required.
+type Config struct {
+	githubapp.ClientCreator
+	// RunDelay is the delay between rerunning a pre-rerun job (e.g. Commit Status Start) and rerunning the
+	// failed jobs, unless configured otherwise by the repository
+	RunDelay time.Duration
+	// MaxRetryAttempts is the number of times retrieving a pull request is retried when it fails
+	MaxRetryAttempts int
+	// FlakeStore records the failures, reruns and outcomes of workflow runs, and holds the flakiness
+	// history reported by the /ariane flakes command, if set
+	FlakeStore *flakes.Store
+	// Scheduler runs the delayed reruns of failed workflow runs, if set. Without it, reruns caused by
+	// commands run in the background until the workflows are processed, and failed jobs are rerun right
+	// away.
+	Scheduler *scheduler.Scheduler
+	// DispatchedRuns remembers the runs dispatched by Ariane, whose pending check runs and workflows report
+	// row are updated once they complete, if set
+	DispatchedRuns *DispatchedRunTracker
+	// AppID is the ID of the Ariane app: only the required checks it or any app can provide are marked as
+	// skipped
+	AppID int64
+	// BotLogin is the login of the bot user of the Ariane app, whose comments are the only ones Ariane edits
+	BotLogin string
+}
@@ -0,0 +1,236 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/palantir/go-githubapp/githubapp"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+const (
+	// rerunTaskKind is the kind of the scheduler tasks rerunning workflow runs
+	rerunTaskKind = "rerun-failed-jobs"
+	// preRerunTaskKind is the kind of the scheduler tasks rerunning the pre-rerun jobs of workflow runs,
+	// then their failed jobs, for the workflows of a trigger which already failed on the pull request
+	preRerunTaskKind = "pre-rerun-sequence"
+)
+
+// scheduledRerun is the payload of a delayed rerun of a workflow run. It is
+// persisted by the scheduler, hence only holds what is needed to retrieve the rest once due.
+type scheduledRerun struct {
+	InstallationID int64  `json:"installation_id"`
+	Owner          string `json:"owner"`
+	Repo           string `json:"repo"`
+	Workflow       string `json:"workflow"`
+	RunID          int64  `json:"run_id"`
+	Attempt        int    `json:"attempt"`
+	PR             int    `json:"pr"`
+	// SHA is the pull request commit whose rerun budget the rerun was reserved in
+	SHA    string                `json:"sha,omitempty"`
+	Policy string                `json:"policy,omitempty"`
+	Flakes []config.MatchedFlake `json:"flakes,omitempty"`
+}
+
+// scheduledPreRerun is the payload of the rerun of a workflow run after its pre-rerun jobs, along with
+// the trigger which caused it in order to report its failure
+type scheduledPreRerun struct {
+	InstallationID int64  `json:"installation_id"`
+	Owner          string `json:"owner"`
+	Repo           string `json:"repo"`
+	Workflow       string `json:"workflow"`
+	RunID          int64  `json:"run_id"`
+	PR             int    `json:"pr"`
+	Trigger        string `json:"trigger"`
+	Sender         string `json:"sender"`
+}
+
+// RegisterTasks registers the handlers of the tasks the workflow run handler schedules, including the
+// reruns scheduled by the handlers of trigger commands
+func (w *WorkflowRunHandler) RegisterTasks() {
+	if w.Scheduler != nil {
+		w.Scheduler.Register(rerunTaskKind, w.runScheduledRerun)
+		w.Scheduler.RegisterDrop(rerunTaskKind, w.dropScheduledRerun)
+		w.Scheduler.Register(preRerunTaskKind, w.runScheduledPreRerun)
+	}
+}
+
+// scheduleRerun schedules the rerun of the given attempt of a workflow run according to policy after delay
+func (w *WorkflowRunHandler) scheduleRerun(
+	installationID int64,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	runAttempt int,
+	policy string,
+	matchedFlakes []config.MatchedFlake,
+	delay time.Duration,
+	logger zerolog.Logger,
+) (bool, error) {
+	task := scheduledRerun{
+		InstallationID: installationID,
+		Owner:          repositoryOwner,
+		Repo:           repositoryName,
+		Workflow:       workflowName,
+		RunID:          workflowRun.GetID(),
+		Attempt:        runAttempt,
+		PR:             pullRequest.GetNumber(),
+		SHA:            w.DispatchedRuns.pullRequestCommit(workflowRun),
+		Policy:         policy,
+		Flakes:         matchedFlakes,
+	}
+	if err := w.Scheduler.Schedule(rerunTaskKind, time.Now().Add(delay), task); err != nil {
+		logger.Error().Err(err).Msgf("Failed to schedule rerun of workflow '%s' (run ID: %d)", workflowName, workflowRun.GetID())
+		return false, err
+	}
+	logger.Info().Msgf("Scheduled rerun of workflow '%s' (run ID: %d, attempt %d) in %s", workflowName, workflowRun.GetID(), runAttempt, delay)
+	return true, nil
+}
+
+// runScheduledRerun reruns a workflow run once its delay elapsed, unless the run was
+// rerun or its pull request closed in the meantime
+func (w *WorkflowRunHandler) runScheduledRerun(ctx context.Context, payload json.RawMessage) error {
+	var task scheduledRerun
+	if err := json.Unmarshal(payload, &task); err != nil {
+		return fmt.Errorf("failed to parse scheduled rerun: %w", err)
+	}
+	logger := zerolog.Ctx(ctx).With().
+		Int64(githubapp.LogKeyInstallationID, task.InstallationID).
+		Str(githubapp.LogKeyRepositoryOwner, task.Owner).
+		Str(githubapp.LogKeyRepositoryName, task.Repo).
+		Logger()
+
+	client, err := w.NewInstallationClient(task.InstallationID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create GitHub client")
+		return err
+	}
+
+	workflowRun, _, err := client.Actions.GetWorkflowRunByID(ctx, task.Owner, task.Repo, task.RunID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to get workflow run %d", task.RunID)
+		return err
+	}
+	// the rerun was reserved in the rerun budgets when scheduled, the reservation is cancelled if it is skipped
+	if workflowRun.GetRunAttempt() != task.Attempt || workflowRun.GetStatus() != "completed" {
+		logger.Info().Msgf("Workflow run %d was rerun in the meantime, skipping scheduled rerun", task.RunID)
+		w.cancelScheduledRerun(task, logger)
+		return nil
+	}
+
+	pullRequest, _, err := client.PullRequests.Get(ctx, task.Owner, task.Repo, task.PR)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to get PR #%d details", task.PR)
+		return err
+	}
+	if pullRequest.GetState() != "open" {
+		logger.Info().Msgf("PR #%d is %s, skipping scheduled rerun of workflow run %d", task.PR, pullRequest.GetState(), task.RunID)
+		w.cancelScheduledRerun(task, logger)
+		return nil
+	}
+
+	contextRef, _, _ := determineContextRef(pullRequest, task.Owner, task.Repo, logger)
+	arianeConfig, err := configGetArianeConfigFromRepository(client, ctx, task.Owner, task.Repo, contextRef)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve Ariane config")
+		return err
+	}
+
+	rerun, err := w.rerun(ctx, client, task.InstallationID, task.Workflow, workflowRun, pullRequest, task.Owner, task.Repo, arianeConfig, task.Attempt, task.Policy, task.Flakes, logger)
+	if err != nil {
+		// the task is retried, keeping its reservation
+		return err
+	}
+	if !rerun {
+		w.cancelScheduledRerun(task, logger)
+	}
+	return nil
+}
+
+// dropScheduledRerun cancels the reservation of a scheduled rerun in the rerun budgets once the scheduler
+// gave up on running it, as the rerun will not happen
+func (w *WorkflowRunHandler) dropScheduledRerun(ctx context.Context, payload json.RawMessage, err error) {
+	var task scheduledRerun
+	if err := json.Unmarshal(payload, &task); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to parse dropped scheduled rerun")
+		return
+	}
+	logger := zerolog.Ctx(ctx).With().
+		Int64(githubapp.LogKeyInstallationID, task.InstallationID).
+		Str(githubapp.LogKeyRepositoryOwner, task.Owner).
+		Str(githubapp.LogKeyRepositoryName, task.Repo).
+		Logger()
+
+	logger.Warn().Err(err).Msgf("Gave up on the scheduled rerun of workflow run %d, releasing its rerun budget", task.RunID)
+	w.cancelScheduledRerun(task, logger)
+}
+
+// cancelScheduledRerun cancels the reservation of a scheduled rerun in the rerun budgets of the pull
+// request commit and of the installation it was reserved in
+func (w *WorkflowRunHandler) cancelScheduledRerun(task scheduledRerun, logger zerolog.Logger) {
+	workflowRun := &github.WorkflowRun{ID: github.Ptr(task.RunID), HeadSHA: github.Ptr(task.SHA)}
+	pullRequest := &github.PullRequest{Number: github.Ptr(task.PR)}
+	w.recordFlakes(flakes.KindCancelledRerun, task.InstallationID, task.Workflow, workflowRun, pullRequest, task.Owner, task.Repo, task.Attempt, logger, "")
+}
+
+// runScheduledPreRerun reruns the pre-rerun jobs of a workflow run, then its failed jobs. A failure of
+// the sequence is reported on the pull request like a failure of the trigger which caused it, and not
+// retried, as its pre-rerun jobs may have been rerun already.
+func (w *WorkflowRunHandler) runScheduledPreRerun(ctx context.Context, payload json.RawMessage) error {
+	var task scheduledPreRerun
+	if err := json.Unmarshal(payload, &task); err != nil {
+		return fmt.Errorf("failed to parse scheduled pre-rerun sequence: %w", err)
+	}
+	logger := zerolog.Ctx(ctx).With().
+		Int64(githubapp.LogKeyInstallationID, task.InstallationID).
+		Str(githubapp.LogKeyRepositoryOwner, task.Owner).
+		Str(githubapp.LogKeyRepositoryName, task.Repo).
+		Int(githubapp.LogKeyPRNum, task.PR).
+		Logger()
+
+	client, err := w.NewInstallationClient(task.InstallationID)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to create GitHub client")
+		return err
+	}
+
+	pullRequest, _, err := client.PullRequests.Get(ctx, task.Owner, task.Repo, task.PR)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to get PR #%d details", task.PR)
+		return err
+	}
+	contextRef, _, _ := determineContextRef(pullRequest, task.Owner, task.Repo, logger)
+	arianeConfig, err := configGetArianeConfigFromRepository(client, ctx, task.Owner, task.Repo, contextRef)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to retrieve Ariane config")
+		return err
+	}
+
+	processor := WorkflowProcessor{
+		client:       client,
+		owner:        task.Owner,
+		repo:         task.Repo,
+		arianeConfig: arianeConfig,
+		logger:       logger,
+		runDelay:     w.RunDelay,
+	}
+	if err := processor.rerunSequence(ctx, task.Workflow, task.RunID); err != nil {
+		logger.Error().Err(err).Msgf("Failed to rerun workflow %s run_id %d", task.Workflow, task.RunID)
+		if arianeConfig.GetVerbose() {
+			reason := fmt.Sprintf("failed to rerun workflows: %v", err)
+			comment := feedbackMessage(arianeConfig, config.TemplateTriggerFailed, config.FeedbackData{Author: task.Sender, Command: task.Trigger, Reason: reason}, logger)
+			_ = NewGithubCommenter(client, task.Owner, task.Repo, w.BotLogin, logger).report(ctx, arianeConfig, task.PR, config.TemplateTriggerFailed, task.Trigger, comment)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+	"github.com/cilium/ariane/internal/scheduler"
+)
+
+func TestWorkflowRunHandler_Failure_DelayedRerun(t *testing.T) {
+	testCases := []struct {
+		name       string
+		currentRun *github.WorkflowRun
+		prState    string
+		// dropped is whether the scheduler gives up on the rerun instead of running it
+		dropped       bool
+		expectedRerun bool
+	}{
+		{
+			name:          "rerun once due",
+			currentRun:    &github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(2), Status: github.Ptr("completed")},
+			prState:       "open",
+			expectedRerun: true,
+		},
+		{
+			name:       "run rerun in the meantime",
+			currentRun: &github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(3), Status: github.Ptr("in_progress")},
+			prState:    "open",
+		},
+		{
+			name:       "pull request closed in the meantime",
+			currentRun: &github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(2), Status: github.Ptr("completed")},
+			prState:    "closed",
+		},
+		{
+			name:    "scheduler gave up on the rerun",
+			dropped: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					RerunConfig: &config.RerunConfig{MaxRetries: 3, Delay: time.Minute, BackoffFactor: 2},
+				}, nil
+			}
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			// the run is at its second attempt when it fails, then at tc.currentRun once the rerun is due
+			currentRun := &github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(2), Status: github.Ptr("completed")}
+			rerunCalled := false
+			mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+					Number: github.Ptr(1),
+					User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+				}})
+			})
+			mux.HandleFunc("/repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.PullRequest{
+					Number: github.Ptr(1),
+					State:  github.Ptr(tc.prState),
+					Head:   &github.PullRequestBranch{SHA: github.Ptr("abc123"), Repo: &github.Repository{FullName: github.Ptr("owner/repo")}},
+					Base:   &github.PullRequestBranch{Ref: github.Ptr("main"), SHA: github.Ptr("def456"), Repo: &github.Repository{FullName: github.Ptr("owner/repo")}},
+				})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(currentRun)
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Jobs{
+					TotalCount: github.Ptr(1),
+					Jobs:       []*github.WorkflowJob{{ID: github.Ptr[int64](1), Name: github.Ptr("unit"), Conclusion: github.Ptr("failure")}},
+				})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+				rerunCalled = true
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			clients := 2
+			if tc.dropped {
+				clients = 1
+			}
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil).Times(clients)
+
+			taskScheduler, err := scheduler.Open("", zerolog.Nop())
+			if err != nil {
+				t.Fatalf("Failed to open scheduler: %v", err)
+			}
+			flakeStore, err := flakes.Open("")
+			if err != nil {
+				t.Fatalf("Failed to open flakes store: %v", err)
+			}
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator: mockClientCreator,
+					Scheduler:     taskScheduler,
+					FlakeStore:    flakeStore,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "completed",
+				"workflow": {
+					"name": "test-workflow",
+					"path": ".github/workflows/test.yaml"
+				},
+				"workflow_run": {
+					"id": 123,
+					"head_sha": "abc123",
+					"conclusion": "failure",
+					"pull_requests": [
+						{
+							"number": 1
+						}
+					]
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			start := time.Now()
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.False(t, rerunCalled, "failed jobs must not be rerun before the delay elapsed")
+
+			// the delay of the second attempt is backed off
+			pending := taskScheduler.Pending()
+			if !assert.Len(t, pending, 1) {
+				return
+			}
+			assert.Equal(t, rerunTaskKind, pending[0].Kind)
+			assert.WithinDuration(t, start.Add(2*time.Minute), pending[0].Due, 5*time.Second)
+			assert.Equal(t, 1, flakeStore.Reruns().InstallationReruns(1, time.Time{}), "the scheduled rerun counts against the rerun budgets")
+
+			currentRun = tc.currentRun
+			if tc.dropped {
+				handler.dropScheduledRerun(context.Background(), pending[0].Payload, errors.New("GitHub is down"))
+			} else {
+				err = handler.runScheduledRerun(context.Background(), pending[0].Payload)
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRerun, rerunCalled)
+			expectedReruns := 0
+			if tc.expectedRerun {
+				expectedReruns = 1
+			}
+			assert.Equal(t, expectedReruns, flakeStore.Reruns().InstallationReruns(1, time.Time{}))
+			assert.Equal(t, expectedReruns, flakeStore.Reruns().CommitReruns("owner/repo", "abc123"))
+		})
+	}
+}
+
+func TestWorkflowRunHandler_ScheduledPreRerun(t *testing.T) {
+	testCases := []struct {
+		name            string
+		rerunStatus     int
+		expectedComment bool
+	}{
+		{
+			name:        "failed jobs rerun after the pre-rerun jobs",
+			rerunStatus: http.StatusCreated,
+		},
+		{
+			name:            "failed jobs failed to rerun",
+			rerunStatus:     http.StatusForbidden,
+			expectedComment: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					Feedback:     config.FeedbackConfig{Verbose: github.Ptr(true)},
+					PreRerunJobs: map[string][]config.PreRerunJob{"ci.yaml": {}},
+				}, nil
+			}
+
+			var comments []string
+			rerunCalled := false
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.PullRequest{
+					Number: github.Ptr(1),
+					State:  github.Ptr("open"),
+					Head:   &github.PullRequestBranch{SHA: github.Ptr("abc123"), Repo: &github.Repository{FullName: github.Ptr("owner/repo")}},
+					Base:   &github.PullRequestBranch{Ref: github.Ptr("main"), SHA: github.Ptr("def456"), Repo: &github.Repository{FullName: github.Ptr("owner/repo")}},
+				})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/actions/runs/99/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+				rerunCalled = true
+				w.WriteHeader(tc.rerunStatus)
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				comments = append(comments, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(&comment)
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			taskScheduler, err := scheduler.Open("", zerolog.Nop())
+			if err != nil {
+				t.Fatalf("Failed to open scheduler: %v", err)
+			}
+
+			// the rerun of a failed run is scheduled instead of holding back the trigger command
+			processor := &WorkflowProcessor{
+				client:         client,
+				owner:          "owner",
+				repo:           "repo",
+				logger:         zerolog.Nop(),
+				sender:         "user",
+				scheduler:      taskScheduler,
+				installationID: 1,
+			}
+			processor.rerunFailedJobs(context.Background(), "ci.yaml", 99)
+			assert.NoError(t, processor.scheduleReruns(1, "/test"))
+			assert.NoError(t, processor.reruns.wait())
+			pending := taskScheduler.Pending()
+			if !assert.Len(t, pending, 1) {
+				return
+			}
+			assert.Equal(t, preRerunTaskKind, pending[0].Kind)
+			assert.False(t, rerunCalled)
+
+			handler := &WorkflowRunHandler{Config: Config{ClientCreator: mockClientCreator, Scheduler: taskScheduler}}
+			assert.NoError(t, handler.runScheduledPreRerun(context.Background(), pending[0].Payload))
+			assert.True(t, rerunCalled)
+			if tc.expectedComment {
+				if assert.Len(t, comments, 1) {
+					assert.Contains(t, comments[0], "failed to rerun failed jobs of workflow ci.yaml run 99")
+				}
+			} else {
+				assert.Empty(t, comments)
+			}
+		})
+	}
+}
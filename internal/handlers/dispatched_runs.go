@@ -0,0 +1,243 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/google/go-github/v88/github"
+
+	"github.com/cilium/ariane/internal/atomicfile"
+)
+
+// dispatchedRunsLimit is the maximum number of dispatched runs remembered to report on their completion
+const dispatchedRunsLimit = 1000
+
+// dispatchedRun describes a workflow run dispatched by Ariane, listed in a workflows report and/or
+// with a pending check run
+type dispatchedRun struct {
+	owner    string
+	repo     string
+	prNumber int
+	// workflow is the file name of the dispatched workflow, and sha the head commit of the pull request
+	// it was dispatched for, which differs from the commit of the run for pull requests from forks
+	workflow string
+	sha      string
+	// channel is the feedback channel the workflows report was posted through, and status the row of
+	// the run in the report, if listed in one
+	channel string
+	status  workflowStatus
+	// checks are the pending check runs created when dispatching the run, if any
+	checks []pendingCheck
+}
+
+// dispatchedRunRecord is the persisted form of a dispatched run
+type dispatchedRunRecord struct {
+	RunID    int64  `json:"runID"`
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	PRNumber int    `json:"prNumber"`
+	Workflow string `json:"workflow"`
+	SHA      string `json:"sha"`
+	Channel  string `json:"channel,omitempty"`
+	// Status is the row of the run in the workflows report, if listed in one
+	Status *reportRowRecord     `json:"status,omitempty"`
+	Checks []pendingCheckRecord `json:"checks,omitempty"`
+}
+
+// reportRowRecord is the persisted form of the row of a dispatched run in the workflows report
+type reportRowRecord struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Trigger string `json:"trigger"`
+	Sender  string `json:"sender"`
+	RunURL  string `json:"runURL"`
+	Attempt int    `json:"attempt"`
+}
+
+// pendingCheckRecord is the persisted form of a pending check run
+type pendingCheckRecord struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func newDispatchedRunRecord(runID int64, run dispatchedRun) dispatchedRunRecord {
+	record := dispatchedRunRecord{
+		RunID:    runID,
+		Owner:    run.owner,
+		Repo:     run.repo,
+		PRNumber: run.prNumber,
+		Workflow: run.workflow,
+		SHA:      run.sha,
+		Channel:  run.channel,
+	}
+	if run.status.runID != 0 {
+		record.Status = &reportRowRecord{run.status.name, string(run.status.status), run.status.trigger, run.status.sender, run.status.runURL, run.status.attempt}
+	}
+	for _, check := range run.checks {
+		record.Checks = append(record.Checks, pendingCheckRecord{check.id, check.name})
+	}
+	return record
+}
+
+func (r dispatchedRunRecord) dispatchedRun() dispatchedRun {
+	run := dispatchedRun{
+		owner:    r.Owner,
+		repo:     r.Repo,
+		prNumber: r.PRNumber,
+		workflow: r.Workflow,
+		sha:      r.SHA,
+		channel:  r.Channel,
+	}
+	if r.Status != nil {
+		run.status = workflowStatus{
+			name:    r.Status.Name,
+			status:  workflowStatusType(r.Status.Status),
+			trigger: r.Status.Trigger,
+			sender:  r.Status.Sender,
+			runID:   r.RunID,
+			runURL:  r.Status.RunURL,
+			attempt: r.Status.Attempt,
+		}
+	}
+	for _, check := range r.Checks {
+		run.checks = append(run.checks, pendingCheck{id: check.ID, name: check.Name})
+	}
+	return run
+}
+
+// DispatchedRunTracker remembers the workflow runs dispatched by Ariane, in order to update their row
+// in the workflows report and their pending check runs on completion, and to find the pull request
+// commit they ran for. Runs are persisted to a file if set, so that they are not forgotten on restart.
+// A nil tracker remembers nothing.
+type DispatchedRunTracker struct {
+	mu    sync.Mutex
+	path  string
+	order []int64
+	runs  map[int64]dispatchedRun
+}
+
+// OpenDispatchedRuns loads the dispatched runs persisted at path, and returns a tracker persisting them
+// there. If path is empty, dispatched runs are only kept in memory and forgotten on restart.
+func OpenDispatchedRuns(path string) (*DispatchedRunTracker, error) {
+	t := &DispatchedRunTracker{}
+	if err := t.open(path); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *DispatchedRunTracker) open(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.path = path
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return fmt.Errorf("failed reading dispatched runs store: %w", err)
+	case len(data) == 0:
+		return nil
+	}
+	var records []dispatchedRunRecord
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("failed parsing dispatched runs store: %w", err)
+	}
+	t.order, t.runs = nil, make(map[int64]dispatchedRun, len(records))
+	for _, record := range records {
+		if _, ok := t.runs[record.RunID]; !ok {
+			t.order = append(t.order, record.RunID)
+		}
+		t.runs[record.RunID] = record.dispatchedRun()
+	}
+	return nil
+}
+
+func (t *DispatchedRunTracker) add(runID int64, run dispatchedRun) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.runs == nil {
+		t.runs = make(map[int64]dispatchedRun)
+	}
+	if _, ok := t.runs[runID]; !ok {
+		t.order = append(t.order, runID)
+	}
+	t.runs[runID] = run
+	for len(t.order) > dispatchedRunsLimit {
+		delete(t.runs, t.order[0])
+		t.order = t.order[1:]
+	}
+	return t.persist()
+}
+
+func (t *DispatchedRunTracker) get(runID int64) (dispatchedRun, bool) {
+	if t == nil {
+		return dispatchedRun{}, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	run, ok := t.runs[runID]
+	return run, ok
+}
+
+// pullRequestCommit returns the pull request commit a workflow run ran for: the commit it was dispatched
+// for if dispatched by Ariane, as runs dispatched for pull requests from forks run on the base branch,
+// and the head commit of the run otherwise
+func (t *DispatchedRunTracker) pullRequestCommit(workflowRun *github.WorkflowRun) string {
+	if run, ok := t.get(workflowRun.GetID()); ok && run.sha != "" {
+		return run.sha
+	}
+	return workflowRun.GetHeadSHA()
+}
+
+// latest returns the most recent run of workflow dispatched for the pull request commit sha, if any
+func (t *DispatchedRunTracker) latest(owner, repo, workflow, sha string) (int64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.order) - 1; i >= 0; i-- {
+		run := t.runs[t.order[i]]
+		if run.owner == owner && run.repo == repo && run.workflow == workflow && run.sha == sha {
+			return t.order[i], true
+		}
+	}
+	return 0, false
+}
+
+// persist rewrites the store with the tracked runs. It must be called with t.mu held.
+func (t *DispatchedRunTracker) persist() error {
+	if t.path == "" {
+		return nil
+	}
+	records := make([]dispatchedRunRecord, 0, len(t.order))
+	for _, runID := range t.order {
+		records = append(records, newDispatchedRunRecord(runID, t.runs[runID]))
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed encoding dispatched runs store: %w", err)
+	}
+	if err := atomicfile.Write(t.path, data); err != nil {
+		return fmt.Errorf("failed writing dispatched runs store: %w", err)
+	}
+	return nil
+}
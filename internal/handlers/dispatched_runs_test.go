@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatchedRunTracker_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dispatched-runs.json")
+	status := workflowStatus{name: "ci.yaml", status: workflowStatusTriggered, trigger: "/test", sender: "user", runID: 1, runURL: "https://github.com/owner/repo/actions/runs/1", attempt: 1}
+	runs := map[int64]dispatchedRun{
+		1: {owner: "owner", repo: "repo", prNumber: 7, workflow: "ci.yaml", sha: "sha", channel: "comment", status: status, checks: []pendingCheck{{id: 77, name: "CI"}}},
+		2: {owner: "owner", repo: "repo", prNumber: 7, workflow: "lint.yaml", sha: "sha"},
+	}
+
+	tracker := &DispatchedRunTracker{}
+	if err := tracker.open(path); err != nil {
+		t.Fatalf("Failed to open dispatched runs store: %v", err)
+	}
+	for runID, run := range runs {
+		assert.NoError(t, tracker.add(runID, run))
+	}
+
+	// the runs survive a restart
+	tracker = &DispatchedRunTracker{}
+	if err := tracker.open(path); err != nil {
+		t.Fatalf("Failed to open dispatched runs store: %v", err)
+	}
+	for runID, expected := range runs {
+		run, ok := tracker.get(runID)
+		assert.True(t, ok)
+		assert.Equal(t, expected, run)
+	}
+	_, ok := tracker.get(3)
+	assert.False(t, ok)
+}
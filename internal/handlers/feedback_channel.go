@@ -0,0 +1,316 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+const (
+	// descriptionStartMarker and descriptionEndMarker delimit the block managed by Ariane in the pull request description
+	descriptionStartMarker = "<!-- ariane:feedback -->"
+	descriptionEndMarker   = "<!-- ariane:feedback-end -->"
+	// feedbackCheckRunName is the name of the check run Ariane reports feedback in, through the check-run channel
+	feedbackCheckRunName = "Ariane feedback"
+	// feedbackExternalID identifies the check run holding feedback among check runs named feedbackCheckRunName
+	feedbackExternalID = "ariane-feedback"
+	// checkRunSummaryLimit is the maximum length of the summary of a check run accepted by GitHub
+	checkRunSummaryLimit = 65535
+	// checkRunTruncatedNote ends a check run summary truncated to checkRunSummaryLimit
+	checkRunTruncatedNote = "\n\n… (truncated)"
+)
+
+var descriptionBlockRegex = regexp.MustCompile(`(?s)` + regexp.QuoteMeta(descriptionStartMarker) + `\n(.*?)` + regexp.QuoteMeta(descriptionEndMarker))
+
+// feedbackLock serializes the feedback updates of a pull request (or of a commit), refs counting the
+// updates holding or waiting for it
+type feedbackLock struct {
+	sync.Mutex
+	refs int
+}
+
+// feedbackLocks serializes feedback updates per pull request, so concurrent events do not overwrite
+// each other's sections. Locks are dropped once no update holds or waits for them.
+var feedbackLocks = struct {
+	mu    sync.Mutex
+	locks map[string]*feedbackLock
+}{locks: make(map[string]*feedbackLock)}
+
+// lockFeedback locks the feedback of the given pull request, and returns the function unlocking it
+func (c *GithubCommenter) lockFeedback(prNumber int) func() {
+	return lockFeedback(fmt.Sprintf("%s/%s#%d", c.owner, c.repo, prNumber))
+}
+
+// lockFeedback locks the feedback identified by key, and returns the function unlocking it
+func lockFeedback(key string) func() {
+	feedbackLocks.mu.Lock()
+	lock, ok := feedbackLocks.locks[key]
+	if !ok {
+		lock = &feedbackLock{}
+		feedbackLocks.locks[key] = lock
+	}
+	lock.refs++
+	feedbackLocks.mu.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+
+		feedbackLocks.mu.Lock()
+		defer feedbackLocks.mu.Unlock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(feedbackLocks.locks, key)
+		}
+	}
+}
+
+// feedbackChannel is a place where Ariane reports feedback on a pull request
+type feedbackChannel interface {
+	// post reports body, replacing the previous feedback identified by section (usually the trigger
+	// phrase it relates to) for channels which keep a single message
+	post(ctx context.Context, prNumber int, section, body string) error
+	// edit rewrites the first message of the channel for which update returns true
+	edit(ctx context.Context, prNumber int, update func(body string) (string, bool)) error
+}
+
+// channel returns the feedback channel of the given name, see config.ValidChannels
+func (c *GithubCommenter) channel(name string, minimizeOutdated bool) feedbackChannel {
+	switch name {
+	case config.ChannelStickyComment:
+		return &stickyCommentChannel{commenter: c, minimizeOutdated: minimizeOutdated}
+	case config.ChannelPRDescription:
+		return &descriptionChannel{commenter: c}
+	case config.ChannelCheckRun:
+		return &checkRunChannel{commenter: c}
+	case config.ChannelNone:
+		return noneChannel{}
+	default:
+		return &commentChannel{commenter: c}
+	}
+}
+
+// commentChannel posts each message as a new pull request comment
+type commentChannel struct {
+	commenter *GithubCommenter
+}
+
+func (ch *commentChannel) post(ctx context.Context, prNumber int, _, body string) error {
+	return ch.commenter.commentOnPullRequest(ctx, prNumber, body)
+}
+
+func (ch *commentChannel) edit(ctx context.Context, prNumber int, update func(body string) (string, bool)) error {
+	return ch.commenter.editComments(ctx, prNumber, update)
+}
+
+// stickyCommentChannel gathers messages in the sections of a single comment edited in place
+type stickyCommentChannel struct {
+	commenter        *GithubCommenter
+	minimizeOutdated bool
+}
+
+func (ch *stickyCommentChannel) post(ctx context.Context, prNumber int, section, body string) error {
+	return ch.commenter.updateStickyComment(ctx, prNumber, section, body, ch.minimizeOutdated)
+}
+
+func (ch *stickyCommentChannel) edit(ctx context.Context, prNumber int, update func(body string) (string, bool)) error {
+	return ch.commenter.editComments(ctx, prNumber, update)
+}
+
+// descriptionChannel gathers messages in the sections of a block managed by Ariane at the end of the
+// pull request description. The rest of the description is left untouched.
+type descriptionChannel struct {
+	commenter *GithubCommenter
+}
+
+func (ch *descriptionChannel) post(ctx context.Context, prNumber int, section, body string) error {
+	return ch.update(ctx, prNumber, func(block string) (string, bool) {
+		content := parseStickyComment(block)
+		if !content.update(section, body, time.Now()) {
+			return "", false
+		}
+		return content.renderSections(), true
+	})
+}
+
+func (ch *descriptionChannel) edit(ctx context.Context, prNumber int, update func(body string) (string, bool)) error {
+	return ch.update(ctx, prNumber, update)
+}
+
+// update rewrites the block managed by Ariane in the pull request description with update, adding the
+// block if the description does not contain it yet
+func (ch *descriptionChannel) update(ctx context.Context, prNumber int, update func(block string) (string, bool)) error {
+	c := ch.commenter
+	defer c.lockFeedback(prNumber)()
+
+	pr, _, err := c.client.PullRequests.Get(ctx, c.owner, c.repo, prNumber)
+	if err != nil {
+		c.logger.Error().Err(err).Msgf("Failed to retrieve PR %d", prNumber)
+		return err
+	}
+
+	description := pr.GetBody()
+	var current string
+	match := descriptionBlockRegex.FindStringSubmatch(description)
+	if match != nil {
+		current = match[1]
+	}
+	block, ok := update(current)
+	if !ok {
+		return nil
+	}
+	block = descriptionStartMarker + "\n" + block + descriptionEndMarker
+	switch {
+	case match != nil:
+		description = descriptionBlockRegex.ReplaceAllLiteralString(description, block)
+	case strings.TrimSpace(description) == "":
+		description = block
+	default:
+		description = strings.TrimRight(description, "\r\n") + "\n\n" + block
+	}
+
+	if _, _, err := c.client.PullRequests.Edit(ctx, c.owner, c.repo, prNumber, &github.PullRequest{Body: github.Ptr(description)}); err != nil {
+		c.logger.Error().Err(err).Msgf("Failed to update the description of PR %d", prNumber)
+		return err
+	}
+	return nil
+}
+
+// checkRunChannel gathers messages in the sections of the summary of a neutral check run on the pull
+// request head commit. Feedback reported for previous commits stays on their own check run.
+type checkRunChannel struct {
+	commenter *GithubCommenter
+}
+
+func (ch *checkRunChannel) post(ctx context.Context, prNumber int, section, body string) error {
+	return ch.update(ctx, prNumber, section, func(summary string) (string, bool) {
+		content := parseStickyComment(summary)
+		if !content.update(section, body, time.Now()) {
+			return "", false
+		}
+		// the oldest history entries are dropped first to fit in the summary
+		rendered := content.renderSections()
+		for len(rendered) > checkRunSummaryLimit && len(content.history) > 0 {
+			content.history = content.history[:len(content.history)-1]
+			rendered = content.renderSections()
+		}
+		return rendered, true
+	})
+}
+
+func (ch *checkRunChannel) edit(ctx context.Context, prNumber int, update func(body string) (string, bool)) error {
+	return ch.update(ctx, prNumber, "", update)
+}
+
+// update rewrites the summary of the feedback check run of the pull request head with update,
+// creating the check run if needed. section, if any, is reflected in the check run title.
+func (ch *checkRunChannel) update(ctx context.Context, prNumber int, section string, update func(summary string) (string, bool)) error {
+	c := ch.commenter
+	defer c.lockFeedback(prNumber)()
+
+	pr, _, err := c.client.PullRequests.Get(ctx, c.owner, c.repo, prNumber)
+	if err != nil {
+		c.logger.Error().Err(err).Msgf("Failed to retrieve PR %d", prNumber)
+		return err
+	}
+	sha := pr.GetHead().GetSHA()
+
+	checkRun, err := getArianeCheckRun(ctx, c.client, c.owner, c.repo, sha, feedbackCheckRunName, feedbackExternalID)
+	if err != nil {
+		c.logger.Error().Err(err).Msgf("Failed to retrieve %s check run for sha=%s", feedbackCheckRunName, sha)
+		return err
+	}
+
+	summary, ok := update(checkRun.GetOutput().GetSummary())
+	if !ok {
+		return nil
+	}
+	summary = truncateCheckRunSummary(summary)
+	title := checkRun.GetOutput().GetTitle()
+	if section != "" {
+		title = fmt.Sprintf("Feedback on %s", section)
+	}
+	if title == "" {
+		title = feedbackCheckRunName
+	}
+	output := &github.CheckRunOutput{
+		Title:   github.Ptr(title),
+		Summary: github.Ptr(summary),
+	}
+
+	if checkRun == nil {
+		_, _, err = c.client.Checks.CreateCheckRun(ctx, c.owner, c.repo, github.CreateCheckRunOptions{
+			Name:        feedbackCheckRunName,
+			HeadSHA:     sha,
+			ExternalID:  github.Ptr(feedbackExternalID),
+			Status:      github.Ptr("completed"),
+			Conclusion:  github.Ptr("neutral"),
+			CompletedAt: &github.Timestamp{Time: time.Now()},
+			Output:      output,
+		})
+	} else {
+		_, _, err = c.client.Checks.UpdateCheckRun(ctx, c.owner, c.repo, checkRun.GetID(), github.UpdateCheckRunOptions{
+			Name:   feedbackCheckRunName,
+			Output: output,
+		})
+	}
+	if err != nil {
+		c.logger.Error().Err(err).Msgf("Failed to report feedback in %s check run for sha=%s", feedbackCheckRunName, sha)
+		return err
+	}
+	return nil
+}
+
+// truncateCheckRunSummary truncates summary to the maximum length of a check run summary, if needed
+func truncateCheckRunSummary(summary string) string {
+	if len(summary) <= checkRunSummaryLimit {
+		return summary
+	}
+	return strings.ToValidUTF8(summary[:checkRunSummaryLimit-len(checkRunTruncatedNote)], "") + checkRunTruncatedNote
+}
+
+// noneChannel discards feedback
+type noneChannel struct{}
+
+func (noneChannel) post(context.Context, int, string, string) error {
+	return nil
+}
+
+func (noneChannel) edit(context.Context, int, func(string) (string, bool)) error {
+	return nil
+}
+
+// editComments rewrites the first pull request comment posted by Ariane for which update returns true
+func (c *GithubCommenter) editComments(ctx context.Context, prNumber int, update func(body string) (string, bool)) error {
+	defer c.lockFeedback(prNumber)()
+
+	comments, err := c.listPullRequestComments(ctx, prNumber)
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		if !c.ownComment(comment) {
+			continue
+		}
+		body, ok := update(comment.GetBody())
+		if !ok {
+			continue
+		}
+		if _, _, err := c.client.Issues.EditComment(ctx, c.owner, c.repo, comment.GetID(), &github.IssueComment{Body: github.Ptr(body)}); err != nil {
+			c.logger.Error().Err(err).Msgf("Failed to edit comment %d on PR %d", comment.GetID(), prNumber)
+			return err
+		}
+		return nil
+	}
+	return nil
+}
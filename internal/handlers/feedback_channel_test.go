@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func newFeedbackChannelTestCommenter(t *testing.T, mux *http.ServeMux) *GithubCommenter {
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+	return NewGithubCommenter(client, "owner", "repo", "ariane[bot]", zerolog.Nop())
+}
+
+func Test_descriptionChannel(t *testing.T) {
+	testCases := []struct {
+		name        string
+		description string
+		expected    []string
+		notExpected []string
+	}{
+		{
+			name:     "empty description",
+			expected: []string{descriptionStartMarker + "\n## Ariane\n", "<!-- ariane:section %2Ftest -->\nnew\n"},
+		},
+		{
+			name:        "block appended to the description",
+			description: "Fixes a bug.\r\n",
+			expected:    []string{"Fixes a bug.\n\n" + descriptionStartMarker + "\n", "new\n<!-- ariane:end -->\n" + descriptionEndMarker},
+		},
+		{
+			name: "block replaced in the description",
+			description: "Fixes a bug.\n\n" + descriptionStartMarker + "\n## Ariane\n\n### `/test`\n" +
+				"<!-- ariane:section %2Ftest -->\nold\n<!-- ariane:end -->\n" + descriptionEndMarker + "\n\nSigned-off-by: user",
+			expected:    []string{"Fixes a bug.\n\n" + descriptionStartMarker, "<!-- ariane:section %2Ftest -->\nnew\n", "History", descriptionEndMarker + "\n\nSigned-off-by: user"},
+			notExpected: []string{"Fixes a bug.\n\n\n"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var edited []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(github.PullRequest{Number: github.Ptr(1), Body: github.Ptr(tc.description)})
+			})
+			mux.HandleFunc("PATCH /repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+				var pr github.PullRequest
+				_ = json.NewDecoder(r.Body).Decode(&pr)
+				edited = append(edited, pr.GetBody())
+				_ = json.NewEncoder(w).Encode(pr)
+			})
+			commenter := newFeedbackChannelTestCommenter(t, mux)
+
+			cfg := &config.ArianeConfig{Feedback: config.FeedbackConfig{Channels: map[string]string{config.FeedbackErrors: config.ChannelPRDescription}}}
+			err := commenter.report(context.Background(), cfg, 1, config.TemplateTriggerFailed, "/test", "new")
+			assert.NoError(t, err)
+			if assert.Len(t, edited, 1) {
+				assert.Equal(t, 1, strings.Count(edited[0], descriptionStartMarker))
+				for _, expected := range tc.expected {
+					assert.Contains(t, edited[0], expected)
+				}
+				for _, notExpected := range tc.notExpected {
+					assert.NotContains(t, edited[0], notExpected)
+				}
+			}
+		})
+	}
+}
+
+func Test_checkRunChannel(t *testing.T) {
+	var checkRuns []*github.CheckRun
+	var created []github.CreateCheckRunOptions
+	var updated []github.UpdateCheckRunOptions
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.PullRequest{Number: github.Ptr(1), Head: &github.PullRequestBranch{SHA: github.Ptr("sha")}})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/commits/sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, feedbackCheckRunName, r.FormValue("check_name"))
+		_ = json.NewEncoder(w).Encode(github.ListCheckRunsResults{Total: github.Ptr(len(checkRuns)), CheckRuns: checkRuns})
+	})
+	mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.CreateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		created = append(created, opts)
+		checkRuns = append(checkRuns, &github.CheckRun{ID: github.Ptr(int64(1)), ExternalID: opts.ExternalID, Output: opts.Output})
+		_ = json.NewEncoder(w).Encode(checkRuns[0])
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/check-runs/1", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.UpdateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		updated = append(updated, opts)
+		checkRuns[0].Output = opts.Output
+		_ = json.NewEncoder(w).Encode(checkRuns[0])
+	})
+	commenter := newFeedbackChannelTestCommenter(t, mux)
+	channel := commenter.channel(config.ChannelCheckRun, false)
+
+	assert.NoError(t, channel.post(context.Background(), 1, "/test", "| `ci.yaml` <!-- ariane:run:42 --> | ✅ Triggered |"))
+	assert.NoError(t, channel.post(context.Background(), 1, "/lint", "Command /lint not found"))
+	assert.NoError(t, channel.edit(context.Background(), 1, func(body string) (string, bool) {
+		return strings.ReplaceAll(body, "✅ Triggered", "✅ Success"), true
+	}))
+
+	if assert.Len(t, created, 1) {
+		assert.Equal(t, "sha", created[0].HeadSHA)
+		assert.Equal(t, feedbackExternalID, created[0].GetExternalID())
+		assert.Equal(t, "neutral", created[0].GetConclusion())
+		assert.Equal(t, "Feedback on /test", created[0].Output.GetTitle())
+	}
+	if assert.Len(t, updated, 2) {
+		assert.Equal(t, "Feedback on /lint", updated[0].Output.GetTitle())
+		assert.Equal(t, "Feedback on /lint", updated[1].Output.GetTitle())
+		summary := updated[1].Output.GetSummary()
+		assert.Contains(t, summary, "<!-- ariane:section %2Ftest -->\n| `ci.yaml` <!-- ariane:run:42 --> | ✅ Success |")
+		assert.Contains(t, summary, "<!-- ariane:section %2Flint -->\nCommand /lint not found\n")
+		assert.NotContains(t, summary, stickyCommentMarker)
+	}
+}
+
+func Test_checkRunChannel_Truncation(t *testing.T) {
+	var summary string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.PullRequest{Number: github.Ptr(1), Head: &github.PullRequestBranch{SHA: github.Ptr("sha")}})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/commits/sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		checkRun := &github.CheckRun{ID: github.Ptr(int64(1)), ExternalID: github.Ptr(feedbackExternalID), Output: &github.CheckRunOutput{Summary: github.Ptr(summary)}}
+		_ = json.NewEncoder(w).Encode(github.ListCheckRunsResults{Total: github.Ptr(1), CheckRuns: []*github.CheckRun{checkRun}})
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/check-runs/1", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.UpdateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		summary = opts.Output.GetSummary()
+		_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr(int64(1))})
+	})
+	commenter := newFeedbackChannelTestCommenter(t, mux)
+	channel := commenter.channel(config.ChannelCheckRun, false)
+
+	assert.NoError(t, channel.post(context.Background(), 1, "/test", strings.Repeat("x", 40000)))
+	assert.NoError(t, channel.post(context.Background(), 1, "/test", strings.Repeat("y", 40000)))
+	assert.LessOrEqual(t, len(summary), checkRunSummaryLimit)
+	assert.True(t, strings.Contains(summary, strings.Repeat("y", 40000)))
+	assert.False(t, strings.Contains(summary, "x"), "the history is dropped to fit in the summary")
+
+	assert.NoError(t, channel.post(context.Background(), 1, "/lint", strings.Repeat("ç", 20000)))
+	assert.LessOrEqual(t, len(summary), checkRunSummaryLimit)
+	assert.Greater(t, len(summary), checkRunSummaryLimit-utf8.UTFMax)
+	assert.True(t, strings.HasSuffix(summary, checkRunTruncatedNote))
+	assert.True(t, utf8.ValidString(summary))
+}
+
+func Test_noneChannel(t *testing.T) {
+	commenter := newFeedbackChannelTestCommenter(t, http.NewServeMux())
+	cfg := &config.ArianeConfig{Feedback: config.FeedbackConfig{Channels: map[string]string{config.FeedbackRejections: config.ChannelNone}}}
+
+	// the mock server serves no endpoint, so posting anything would fail
+	assert.NoError(t, commenter.report(context.Background(), cfg, 1, config.TemplateNotAllowed, "/test", "Comment by user not allowed"))
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+// flakesReportLimit is the maximum number of workflows and jobs listed by the /ariane flakes command
+const flakesReportLimit = 15
+
+// parseFlakesCommand returns whether command is the built-in /ariane flakes [period] command, and the
+// period it asks flake rates for
+func parseFlakesCommand(command string) (bool, time.Duration, error) {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || fields[0] != "/ariane" || fields[1] != "flakes" {
+		return false, 0, nil
+	}
+	switch len(fields) {
+	case 2:
+		return true, flakes.DefaultPeriod, nil
+	case 3:
+		period, err := flakes.ParsePeriod(fields[2])
+		return true, period, err
+	default:
+		return true, 0, fmt.Errorf("unexpected arguments %q", strings.Join(fields[3:], " "))
+	}
+}
+
+// reportFlakes replies to the /ariane flakes command with the flake rates of the repository's
+// workflows and jobs over period, or with the error parsing the command
+func (r *commandRunner) reportFlakes(ctx context.Context, commenter *GithubCommenter, lifecycle *reactionLifecycle, arianeConfig *config.ArianeConfig, req commandRequest, command, headSHA string, period time.Duration, parseErr error) error {
+	if err := lifecycle.transition(ctx, arianeConfig, reactionStateProcessing); err != nil {
+		return err
+	}
+
+	var table string
+	switch {
+	case parseErr != nil:
+		table = fmt.Sprintf("❌ Invalid command `%s`: %v. Usage: `/ariane flakes [period]`, with a period such as `7d` or `72h`.", command, parseErr)
+		r.record(ctx, arianeConfig, req, headSHA, command, commandRejected, parseErr.Error())
+		_ = lifecycle.transition(ctx, arianeConfig, reactionStateFailed)
+	case r.flakeStore == nil:
+		table = "ℹ️ Flakiness history is not recorded by this Ariane instance."
+		r.record(ctx, arianeConfig, req, headSHA, command, commandRejected, "flakiness history is not recorded")
+		_ = lifecycle.transition(ctx, arianeConfig, reactionStateFailed)
+	default:
+		rates := r.flakeStore.Rates(req.owner+"/"+req.repo, time.Now().Add(-period))
+		table = buildFlakesReport(rates, period)
+		r.record(ctx, arianeConfig, req, headSHA, command, commandAccepted, "flakes report")
+		if err := lifecycle.transition(ctx, arianeConfig, reactionStateTriggered); err != nil {
+			return err
+		}
+	}
+
+	comment := feedbackMessage(arianeConfig, config.TemplateFlakesReport, config.FeedbackData{Author: req.author, Command: command, Table: table}, r.logger)
+	return commenter.report(ctx, arianeConfig, req.prNumber, config.TemplateFlakesReport, command, comment)
+}
+
+// formatPeriod renders period in days when it is a whole number of days
+func formatPeriod(period time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case period == day:
+		return "day"
+	case period%day == 0:
+		return fmt.Sprintf("%d days", period/day)
+	default:
+		return period.String()
+	}
+}
+
+// buildFlakesReport renders the flaky workflows and jobs among rates, most flaky first
+func buildFlakesReport(rates []flakes.Rate, period time.Duration) string {
+	var flaky []flakes.Rate
+	for _, rate := range rates {
+		if rate.Flaky > 0 {
+			flaky = append(flaky, rate)
+		}
+	}
+	if len(flaky) == 0 {
+		return fmt.Sprintf("✅ No flaky workflow runs over the last %s.", formatPeriod(period))
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "📉 Flaky workflows over the last %s:\n\n", formatPeriod(period))
+	builder.WriteString("| Workflow | Job | Runs | Flaky | Failed | Flake rate |\n|----------|-----|------|-------|--------|------------|\n")
+	for i, rate := range flaky {
+		if i == flakesReportLimit {
+			fmt.Fprintf(&builder, "\n... and %d more\n", len(flaky)-flakesReportLimit)
+			break
+		}
+		job := ""
+		if rate.Job != "" {
+			job = fmt.Sprintf("`%s`", strings.ReplaceAll(escapeTableCell(rate.Job), "`", "'"))
+		}
+		fmt.Fprintf(&builder, "| `%s` | %s | %d | %d | %d | %.1f%% |\n",
+			strings.ReplaceAll(escapeTableCell(rate.Workflow), "`", "'"), job, rate.Runs, rate.Flaky, rate.Failures, rate.FlakeRate*100)
+	}
+	return builder.String()
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+func Test_parseFlakesCommand(t *testing.T) {
+	testCases := []struct {
+		command        string
+		expectedOk     bool
+		expectedPeriod time.Duration
+		expectedErr    bool
+	}{
+		{command: "/ariane flakes", expectedOk: true, expectedPeriod: flakes.DefaultPeriod},
+		{command: "/ariane  flakes 7d", expectedOk: true, expectedPeriod: 7 * 24 * time.Hour},
+		{command: "/ariane flakes 12h", expectedOk: true, expectedPeriod: 12 * time.Hour},
+		{command: "/ariane flakes soon", expectedOk: true, expectedErr: true},
+		{command: "/ariane flakes 7d e2e", expectedOk: true, expectedErr: true},
+		{command: "/ariane flakesx"},
+		{command: "/test"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.command, func(t *testing.T) {
+			ok, period, err := parseFlakesCommand(tc.command)
+			assert.Equal(t, tc.expectedOk, ok)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPeriod, period)
+		})
+	}
+}
+
+func Test_buildFlakesReport(t *testing.T) {
+	rates := []flakes.Rate{
+		{Repository: "owner/repo", Workflow: "e2e", Runs: 4, Failures: 1, Flaky: 2, FlakeRate: 0.5},
+		{Repository: "owner/repo", Workflow: "e2e", Job: "test | 1", Runs: 4, Flaky: 2, FlakeRate: 0.5},
+		{Repository: "owner/repo", Workflow: "lint", Runs: 3},
+	}
+	assert.Equal(t, "📉 Flaky workflows over the last 7 days:\n\n"+
+		"| Workflow | Job | Runs | Flaky | Failed | Flake rate |\n|----------|-----|------|-------|--------|------------|\n"+
+		"| `e2e` |  | 4 | 2 | 1 | 50.0% |\n"+
+		"| `e2e` | `test \\| 1` | 4 | 2 | 0 | 50.0% |\n",
+		buildFlakesReport(rates, 7*24*time.Hour))
+
+	assert.Equal(t, "✅ No flaky workflow runs over the last 36h0m0s.", buildFlakesReport(rates[2:], 36*time.Hour))
+}
+
+func TestWorkflowRunHandler_RecordsFlakes(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+	configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		return &config.ArianeConfig{RerunConfig: &config.RerunConfig{MaxRetries: 3}}, nil
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+			Number: github.Ptr(1),
+			User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+		}})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(1)})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&github.Jobs{
+			TotalCount: github.Ptr(2),
+			Jobs: []*github.WorkflowJob{
+				{ID: github.Ptr[int64](1), Name: github.Ptr("build"), Conclusion: github.Ptr("success")},
+				{ID: github.Ptr[int64](2), Name: github.Ptr("unit"), Conclusion: github.Ptr("failure")},
+			},
+		})
+	})
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil).Times(2)
+
+	store, err := flakes.Open("")
+	if err != nil {
+		t.Fatalf("Failed to open flakes store: %v", err)
+	}
+	handler := &WorkflowRunHandler{
+		Config: Config{
+			ClientCreator: mockClientCreator,
+			FlakeStore:    store,
+		},
+	}
+
+	payload := func(conclusion string, attempt int) []byte {
+		return []byte(`{
+			"action": "completed",
+			"workflow": {
+				"name": "test-workflow",
+				"path": ".github/workflows/test.yaml"
+			},
+			"workflow_run": {
+				"id": 123,
+				"run_attempt": ` + strconv.Itoa(attempt) + `,
+				"head_sha": "abc123",
+				"conclusion": "` + conclusion + `",
+				"pull_requests": [
+					{
+						"number": 1
+					}
+				]
+			},
+			"repository": {
+				"owner": {
+					"login": "owner"
+				},
+				"name": "repo"
+			},
+			"installation": {
+				"id": 1
+			}
+		}`)
+	}
+
+	assert.NoError(t, handler.Handle(context.Background(), "workflow_run", "deliveryID", payload("failure", 1)))
+	assert.NoError(t, handler.Handle(context.Background(), "workflow_run", "deliveryID", payload("success", 2)))
+
+	assert.Equal(t, []flakes.Rate{
+		{Repository: "owner/repo", Workflow: "test-workflow", Runs: 1, Flaky: 1, Reruns: 1, FlakeRate: 1},
+		{Repository: "owner/repo", Workflow: "test-workflow", Job: "unit", Runs: 1, Flaky: 1, FlakeRate: 1},
+	}, store.Rates("owner/repo", time.Now().Add(-time.Hour)))
+}
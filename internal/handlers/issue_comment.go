@@ -9,7 +9,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v88/github"
@@ -23,9 +24,103 @@ import (
 var configGetArianeConfigFromRepository = config.GetArianeConfigFromRepository
 
 type PRCommentHandler struct {
-	githubapp.ClientCreator
-	RunDelay         time.Duration
-	MaxRetryAttempts int
+	Config
+
+	history commandHistory
+}
+
+// commandHistoryLimit is the number of comments for which handled commands are remembered
+const commandHistoryLimit = 1000
+
+// commandState is the state of a command of a comment in the command history
+type commandState int
+
+const (
+	commandStateInProgress commandState = iota + 1
+	commandStateHandled
+	commandStateFailed
+)
+
+// commandHistory remembers the state of the commands of a given comment, so that edits (or redeliveries
+// of the same event) do not replay a command which was already handled, while a command which failed
+// can be retried by editing the comment
+type commandHistory struct {
+	mu       sync.Mutex
+	order    []int64
+	commands map[int64]map[string]commandState
+}
+
+// claim marks the given commands of commentID as in progress, and returns the ones which were neither
+// handled nor in progress already
+func (h *commandHistory) claim(commentID int64, commands []string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.commands == nil {
+		h.commands = make(map[int64]map[string]commandState)
+	}
+	states, ok := h.commands[commentID]
+	if !ok {
+		states = make(map[string]commandState)
+		h.commands[commentID] = states
+		h.order = append(h.order, commentID)
+		if len(h.order) > commandHistoryLimit {
+			delete(h.commands, h.order[0])
+			h.order = h.order[1:]
+		}
+	}
+
+	var claimed []string
+	for _, command := range commands {
+		if state := states[command]; state == commandStateInProgress || state == commandStateHandled {
+			continue
+		}
+		states[command] = commandStateInProgress
+		claimed = append(claimed, command)
+	}
+	return claimed
+}
+
+// done records whether command of commentID was handled successfully
+func (h *commandHistory) done(commentID int64, command string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if states, ok := h.commands[commentID]; ok {
+		states[command] = commandStateHandled
+		if err != nil {
+			states[command] = commandStateFailed
+		}
+	}
+}
+
+// release marks the given commands of commentID which are still in progress as failed, e.g. when they
+// were not handled because the request was rejected or could not be processed
+func (h *commandHistory) release(commentID int64, commands []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, command := range commands {
+		if states, ok := h.commands[commentID]; ok && states[command] == commandStateInProgress {
+			states[command] = commandStateFailed
+		}
+	}
+}
+
+// editedCommands returns the commands to handle for an edited comment: the ones introduced by the edit,
+// and the ones still present whose handling failed, so that editing the comment retries them
+func (h *commandHistory) editedCommands(commentID int64, oldBody, newBody string) []string {
+	commands := newCommands(oldBody, newBody)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, command := range commentCommands(newBody) {
+		if h.commands[commentID][command] == commandStateFailed && !slices.Contains(commands, command) {
+			commands = append(commands, command)
+		}
+	}
+	return commands
 }
 
 type workflowStatusType string
@@ -41,6 +136,18 @@ const (
 type workflowStatus struct {
 	name   string
 	status workflowStatusType
+	// reason explains the status, e.g. why the workflow was skipped
+	reason string
+	// trigger and sender are the trigger phrase and the user which caused the workflow to run
+	trigger string
+	sender  string
+	// runID, runURL and attempt describe the run created by the dispatch, once found
+	runID   int64
+	runURL  string
+	attempt int
+	// conclusion and duration are set once the run completes
+	conclusion string
+	duration   time.Duration
 }
 
 func (h *PRCommentHandler) Handles() []string {
@@ -65,130 +172,68 @@ func (h *PRCommentHandler) Handle(ctx context.Context, eventType, deliveryID str
 	ctx, logger := githubapp.PreparePRContext(ctx, installationID, repository, prNumber)
 	ctx = log.WithLogger(ctx, &logger)
 
-	// only handle new comments
-	logger.Debug().Msgf("Event action is %s", event.GetAction())
-	if event.GetAction() != "created" {
-		return nil
-	}
-
-	client, err := h.NewInstallationClient(installationID)
-	if err != nil {
-		return err
-	}
-
-	repositoryOwner := repository.GetOwner().GetLogin()
-	repositoryName := repository.GetName()
 	commentID := event.GetComment().GetID()
-	commentAuthor := event.GetComment().GetUser().GetLogin()
 	commentBody := event.GetComment().GetBody()
 
-	var botUser bool
-
-	// skip all comments that do not start with / (with optional leading whitespace)
-	if !strings.HasPrefix(strings.TrimSpace(commentBody), "/") {
+	// only handle new comments, and edited comments that introduce a new command or still hold a
+	// command which failed
+	logger.Debug().Msgf("Event action is %s", event.GetAction())
+	var commands []string
+	switch event.GetAction() {
+	case "created":
+		commands = newCommands("", commentBody)
+	case "edited":
+		commands = h.history.editedCommands(commentID, event.GetChanges().GetBody().GetFrom(), commentBody)
+	default:
 		return nil
 	}
-
-	commenter := NewGithubCommenter(client, repositoryOwner, repositoryName, logger)
-
-	// only handle non-bot comments
-	if strings.HasSuffix(commentAuthor, "[bot]") {
-		if !strings.HasPrefix(commentAuthor, repositoryOwner) {
-			comment := fmt.Sprintf("Issue comment was created by an unsupported bot: %s", commentAuthor)
-			logger.Debug().Msg(comment)
-			_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
-			return nil
-		}
-		botUser = true
-	}
-
-	// Get PR metadata and validate PR author permissions
-	pr, err := getPullRequest(ctx, client, repositoryOwner, repositoryName, prNumber, logger, h.MaxRetryAttempts)
-	if err != nil {
-		comment := fmt.Sprintf("Failed to retrieve pull request: %v", err)
-		logger.Error().Err(err).Msg(comment)
-		_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
-		return err
-	}
-
-	contextRef, headSHA, baseSHA := determineContextRef(pr, repositoryOwner, repositoryName, logger)
-
-	// retrieve Ariane configuration (triggers, etc.) from repository based on chosen context
-	arianeConfig, err := configGetArianeConfigFromRepository(client, ctx, repositoryOwner, repositoryName, contextRef)
-	if err != nil {
-		comment := "Failed to retrieve config file"
-		logger.Error().Err(err).Msg(comment)
-		_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
-		return err
-	}
-
-	// only handle comments coming from an allowed organization, if specified
-	if !botUser && !isAllowedTeamMember(ctx, client, arianeConfig, repositoryOwner, commentAuthor, logger) {
-		// TODO It would be beneficial to provide feedback indicating that the test run was rejected.
-		// Initially considered updating the comment with a "no entry" emoji, but given the limited
-		// selection of emojis that can be used, none appeared to be entirely fitting.
-		// Maybe alternative feedback mechanisms should be explored to communicate the rejection status clearly.
-		if arianeConfig.GetVerbose() {
-			comment := fmt.Sprintf("Comment by %s not allowed", commentAuthor)
-			_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
-		}
+	if len(commands) == 0 {
+		logger.Debug().Msg("Comment does not contain any new command")
 		return nil
 	}
 
-	// only handle comments matching a registered trigger, and retrieve associated list of workflows to trigger
-	submatch, workflowsToTrigger, dependsOn := arianeConfig.CheckForTrigger(ctx, commentBody)
-	// the command on commentBody (e.g. /test-this) does not match any "triggers"
-	if submatch == nil {
-		if arianeConfig.GetVerbose() {
-			comment := fmt.Sprintf("Command %s not found", commentBody)
-			_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
-		}
+	// never replay a command that was already handled for this comment
+	commands = h.history.claim(commentID, commands)
+	if len(commands) == 0 {
+		logger.Debug().Msgf("Commands of comment %d were already handled", commentID)
 		return nil
 	}
+	defer h.history.release(commentID, commands)
 
-	if err := commenter.reactToComment(ctx, commentID, "eyes"); err != nil {
-		return err
-	}
-
-	processor := WorkflowProcessor{
-		client:       client,
-		owner:        repositoryOwner,
-		repo:         repositoryName,
-		arianeConfig: arianeConfig,
-		logger:       logger,
-		runDelay:     h.RunDelay,
-	}
-
-	err = processor.processWorkflowsForTrigger(ctx, submatch, prNumber, contextRef, headSHA, baseSHA, workflowsToTrigger, dependsOn, commenter)
+	client, err := h.NewInstallationClient(installationID)
 	if err != nil {
-		var comment string
-		skippedError, ok := err.(TriggerSkippedDependencyInProgressError)
-		if ok {
-			comment = skippedError.Error()
-			logger.Debug().Err(skippedError).Msg(comment)
-			commentErr := commenter.reactToComment(ctx, commentID, "+1")
-			if commentErr != nil {
-				logger.Error().Err(skippedError).Msg("Failed to react to comment with thumbs up emoji")
-			}
-		} else {
-			comment = fmt.Sprintf("Failed to process workflows for trigger: %s", err.Error())
-			logger.Error().Err(err).Msg(comment)
-			commentErr := commenter.reactToComment(ctx, commentID, "confused")
-			if commentErr != nil {
-				logger.Error().Err(err).Msg("Failed to react to comment with confused emoji")
-			}
-		}
-		if arianeConfig.GetVerbose() {
-			_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
-		}
 		return err
 	}
 
-	if err := commenter.reactToComment(ctx, commentID, "rocket"); err != nil {
-		return err
-	}
+	repositoryOwner := repository.GetOwner().GetLogin()
+	repositoryName := repository.GetName()
 
-	return nil
+	runner := commandRunner{
+		client:           client,
+		runDelay:         h.RunDelay,
+		maxRetryAttempts: h.MaxRetryAttempts,
+		flakeStore:       h.FlakeStore,
+		scheduler:        h.Scheduler,
+		installationID:   installationID,
+		appID:            h.AppID,
+		dispatchedRuns:   h.DispatchedRuns,
+		botLogin:         h.BotLogin,
+		logger:           logger,
+	}
+	return runner.run(ctx, commandRequest{
+		source:   "Issue comment",
+		owner:    repositoryOwner,
+		repo:     repositoryName,
+		prNumber: prNumber,
+		author:   commandAuthor(event.GetAction(), event.GetComment().GetUser(), event.GetSender()),
+		target:   reactionTarget{kind: reactionTargetIssueComment, id: commentID},
+		commands: func(*config.ArianeConfig) []string { return commands },
+		done: func(command string, err error) {
+			h.history.done(commentID, command, err)
+		},
+		// an edited comment still holds the reaction of its previous commands
+		replacePriorReactions: event.GetAction() == "edited",
+	})
 }
 
 // getPullRequest returns a PR object to retrieve a pull request metadata
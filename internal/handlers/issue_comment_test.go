@@ -7,13 +7,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"strings"
-	"sync"
 	"testing"
 	"time"
 
@@ -36,9 +36,11 @@ func TestHandle_NotaPR(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Times(0)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -72,18 +74,23 @@ func TestHandle_ActionNotCreated(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Times(0)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
-	// Action can be created, edited, or delited
-	// The GHApp only reacts to "created"
+	// Action can be created, edited, or deleted
+	// The GHApp only reacts to "created", and to "edited" when the edit introduces a new command
 	// https://docs.github.com/en/rest/using-the-rest-api/github-event-types?apiVersion=2022-11-28#issuecommentevent
 	payload := []byte(`{
 		"issue": {
 			"pull_request": {}
 		},
 		"action": "edited",
+		"sender": {
+			"login": "user"
+		},
 		"repository": {
 			"owner": {
 				"login": "owner"
@@ -103,7 +110,265 @@ func TestHandle_ActionNotCreated(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHandle_EditedCommentUnchangedCommand(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Times(0)
+
+	handler := &PRCommentHandler{
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
+	}
+
+	// only the text around the command changed, the command must not be replayed
+	payload := []byte(`{
+		"issue": {
+			"pull_request": {}
+		},
+		"action": "edited",
+		"sender": {
+			"login": "user"
+		},
+		"changes": {
+			"body": {
+				"from": "/test\nplease"
+			}
+		},
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"comment": {
+			"id": 1,
+			"user": {
+				"login": "user"
+			},
+			"body": "/test\nplease, pretty please"
+		}
+	}`)
+
+	err := handler.Handle(context.Background(), "issue_comment", "deliveryID", payload)
+	assert.NoError(t, err)
+}
+
+func TestHandle_EditedCommentNewCommand(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+
+	reactions := make([]string, 0, 10)
+	server := setMockServerWithFeedbackConfig(false, false, &reactions, false, false)
+	defer server.Close()
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil).Times(1)
+
+	handler := &PRCommentHandler{
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
+	}
+
+	// fixing a typo in the command triggers it
+	payload := []byte(`{
+		"issue": {
+			"pull_request": {},
+			"number": 0
+		},
+		"action": "edited",
+		"sender": {
+			"login": "user"
+		},
+		"changes": {
+			"body": {
+				"from": "/tset"
+			}
+		},
+		"comment": {
+			"id": 1,
+			"body": "/test",
+			"user": {
+				"login": "user"
+			}
+		},
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"installation": {
+			"id": 0
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "issue_comment", "1", payload)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"eyes", "rocket"}, reactions)
+
+	// a redelivery of the same edit does not replay the command
+	err = handler.Handle(context.Background(), "issue_comment", "2", payload)
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"eyes", "rocket"}, reactions)
+}
+
+func TestHandle_EditedCommentSender(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+
+	configGetArianeConfigFromRepository = mockGetArianeConfigFromRepository
+
+	mockServer := setMockServer()
+	defer mockServer.Close()
+	var members []string
+	mux := mockServer.Config.Handler
+	mockServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if member, ok := strings.CutPrefix(r.URL.Path, "/orgs/owner/teams/organization-members/memberships/"); ok {
+			members = append(members, member)
+		}
+		mux.ServeHTTP(w, r)
+	})
+	mockURL := github.Ptr(mockServer.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
+
+	handler := &PRCommentHandler{
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
+	}
+
+	// the comment of a trusted author is edited by someone who is not allowed to run commands
+	payload := []byte(`{
+		"issue": {
+			"pull_request": {}
+		},
+		"action": "edited",
+		"sender": {
+			"login": "unknownauthor"
+		},
+		"changes": {
+			"body": {
+				"from": "LGTM"
+			}
+		},
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"comment": {
+			"id": 1,
+			"user": {
+				"login": "trustedauthor"
+			},
+			"body": "LGTM\n/test"
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "issue_comment", "deliveryID", payload)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"unknownauthor"}, members, "the permissions of the sender of the edit are checked")
+}
+
+func Test_newCommands(t *testing.T) {
+	testCases := []struct {
+		name     string
+		oldBody  string
+		newBody  string
+		expected []string
+	}{
+		{
+			name:     "typo fixed",
+			oldBody:  "/tset",
+			newBody:  "/test",
+			expected: []string{"/test"},
+		},
+		{
+			name:     "unchanged command",
+			oldBody:  "/test",
+			newBody:  " /test ",
+			expected: nil,
+		},
+		{
+			name:     "command added to prose",
+			oldBody:  "LGTM",
+			newBody:  "LGTM\n/test\n/test",
+			expected: []string{"/test"},
+		},
+		{
+			name:     "command removed",
+			oldBody:  "/test\n/ci-e2e",
+			newBody:  "/test",
+			expected: nil,
+		},
+		{
+			name:     "no previous body",
+			oldBody:  "",
+			newBody:  "/test",
+			expected: []string{"/test"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, newCommands(tc.oldBody, tc.newBody))
+		})
+	}
+}
+
+func Test_commandHistory(t *testing.T) {
+	var history commandHistory
+
+	assert.Equal(t, []string{"/test"}, history.claim(1, []string{"/test"}))
+	assert.Empty(t, history.claim(1, []string{"/test"}), "a command in progress is not claimed again")
+	history.done(1, "/test", nil)
+	assert.Empty(t, history.claim(1, []string{"/test"}), "a handled command is not replayed")
+	assert.Equal(t, []string{"/ci-e2e"}, history.claim(1, []string{"/test", "/ci-e2e"}))
+	history.done(1, "/ci-e2e", errors.New("dispatch failed"))
+	assert.Equal(t, []string{"/test"}, history.claim(2, []string{"/test"}))
+
+	// commands which were not handled are released as failed
+	assert.Equal(t, []string{"/lint"}, history.claim(1, []string{"/lint"}))
+	history.release(1, []string{"/test", "/lint"})
+
+	// failed commands still present are retried by editing the comment
+	assert.Equal(t, []string{"/build", "/ci-e2e", "/lint"}, history.editedCommands(1, "/test\n/ci-e2e\n/lint", "/test\n/ci-e2e\n/lint\n/build"))
+	assert.Equal(t, []string{"/ci-e2e", "/lint"}, history.claim(1, []string{"/ci-e2e", "/lint"}))
+	assert.Equal(t, []string{"/test"}, history.editedCommands(3, "/tset", "/test"))
+
+	for id := int64(3); id < commandHistoryLimit+3; id++ {
+		history.claim(id, []string{"/test"})
+	}
+	// oldest comments are forgotten once the limit is reached
+	assert.Equal(t, []string{"/test"}, history.claim(1, []string{"/test"}))
+}
+
 func TestHandle_IsInvalidBot(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+
+	configGetArianeConfigFromRepository = mockGetArianeConfigFromRepository
+
 	mockServer := setMockServer()
 	defer mockServer.Close()
 	mockURL := github.Ptr(mockServer.URL + "/")
@@ -117,9 +382,11 @@ func TestHandle_IsInvalidBot(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -138,12 +405,171 @@ func TestHandle_IsInvalidBot(t *testing.T) {
 			"user": {
 				"login": "user [bot]"
 			},
-			"body": "trigger"
+			"body": "/test"
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "issue_comment", "deliveryID", payload)
+	assert.NoError(t, err)
+}
+
+func TestHandle_IsInvalidBotFeedbackChannel(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+	configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		return &config.ArianeConfig{
+			Feedback: config.FeedbackConfig{
+				CheckRun: github.Ptr(true),
+				Channels: map[string]string{config.FeedbackRejections: config.ChannelNone},
+			},
+			Triggers: map[string]config.TriggerConfig{
+				"/test": {Workflows: []string{"foo.yaml"}},
+			},
+		}, nil
+	}
+
+	var outputs []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.PullRequest{
+			State: github.Ptr("open"),
+			Head:  &github.PullRequestBranch{SHA: github.Ptr("abc123"), Ref: github.Ptr("feature-branch")},
+		})
+	})
+	mux.HandleFunc("/repos/owner/repo/commits/abc123/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.ListCheckRunsResults{Total: github.Ptr(0)})
+	})
+	mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		var body github.CreateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		outputs = append(outputs, body.Output.GetSummary())
+		_ = json.NewEncoder(w).Encode(github.CheckRun{ID: github.Ptr(int64(1))})
+	})
+	mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the rejection of an unsupported bot must be reported through the configured channel")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
+
+	handler := &PRCommentHandler{
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
+	}
+
+	payload := []byte(`{
+		"issue": {
+			"number": 1,
+			"pull_request": {}
+		},
+		"action": "created",
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"comment": {
+			"id": 1,
+			"user": {
+				"login": "user [bot]"
+			},
+			"body": "/test"
 		}
 	}`)
 
 	err = handler.Handle(context.Background(), "issue_comment", "deliveryID", payload)
 	assert.NoError(t, err)
+	if assert.Len(t, outputs, 1) {
+		assert.Contains(t, outputs[0], "| `/test` | @user [bot] | Issue comment | ⛔ Rejected | user [bot] is an unsupported bot |")
+	}
+}
+
+func TestHandle_ConfigFailedTemplate(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+	configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		if ref != "" {
+			return nil, errors.New("invalid config file")
+		}
+		return &config.ArianeConfig{Feedback: config.FeedbackConfig{Templates: map[string]string{
+			config.TemplateConfigFailed: "{{.Source}} by @{{.Author}} ignored: {{.Reason}}",
+		}}}, nil
+	}
+
+	var comments []string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls/1", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.PullRequest{
+			State: github.Ptr("open"),
+			Head: &github.PullRequestBranch{
+				SHA:  github.Ptr("abc123"),
+				Ref:  github.Ptr("feature-branch"),
+				Repo: &github.Repository{Owner: &github.User{Login: github.Ptr("owner")}, Name: github.Ptr("repo")},
+			},
+		})
+	})
+	mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		var comment github.IssueComment
+		_ = json.NewDecoder(r.Body).Decode(&comment)
+		comments = append(comments, comment.GetBody())
+		_ = json.NewEncoder(w).Encode(github.IssueComment{ID: github.Ptr(int64(2))})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
+
+	handler := &PRCommentHandler{
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
+	}
+
+	payload := []byte(`{
+		"issue": {
+			"number": 1,
+			"pull_request": {}
+		},
+		"action": "created",
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"comment": {
+			"id": 1,
+			"user": {
+				"login": "user"
+			},
+			"body": "/test"
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "issue_comment", "deliveryID", payload)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"Issue comment by @user ignored: invalid config file"}, comments)
 }
 
 func TestHandle_IsValidBot(t *testing.T) {
@@ -165,9 +591,11 @@ func TestHandle_IsValidBot(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -186,7 +614,7 @@ func TestHandle_IsValidBot(t *testing.T) {
 			"user": {
 				"login": "owner-test [bot]"
 			},
-			"body": "trigger"
+			"body": "/trigger"
 		}
 	}`)
 
@@ -213,9 +641,11 @@ func TestHandle(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -308,9 +738,11 @@ func Test_rerunFailedJobs(t *testing.T) {
 	mockClientCreator := NewMockClientCreator(mockCtrl)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second * 30000,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second * 30000,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	logWriter := &LogWriter{}
@@ -325,9 +757,10 @@ func Test_rerunFailedJobs(t *testing.T) {
 		runDelay:     handler.RunDelay,
 	}
 
-	var wg sync.WaitGroup
-	processor.rerunFailedJobs(context.Background(), "foobar.yaml", int64(99), &wg)
-	wg.Wait()
+	processor.rerunFailedJobs(context.Background(), "foobar.yaml", int64(99))
+	if err := processor.reruns.wait(); err != nil {
+		t.Errorf("Test_rerunFailedJobs failed. Unexpected error: %v", err)
+	}
 	var result struct {
 		Level   string `json:"level,omitempty"`
 		Message string `json:"message,omitempty"`
@@ -341,8 +774,7 @@ func Test_rerunFailedJobs(t *testing.T) {
 		t.Errorf(`Test_rerunFailedJobs failed.
 				result: %s, expected: %s`, result, expected)
 	}
-	// TODO(auriaave): Cover when "Commit Status Start" job is found
-	// This part will need extra implementation on mockServer (to respond with an appropriate job)
+	// Pre-rerun jobs, e.g. "Commit Status Start", are covered by TestWorkflowProcessor_rerunSequence
 }
 
 func Test_shouldSkipWorkflow(t *testing.T) {
@@ -358,9 +790,11 @@ func Test_shouldSkipWorkflow(t *testing.T) {
 	mockClientCreator := NewMockClientCreator(mockCtrl)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	var logger zerolog.Logger
@@ -803,9 +1237,11 @@ func TestHandle_WorkflowStatusTable(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -1030,9 +1466,11 @@ func TestHandle_FeedbackDisabled(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -1089,9 +1527,11 @@ func TestHandle_VerboseEnabled(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -1148,9 +1588,11 @@ func TestHandle_WorkflowsReportEnabled(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -1208,9 +1650,11 @@ func TestHandle_WorkflowsReportDisabled(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -1262,9 +1706,11 @@ func TestHandle_WorkflowsDependencyRunningReaction(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -1301,6 +1747,75 @@ func TestHandle_WorkflowsDependencyRunningReaction(t *testing.T) {
 	assert.EqualValues(t, []string{"eyes", "+1"}, reactions)
 }
 
+func TestHandle_CustomReactions(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+	configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		return &config.ArianeConfig{
+			Feedback: config.FeedbackConfig{
+				Reactions: map[string]string{
+					config.ReactionProcessing:           "heart",
+					config.ReactionDependencyInProgress: "hooray",
+				},
+			},
+			Triggers: map[string]config.TriggerConfig{
+				"/test":       {Workflows: []string{"foo.yaml"}, DependsOn: []string{"/dependency"}},
+				"/dependency": {Workflows: []string{"bar.yaml"}},
+			},
+		}, nil
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+
+	reactions := make([]string, 0, 10)
+	server := setMockServerWithFeedbackConfig(false, false, &reactions, true, true)
+	defer server.Close()
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
+
+	handler := &PRCommentHandler{
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
+	}
+
+	payload := []byte(`{
+		"issue": {
+			"pull_request": {},
+			"number": 0
+		},
+		"action": "created",
+		"comment": {
+			"id": 1,
+			"body": "/test",
+			"user": {
+				"login": "user"
+			}
+		},
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"installation": {
+			"id": 0
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "issue_comment", "1", payload)
+	assert.Error(t, err)
+	assert.EqualValues(t, []string{"heart", "hooray"}, reactions)
+}
+
 func TestHandle_WorkflowsDependencyFailedReaction(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	mockClientCreator := NewMockClientCreator(mockCtrl)
@@ -1317,9 +1832,11 @@ func TestHandle_WorkflowsDependencyFailedReaction(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
 
 	handler := &PRCommentHandler{
-		ClientCreator:    mockClientCreator,
-		RunDelay:         time.Second,
-		MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		Config: Config{
+			ClientCreator:    mockClientCreator,
+			RunDelay:         time.Second,
+			MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+		},
 	}
 
 	payload := []byte(`{
@@ -1496,8 +2013,8 @@ workflows:
 		_ = json.NewEncoder(w).Encode(&comment)
 	})
 
-	// Mock reactions endpoint
-	mux.HandleFunc("/repos/owner/repo/issues/comments/1/reactions", func(w http.ResponseWriter, r *http.Request) {
+	// Mock reactions endpoints (issue comment, pull request review comment and pull request)
+	reactionHandler := func(w http.ResponseWriter, r *http.Request) {
 		bytes, err := io.ReadAll(r.Body)
 		if err != nil {
 			http.Error(w, "setMockServerWithFeedbackConfig: could not read request body", http.StatusInternalServerError)
@@ -1512,7 +2029,10 @@ workflows:
 			ID: github.Ptr(int64(1)),
 		}
 		_ = json.NewEncoder(w).Encode(&reaction)
-	})
+	}
+	mux.HandleFunc("/repos/owner/repo/issues/comments/1/reactions", reactionHandler)
+	mux.HandleFunc("/repos/owner/repo/pulls/comments/1/reactions", reactionHandler)
+	mux.HandleFunc("/repos/owner/repo/issues/0/reactions", reactionHandler)
 
 	return httptest.NewServer(mux)
 }
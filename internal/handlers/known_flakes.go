@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+// compiledFlake is a known flake along with its compiled pattern
+type compiledFlake struct {
+	config.KnownFlake
+	pattern *regexp.Regexp
+}
+
+// compileKnownFlakes compiles the patterns of the known flakes, ignoring invalid ones
+func compileKnownFlakes(flakes []config.KnownFlake, logger zerolog.Logger) []compiledFlake {
+	compiled := make([]compiledFlake, 0, len(flakes))
+	for _, flake := range flakes {
+		pattern, err := regexp.Compile(flake.Pattern)
+		if err != nil || flake.Pattern == "" {
+			logger.Warn().Err(err).Msgf("Ignoring known flake %q with invalid pattern %q", flake.Name, flake.Pattern)
+			continue
+		}
+		compiled = append(compiled, compiledFlake{KnownFlake: flake, pattern: pattern})
+	}
+	return compiled
+}
+
+// matchFlake returns the first flake matching text, or nil
+func matchFlake(text string, flakes []compiledFlake) *compiledFlake {
+	for i := range flakes {
+		if flakes[i].pattern.MatchString(text) {
+			return &flakes[i]
+		}
+	}
+	return nil
+}
+
+// matchKnownFlake returns the known flake matched by the check annotations or the log of a failed job,
+// or nil if the failure does not match any known flake. Annotations are checked first, as they are
+// much cheaper to retrieve than logs.
+func matchKnownFlake(ctx context.Context, client *github.Client, owner, repo string, job *github.WorkflowJob, flakes []compiledFlake) (*config.MatchedFlake, error) {
+	newMatch := func(flake *compiledFlake, match string) *config.MatchedFlake {
+		return &config.MatchedFlake{Job: job.GetName(), Name: flake.Name, Issue: flake.Issue, Match: cleanLogLine(match)}
+	}
+
+	// the check run of a job shares its ID
+	annotations, _, err := client.Checks.ListCheckRunAnnotations(ctx, owner, repo, job.GetID(), &github.ListOptions{PerPage: 100})
+	if err != nil {
+		return nil, err
+	}
+	for _, annotation := range annotations {
+		for _, text := range []string{annotation.GetTitle(), annotation.GetMessage()} {
+			if flake := matchFlake(text, flakes); flake != nil {
+				return newMatch(flake, strings.SplitN(text, "\n", 2)[0]), nil
+			}
+		}
+	}
+
+	log, err := openJobLog(ctx, client, owner, repo, job.GetID())
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+	scanner := newLogScanner(log)
+	for scanner.Scan() {
+		line := logTimestampRegex.ReplaceAllString(scanner.Text(), "")
+		if flake := matchFlake(line, flakes); flake != nil {
+			return newMatch(flake, line), nil
+		}
+	}
+	return nil, scanner.Err()
+}
+
+// matchKnownFlakes returns the known flakes matched by the failed jobs of a run, and whether all of
+// them match one. Jobs whose annotations or logs cannot be retrieved are considered real failures.
+func matchKnownFlakes(ctx context.Context, client *github.Client, owner, repo string, jobs []*github.WorkflowJob, flakes []compiledFlake, logger zerolog.Logger) ([]config.MatchedFlake, bool) {
+	var matched []config.MatchedFlake
+	for _, job := range jobs {
+		match, err := matchKnownFlake(ctx, client, owner, repo, job, flakes)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to match job %s (ID: %d) against known flakes", job.GetName(), job.GetID())
+			return matched, false
+		}
+		if match == nil {
+			logger.Info().Msgf("Failure of job %s (ID: %d) does not match any known flake", job.GetName(), job.GetID())
+			return matched, false
+		}
+		logger.Debug().Msgf("Failure of job %s (ID: %d) matches known flake %q", job.GetName(), job.GetID(), match.Name)
+		matched = append(matched, *match)
+	}
+	return matched, true
+}
+
+// buildRetrySummary renders the retry of a run whose failed jobs match known flakes
+func buildRetrySummary(workflowName string, workflowRun *github.WorkflowRun, attempt int, flakes []config.MatchedFlake) string {
+	var builder strings.Builder
+	name := fmt.Sprintf("`%s`", workflowName)
+	if workflowRun.GetHTMLURL() != "" {
+		name = fmt.Sprintf("[`%s`](%s)", workflowName, workflowRun.GetHTMLURL())
+	}
+	fmt.Fprintf(&builder, "🔁 Rerunning the failed jobs of %s (attempt #%d), as they match known flakes:\n\n", name, attempt)
+	builder.WriteString("| Job | Known flake | Match |\n|-----|-------------|-------|\n")
+	for _, flake := range flakes {
+		known := escapeTableCell(flake.Name)
+		if flake.Issue != "" {
+			known = fmt.Sprintf("[%s](%s)", known, flake.Issue)
+		}
+		match := strings.ReplaceAll(escapeTableCell(flake.Match), "`", "'")
+		fmt.Fprintf(&builder, "| `%s` | %s | `%s` |\n", strings.ReplaceAll(escapeTableCell(flake.Job), "`", "'"), known, match)
+	}
+	return builder.String()
+}
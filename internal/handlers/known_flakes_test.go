@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func TestWorkflowRunHandler_Failure_KnownFlakes(t *testing.T) {
+	knownFlakes := []config.KnownFlake{
+		{Name: "etcd timeout", Pattern: `etcdserver: request timed out`, Issue: "https://github.com/owner/repo/issues/42"},
+		{Name: "runner lost", Pattern: `The runner has received a shutdown signal`},
+	}
+
+	testCases := []struct {
+		name            string
+		logs            map[int64]string
+		expectedRerun   bool
+		expectedComment string
+	}{
+		{
+			name: "all failed jobs match known flakes",
+			logs: map[int64]string{
+				2: "2024-01-02T03:04:05.1234567Z ok\n2024-01-02T03:04:06.1234567Z Error: etcdserver: request timed out\n",
+			},
+			expectedRerun: true,
+			expectedComment: "🔁 Rerunning the failed jobs of [`test-workflow`](https://github.com/owner/repo/actions/runs/123) (attempt #2), as they match known flakes:\n\n" +
+				"| Job | Known flake | Match |\n|-----|-------------|-------|\n" +
+				"| `unit` | [etcd timeout](https://github.com/owner/repo/issues/42) | `Error: etcdserver: request timed out` |\n" +
+				"| `e2e` | runner lost | `The runner has received a shutdown signal.` |\n",
+		},
+		{
+			name: "real failure",
+			logs: map[int64]string{
+				2: "2024-01-02T03:04:05.1234567Z --- FAIL: TestFoo (0.01s)\n",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					RerunConfig: &config.RerunConfig{MaxRetries: 3},
+					KnownFlakes: knownFlakes,
+				}, nil
+			}
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			rerunCalled := false
+			var comments []string
+
+			mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+					Number: github.Ptr(1),
+					User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+				}})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(1)})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+				rerunCalled = true
+				w.WriteHeader(http.StatusCreated)
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Jobs{
+					TotalCount: github.Ptr(3),
+					Jobs: []*github.WorkflowJob{
+						{ID: github.Ptr[int64](1), Name: github.Ptr("build"), Conclusion: github.Ptr("success")},
+						{ID: github.Ptr[int64](2), Name: github.Ptr("unit"), Conclusion: github.Ptr("failure")},
+						{ID: github.Ptr[int64](3), Name: github.Ptr("e2e"), Conclusion: github.Ptr("failure")},
+					},
+				})
+			})
+			mux.HandleFunc("/repos/owner/repo/check-runs/{id}/annotations", func(w http.ResponseWriter, r *http.Request) {
+				var annotations []*github.CheckRunAnnotation
+				if r.PathValue("id") == "3" {
+					annotations = append(annotations, &github.CheckRunAnnotation{
+						Title:   github.Ptr("e2e"),
+						Message: github.Ptr("The runner has received a shutdown signal.\nThis can happen when the runner service is stopped."),
+					})
+				}
+				_ = json.NewEncoder(w).Encode(annotations)
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/jobs/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+				http.Redirect(w, r, fmt.Sprintf("%s/logs/%s", server.URL, r.PathValue("id")), http.StatusFound)
+			})
+			mux.HandleFunc("/logs/{id}", func(w http.ResponseWriter, r *http.Request) {
+				var id int64
+				_, _ = fmt.Sscan(r.PathValue("id"), &id)
+				_, _ = w.Write([]byte(tc.logs[id]))
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				comments = append(comments, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(comment)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator: mockClientCreator,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "completed",
+				"workflow": {
+					"name": "test-workflow",
+					"path": ".github/workflows/test.yaml"
+				},
+				"workflow_run": {
+					"id": 123,
+					"conclusion": "failure",
+					"html_url": "https://github.com/owner/repo/actions/runs/123",
+					"pull_requests": [
+						{
+							"number": 1
+						}
+					]
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRerun, rerunCalled)
+			if tc.expectedComment == "" {
+				assert.Empty(t, comments)
+			} else if assert.Len(t, comments, 1) {
+				assert.Equal(t, tc.expectedComment, comments[0])
+			}
+		})
+	}
+}
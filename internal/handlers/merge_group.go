@@ -7,7 +7,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/cilium/ariane/internal/config"
 	"github.com/cilium/ariane/internal/log"
 	"github.com/google/go-github/v88/github"
 	"github.com/palantir/go-githubapp/githubapp"
@@ -15,6 +21,8 @@ import (
 
 type MergeGroupHandler struct {
 	githubapp.ClientCreator
+	// AppID is the ID of the Ariane app, whose required checks are managed along with the "any source" ones
+	AppID int64
 }
 
 func (*MergeGroupHandler) Handles() []string {
@@ -45,35 +53,143 @@ func (m *MergeGroupHandler) Handle(ctx context.Context, eventType, deliveryID st
 	repositoryOwner := repository.GetOwner().GetLogin()
 	repositoryName := repository.GetName()
 
-	branchRef := event.GetMergeGroup().GetBaseRef()
-	branchPro, _, err := client.Repositories.GetBranchProtection(ctx, repositoryOwner, repositoryName, branchRef)
+	branch := strings.TrimPrefix(event.GetMergeGroup().GetBaseRef(), "refs/heads/")
+	checks, err := requiredStatusChecks(ctx, client, repositoryOwner, repositoryName, branch)
 	if err != nil {
-		logger.Error().Err(err).Msg("Failed to retrieve branch protection rules")
+		logger.Error().Err(err).Msg("Failed to retrieve required status checks")
 		return err
 	}
 
 	headSHA := event.GetMergeGroup().GetHeadSHA()
-	for _, ch := range branchPro.GetRequiredStatusChecks().GetChecks() {
+	var managed []string
+	for _, ch := range checks {
 		// required checks' appID is 0 for any source configuration
-		// if appID is not equal to 0 this means check is handled by some other app or by GitHub
-		// we skipp these checks
-		if ch.GetAppID() != 0 {
-			logger.Debug().Str("Status Check", ch.Context).Msg("Not managed by Ariane")
+		// if appID is set to another app this means check is handled by some other app or by GitHub
+		// we skip these checks
+		if !ch.providedBy(m.AppID) {
+			logger.Debug().Str("Status Check", ch.context).Msg("Not managed by Ariane")
 			continue
 		}
+		managed = append(managed, ch.context)
+	}
 
+	// the configuration is read from the base of the merge group, which is already merged
+	arianeConfig, err := configGetArianeConfigFromRepository(client, ctx, repositoryOwner, repositoryName, event.GetMergeGroup().GetBaseSHA())
+	if err != nil {
+		logger.Warn().Err(err).Msg("Failed to retrieve config file, marking required checks as successful")
+	} else if arianeConfig.GetMergeGroupChecks() == config.MergeGroupChecksPaths {
+		processor := &WorkflowProcessor{
+			client:       client,
+			arianeConfig: arianeConfig,
+			owner:        repositoryOwner,
+			repo:         repositoryName,
+			logger:       logger,
+			baseRef:      branch,
+			appID:        m.AppID,
+		}
+		if managed, err = processor.processMergeGroupWorkflows(ctx, event.GetMergeGroup(), managed); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range managed {
 		// setting the check status as completed and conclusion as success, without actually running it
-		logger.Debug().Str("Status Check", ch.Context).Msg("Setting status to completed, conclusion to success")
+		logger.Debug().Str("Status Check", name).Msg("Setting status to completed, conclusion to success")
 		checkRunOptions := github.CreateCheckRunOptions{
-			Name:       ch.Context,
+			Name:       name,
 			HeadSHA:    headSHA,
 			Status:     github.Ptr("completed"),
 			Conclusion: github.Ptr("success"),
 		}
 		if _, _, err := client.Checks.CreateCheckRun(ctx, repositoryOwner, repositoryName, checkRunOptions); err != nil {
-			logger.Error().Err(err).Msgf("Failed to set check run, %s", ch.Context)
+			logger.Error().Err(err).Msgf("Failed to set check run, %s", name)
 		}
 	}
 
 	return nil
 }
+
+// mergeGroupPRNumber matches the number of the last pull request of a merge group in its head ref, e.g.
+// refs/heads/gh-readonly-queue/main/pr-123-<sha>
+var mergeGroupPRNumber = regexp.MustCompile(`/pr-(\d+)-[0-9a-f]+$`)
+
+// processMergeGroupWorkflows completes the required checks of a merge group which are check runs of the
+// configured workflows: workflows affected by the changes of the merge group are dispatched on its head
+// ref, the check runs of the others are marked as skipped. All the workflows are dispatched if the merge
+// group changes too many files to list them all. It returns the required checks which are not check runs
+// of any configured workflow.
+func (w *WorkflowProcessor) processMergeGroupWorkflows(ctx context.Context, mergeGroup *github.MergeGroup, checks []string) ([]string, error) {
+	headSHA, baseSHA := mergeGroup.GetHeadSHA(), mergeGroup.GetBaseSHA()
+	files, complete, err := w.getComparisonFiles(ctx, baseSHA, headSHA)
+	if err != nil {
+		w.logger.Error().Err(err).Msgf("Failed to compare merge group %s against its base %s", headSHA, baseSHA)
+		return nil, err
+	}
+	if !complete {
+		// the workflows affected by the files left out of the comparison can't be told apart
+		w.logger.Info().Msgf("Too many files changed by merge group %s to filter workflows by paths, dispatching all of them", headSHA)
+	}
+
+	// only the required checks of the merge group are marked as skipped
+	w.requiredChecks = make(map[string]bool)
+	for _, check := range checks {
+		w.requiredChecks[check] = true
+	}
+
+	prNumber := 0
+	if match := mergeGroupPRNumber.FindStringSubmatch(mergeGroup.GetHeadRef()); match != nil {
+		prNumber, _ = strconv.Atoi(match[1])
+	}
+	headRef := strings.TrimPrefix(mergeGroup.GetHeadRef(), "refs/heads/")
+	workflowDispatchEvent := w.createWorkflowDispatchEvent(prNumber, headRef, headSHA, baseSHA, nil)
+
+	workflows := slices.Sorted(maps.Keys(w.arianeConfig.Workflows))
+	for _, workflow := range workflows {
+		names, err := w.skippedCheckNames(ctx, workflow)
+		if err != nil {
+			w.logger.Error().Err(err).Msgf("Failed to retrieve the check names of workflow %s", workflow)
+			return nil, err
+		}
+		required := slices.DeleteFunc(slices.Clone(names), func(name string) bool { return !slices.Contains(checks, name) })
+		if len(required) == 0 {
+			continue
+		}
+		checks = slices.DeleteFunc(checks, func(check string) bool { return slices.Contains(names, check) })
+
+		if !complete || w.shouldRunWorkflow(ctx, workflow, files) {
+			w.logger.Debug().Msgf("Dispatching workflow %s on merge group %s", workflow, headRef)
+			if err := w.triggerWorkflow(ctx, workflow, workflowDispatchEvent); err != nil {
+				w.logger.Error().Err(err).Msgf("Failed to trigger workflow %s", workflow)
+				w.failMergeGroupChecks(ctx, headSHA, required, fmt.Sprintf("Failed to dispatch workflow %s", workflow), err)
+			}
+			continue
+		}
+		w.logger.Debug().Msgf("Skipping workflow %s on merge group %s: %s", workflow, headRef, w.arianeConfig.SkipReason(workflow, files))
+		if err := w.markWorkflowAsSkipped(ctx, workflow, headSHA); err != nil {
+			w.logger.Error().Err(err).Msgf("Failed to mark workflow %s as skipped", workflow)
+			w.failMergeGroupChecks(ctx, headSHA, required, fmt.Sprintf("Failed to mark workflow %s as skipped", workflow), err)
+		}
+	}
+	return checks, nil
+}
+
+// failMergeGroupChecks completes the given required checks of a merge group as failed with the error
+// which prevented Ariane from completing them, so that the merge group is removed from the queue
+// instead of waiting for checks which will never complete
+func (w *WorkflowProcessor) failMergeGroupChecks(ctx context.Context, headSHA string, checks []string, title string, err error) {
+	for _, name := range checks {
+		checkRunOptions := github.CreateCheckRunOptions{
+			Name:       name,
+			HeadSHA:    headSHA,
+			Status:     github.Ptr("completed"),
+			Conclusion: github.Ptr("failure"),
+			Output: &github.CheckRunOutput{
+				Title:   github.Ptr(title),
+				Summary: github.Ptr(truncateCheckRunSummary(err.Error())),
+			},
+		}
+		if _, _, err := w.client.Checks.CreateCheckRun(ctx, w.owner, w.repo, checkRunOptions); err != nil {
+			w.logger.Error().Err(err).Msgf("Failed to set check run, %s", name)
+		}
+	}
+}
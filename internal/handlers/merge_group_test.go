@@ -0,0 +1,272 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func TestMergeGroupHandler_RequiredChecks(t *testing.T) {
+	testCases := []struct {
+		name           string
+		protected      bool
+		rules          string
+		expectedChecks []string
+	}{
+		{
+			name:           "branch protection",
+			protected:      true,
+			rules:          `[]`,
+			expectedChecks: []string{"Lint"},
+		},
+		{
+			name:           "rulesets without branch protection",
+			rules:          `[{"type": "merge_queue", "parameters": {"merge_method": "SQUASH"}}, {"type": "required_status_checks", "parameters": {"required_status_checks": [{"context": "CI"}, {"context": "Ariane", "integration_id": 42}, {"context": "Travis", "integration_id": 7}]}}]`,
+			expectedChecks: []string{"CI", "Ariane"},
+		},
+		{
+			name:           "branch protection and rulesets",
+			protected:      true,
+			rules:          `[{"type": "required_status_checks", "parameters": {"required_status_checks": [{"context": "Lint"}, {"context": "CI"}]}}]`,
+			expectedChecks: []string{"Lint", "CI"},
+		},
+		{
+			name:  "no required checks",
+			rules: `[]`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{}, nil
+			}
+
+			var created []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/owner/repo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+				if !tc.protected {
+					w.WriteHeader(http.StatusNotFound)
+					_ = json.NewEncoder(w).Encode(&github.ErrorResponse{Message: "Branch not protected"})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(&github.Protection{RequiredStatusChecks: &github.RequiredStatusChecks{
+					Checks: &[]*github.RequiredStatusCheck{{Context: "Lint"}, {Context: "DCO", AppID: github.Ptr[int64](7)}},
+				}})
+			})
+			mux.HandleFunc("GET /repos/owner/repo/rules/branches/main", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(tc.rules))
+			})
+			mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				var opts github.CreateCheckRunOptions
+				_ = json.NewDecoder(r.Body).Decode(&opts)
+				assert.Equal(t, "head-sha", opts.HeadSHA)
+				assert.Equal(t, "success", opts.GetConclusion())
+				created = append(created, opts.Name)
+				_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr[int64](1)})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &MergeGroupHandler{
+				ClientCreator: mockClientCreator,
+				AppID:         42,
+			}
+
+			payload := []byte(`{
+				"action": "checks_requested",
+				"merge_group": {
+					"head_sha": "head-sha",
+					"head_ref": "refs/heads/gh-readonly-queue/main/pr-1-base-sha",
+					"base_sha": "base-sha",
+					"base_ref": "refs/heads/main"
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "merge_group", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedChecks, created)
+		})
+	}
+}
+
+func TestMergeGroupHandler_PathsChecks(t *testing.T) {
+	testCases := []struct {
+		name               string
+		files              []string
+		dispatchFails      bool
+		expectedDispatched []string
+		expectedCreated    map[string]string
+	}{
+		{
+			name:               "workflow affected by the merge group",
+			files:              []string{"pkg/foo.go"},
+			expectedDispatched: []string{"ci.yaml"},
+			expectedCreated:    map[string]string{"Lint": "skipped", "DCO": "success"},
+		},
+		{
+			name:            "no workflow affected by the merge group",
+			files:           []string{"Documentation/index.rst"},
+			expectedCreated: map[string]string{"Test (ipv4)": "skipped", "Lint": "skipped", "DCO": "success"},
+		},
+		{
+			name:               "all workflows affected by the merge group",
+			files:              []string{"pkg/foo.go", "lint/config.yaml"},
+			expectedDispatched: []string{"ci.yaml", "lint.yaml"},
+			expectedCreated:    map[string]string{"DCO": "success"},
+		},
+		{
+			name:               "too many files changed by the merge group to filter workflows",
+			files:              slices.Repeat([]string{"Documentation/index.rst"}, comparisonFilesLimit),
+			expectedDispatched: []string{"ci.yaml", "lint.yaml"},
+			expectedCreated:    map[string]string{"DCO": "success"},
+		},
+		{
+			name:            "workflow failing to be dispatched",
+			files:           []string{"pkg/foo.go"},
+			dispatchFails:   true,
+			expectedCreated: map[string]string{"Test (ipv4)": "failure", "Lint": "skipped", "DCO": "success"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				assert.Equal(t, "base-sha", ref, "the configuration is read from the base of the merge group")
+				return &config.ArianeConfig{
+					Workflows: map[string]config.WorkflowPathsRegexConfig{
+						"ci.yaml":   {PathsRegex: "pkg/", SkippedChecks: []string{"Test (ipv4)", "Test (ipv6)"}},
+						"lint.yaml": {PathsRegex: "lint/"},
+						"docs.yaml": {PathsRegex: "Documentation/"},
+					},
+					ChecksConfig: &config.ChecksConfig{MergeGroup: config.MergeGroupChecksPaths, Skipped: config.SkippedChecksRequired},
+				}, nil
+			}
+
+			var dispatched []string
+			created := make(map[string]string)
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/owner/repo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Protection{RequiredStatusChecks: &github.RequiredStatusChecks{
+					Checks: &[]*github.RequiredStatusCheck{{Context: "Test (ipv4)"}, {Context: "Lint"}, {Context: "DCO"}},
+				}})
+			})
+			mux.HandleFunc("GET /repos/owner/repo/rules/branches/main", func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte(`[]`))
+			})
+			mux.HandleFunc("GET /repos/owner/repo/compare/base-sha...head-sha", func(w http.ResponseWriter, r *http.Request) {
+				var files []*github.CommitFile
+				for _, file := range tc.files {
+					files = append(files, &github.CommitFile{Filename: github.Ptr(file)})
+				}
+				_ = json.NewEncoder(w).Encode(&github.CommitsComparison{Files: files})
+			})
+			mux.HandleFunc("GET /repos/owner/repo/actions/workflows/{workflow}", func(w http.ResponseWriter, r *http.Request) {
+				names := map[string]string{"lint.yaml": "Lint", "docs.yaml": "Docs"}
+				_ = json.NewEncoder(w).Encode(&github.Workflow{Name: github.Ptr(names[r.PathValue("workflow")])})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/actions/workflows/{workflow}/dispatches", func(w http.ResponseWriter, r *http.Request) {
+				var event github.CreateWorkflowDispatchEventRequest
+				_ = json.NewDecoder(r.Body).Decode(&event)
+				assert.Equal(t, "gh-readonly-queue/main/pr-12-0d4c1a8e", event.Ref)
+				assert.Equal(t, "12", event.Inputs["PR-number"])
+				assert.Equal(t, "head-sha", event.Inputs["SHA"])
+				if tc.dispatchFails {
+					http.Error(w, "dispatch failed", http.StatusInternalServerError)
+					return
+				}
+				dispatched = append(dispatched, r.PathValue("workflow"))
+				w.WriteHeader(http.StatusNoContent)
+			})
+			mux.HandleFunc("GET /repos/owner/repo/commits/head-sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.ListCheckRunsResults{Total: github.Ptr(0)})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				var opts github.CreateCheckRunOptions
+				_ = json.NewDecoder(r.Body).Decode(&opts)
+				assert.Equal(t, "head-sha", opts.HeadSHA)
+				if opts.GetConclusion() == "failure" {
+					assert.Equal(t, "Failed to dispatch workflow ci.yaml", opts.GetOutput().GetTitle())
+					assert.Contains(t, opts.GetOutput().GetSummary(), "500")
+				}
+				created[opts.Name] = opts.GetConclusion()
+				_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr[int64](1)})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &MergeGroupHandler{
+				ClientCreator: mockClientCreator,
+			}
+
+			payload := []byte(`{
+				"action": "checks_requested",
+				"merge_group": {
+					"head_sha": "head-sha",
+					"head_ref": "refs/heads/gh-readonly-queue/main/pr-12-0d4c1a8e",
+					"base_sha": "base-sha",
+					"base_ref": "refs/heads/main"
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "merge_group", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedDispatched, dispatched)
+			assert.Equal(t, tc.expectedCreated, created)
+		})
+	}
+}
@@ -0,0 +1,208 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+// pendingCheckExternalID identifies the pending check runs created by Ariane for the runs of a workflow
+func pendingCheckExternalID(workflow string) string {
+	return "ariane-pending:" + workflow
+}
+
+// pendingCheck is a pending check run created by Ariane for the runs of a workflow
+type pendingCheck struct {
+	id   int64
+	name string
+}
+
+// checkRunConclusion maps a workflow run conclusion to a check run conclusion accepted by the Checks API.
+// Conclusions which can't be set on a check run, e.g. stale or startup_failure, are reported as failures.
+func checkRunConclusion(conclusion string) string {
+	switch conclusion {
+	case "success", "failure", "neutral", "cancelled", "skipped", "timed_out", "action_required":
+		return conclusion
+	case "":
+		return "neutral"
+	default:
+		return "failure"
+	}
+}
+
+// createPendingChecks creates queued check runs for a dispatched workflow on sha, completed along with its
+// run: one named after the workflow if pending checks are enabled, so that the pull request checks reflect
+// the workflow before its run starts, and one superseding each check run Ariane marked as skipped for it
+func (w *WorkflowProcessor) createPendingChecks(ctx context.Context, workflow, sha string) {
+	skipped, err := skippedChecks(ctx, w.client, w.owner, w.repo, workflow, sha)
+	if err != nil {
+		w.logger.Error().Err(err).Msgf("Failed to retrieve the skipped check runs of workflow %s", workflow)
+	}
+	addPendingCheck := func(checkRunID int64, name string) {
+		if w.pendingChecks == nil {
+			w.pendingChecks = make(map[string][]pendingCheck)
+		}
+		w.pendingChecks[workflow] = append(w.pendingChecks[workflow], pendingCheck{id: checkRunID, name: name})
+	}
+
+	if w.arianeConfig.GetPendingChecks() {
+		githubWorkflow, _, err := w.client.Actions.GetWorkflowByFileName(ctx, w.owner, w.repo, workflow)
+		switch {
+		case err != nil:
+			w.logger.Error().Err(err).Msgf("Failed to retrieve workflow %s", workflow)
+		case !slices.ContainsFunc(skipped, func(checkRun *github.CheckRun) bool { return checkRun.GetName() == githubWorkflow.GetName() }):
+			checkRunID, err := createPendingCheck(ctx, w.client, w.owner, w.repo, workflow, githubWorkflow.GetName(), sha)
+			if err != nil {
+				w.logger.Error().Err(err).Msgf("Failed to create pending check run %s for workflow %s", githubWorkflow.GetName(), workflow)
+				break
+			}
+			addPendingCheck(checkRunID, githubWorkflow.GetName())
+		}
+	}
+
+	for _, checkRun := range skipped {
+		checkRunID, err := supersedeSkippedCheck(ctx, w.client, w.owner, w.repo, workflow, sha, checkRun)
+		if err != nil {
+			w.logger.Error().Err(err).Msgf("Failed to supersede skipped check run %s of workflow %s", checkRun.GetName(), workflow)
+			continue
+		}
+		addPendingCheck(checkRunID, checkRun.GetName())
+	}
+}
+
+// pendingCheckOutput is the output of the pending check runs of a workflow until its run starts
+func pendingCheckOutput(workflow string) *github.CheckRunOutput {
+	return &github.CheckRunOutput{
+		Title:   github.Ptr("Waiting for the workflow run"),
+		Summary: github.Ptr(fmt.Sprintf("Workflow `%s` is waiting for its run to start.", workflow)),
+	}
+}
+
+// createPendingCheck creates a queued check run of a workflow on sha, superseding the previous check runs
+// of the same name created by Ariane
+func createPendingCheck(ctx context.Context, client *github.Client, owner, repo, workflow, name, sha string) (int64, error) {
+	checkRun, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, github.CreateCheckRunOptions{
+		Name:       name,
+		HeadSHA:    sha,
+		Status:     github.Ptr("queued"),
+		ExternalID: github.Ptr(pendingCheckExternalID(workflow)),
+		Output:     pendingCheckOutput(workflow),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return checkRun.GetID(), nil
+}
+
+// supersedeSkippedCheck turns the check run Ariane marked as skipped for a workflow on sha into a queued
+// check run of the workflow, and returns its ID. The check run is updated rather than superseded by a new
+// one, so that the pull request doesn't list the check twice. Supersedes of the check runs of a name on sha
+// are serialized, and the check run is left as is if it was superseded in the meantime, e.g. by the run of the workflow
+// starting while it is dispatched.
+func supersedeSkippedCheck(ctx context.Context, client *github.Client, owner, repo, workflow, sha string, skipped *github.CheckRun) (int64, error) {
+	defer lockFeedback(fmt.Sprintf("%s/%s@%s:%s", owner, repo, sha, skipped.GetName()))()
+
+	checkRunID := skipped.GetID()
+	checkRun, _, err := client.Checks.GetCheckRun(ctx, owner, repo, checkRunID)
+	if err != nil {
+		return 0, err
+	}
+	if checkRun.GetExternalID() != skippedCheckExternalID(workflow) || checkRun.GetConclusion() != "skipped" {
+		return checkRunID, nil
+	}
+	_, _, err = client.Checks.UpdateCheckRun(ctx, owner, repo, checkRunID, github.UpdateCheckRunOptions{
+		Name:       checkRun.GetName(),
+		Status:     github.Ptr("queued"),
+		ExternalID: github.Ptr(pendingCheckExternalID(workflow)),
+		Output:     pendingCheckOutput(workflow),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return checkRunID, nil
+}
+
+// hasPendingChecks returns whether the runs of a workflow which were not dispatched by Ariane may have
+// pending check runs: if pending checks are enabled, or if Ariane marks the check runs of the workflow as
+// skipped, which its runs supersede
+func hasPendingChecks(arianeConfig *config.ArianeConfig, workflow string) bool {
+	_, ok := arianeConfig.Workflows[workflow]
+	return ok || arianeConfig.GetPendingChecks()
+}
+
+// updatePendingChecks updates the pending check runs of a workflow run along with the run: in progress
+// once it starts, and completed with its conclusion once it completes
+func updatePendingChecks(ctx context.Context, client *github.Client, event *github.WorkflowRunEvent, dispatchedRuns *DispatchedRunTracker, logger zerolog.Logger) error {
+	workflowRun := event.GetWorkflowRun()
+	owner := event.GetRepo().GetOwner().GetLogin()
+	repo := event.GetRepo().GetName()
+	name := event.GetWorkflow().GetName()
+	workflow := path.Base(event.GetWorkflow().GetPath())
+
+	var checks []pendingCheck
+	run, tracked := dispatchedRuns.get(workflowRun.GetID())
+	if tracked && len(run.checks) > 0 {
+		checks = run.checks
+	} else {
+		// the run was not dispatched by Ariane, or without pending check runs: look for pending check runs
+		// on the pull request head the run was dispatched for, or else on the commit of the run, and
+		// supersede the check runs Ariane marked as skipped for the workflow before it ran on the commit
+		sha := workflowRun.GetHeadSHA()
+		if tracked && run.sha != "" {
+			sha = run.sha
+		}
+		checkRuns, err := latestCheckRuns(ctx, client, owner, repo, sha)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to list check runs of %s", sha)
+			return err
+		}
+		for _, checkRun := range checkRuns {
+			switch {
+			case checkRun.GetExternalID() == pendingCheckExternalID(workflow) && checkRun.GetStatus() != "completed":
+				checks = append(checks, pendingCheck{id: checkRun.GetID(), name: checkRun.GetName()})
+			case checkRun.GetExternalID() == skippedCheckExternalID(workflow) && checkRun.GetConclusion() == "skipped":
+				checkRunID, err := supersedeSkippedCheck(ctx, client, owner, repo, workflow, sha, checkRun)
+				if err != nil {
+					logger.Error().Err(err).Msgf("Failed to supersede skipped check run %s of workflow %s", checkRun.GetName(), workflow)
+					return err
+				}
+				checks = append(checks, pendingCheck{id: checkRunID, name: checkRun.GetName()})
+			}
+		}
+	}
+
+	opts := github.UpdateCheckRunOptions{
+		DetailsURL: workflowRun.HTMLURL,
+		Status:     github.Ptr("in_progress"),
+		Output: &github.CheckRunOutput{
+			Title:   github.Ptr("Workflow run in progress"),
+			Summary: github.Ptr(fmt.Sprintf("Run [#%d](%s) of workflow `%s` is in progress.", workflowRun.GetRunNumber(), workflowRun.GetHTMLURL(), name)),
+		},
+	}
+	if workflowRun.GetStatus() == "completed" {
+		opts.Status = github.Ptr("completed")
+		opts.Conclusion = github.Ptr(checkRunConclusion(workflowRun.GetConclusion()))
+		opts.CompletedAt = workflowRun.UpdatedAt
+		opts.Output.Title = github.Ptr("Workflow run completed")
+		opts.Output.Summary = github.Ptr(fmt.Sprintf("Run [#%d](%s) of workflow `%s` completed with %s.", workflowRun.GetRunNumber(), workflowRun.GetHTMLURL(), name, workflowRun.GetConclusion()))
+	}
+
+	for _, check := range checks {
+		opts.Name = check.name
+		if _, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, check.id, opts); err != nil {
+			logger.Error().Err(err).Msgf("Failed to update pending check run %s of workflow run %d", check.name, workflowRun.GetID())
+			return err
+		}
+		logger.Debug().Msgf("Updated pending check run %s of workflow run %d to %s", check.name, workflowRun.GetID(), *opts.Status)
+	}
+	return nil
+}
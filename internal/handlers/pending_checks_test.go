@@ -0,0 +1,336 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func TestWorkflowProcessor_PendingCheck(t *testing.T) {
+	dispatchedRuns := &DispatchedRunTracker{}
+	var created []github.CreateCheckRunOptions
+	var updated []github.UpdateCheckRunOptions
+	skipped := []*github.CheckRun{
+		{ID: github.Ptr[int64](10), Name: github.Ptr("CI (ipv6)"), ExternalID: github.Ptr(skippedCheckExternalID("ci.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")},
+		{ID: github.Ptr[int64](11), Name: github.Ptr("Lint"), ExternalID: github.Ptr(skippedCheckExternalID("lint.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/owner/repo/pulls/1/files", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]*github.CommitFile{{Filename: github.Ptr("pkg/foo.go")}})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/workflows/ci.yaml/runs", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(github.WorkflowRuns{TotalCount: github.Ptr(0)})
+	})
+	mux.HandleFunc("POST /repos/owner/repo/actions/workflows/ci.yaml/dispatches", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&github.WorkflowDispatchRunDetails{WorkflowRunID: github.Ptr[int64](4343)})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/actions/workflows/ci.yaml", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&github.Workflow{Name: github.Ptr("CI")})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/commits/sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&github.ListCheckRunsResults{Total: github.Ptr(len(skipped)), CheckRuns: skipped})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/check-runs/10", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(skipped[0])
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/check-runs/10", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.UpdateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		updated = append(updated, opts)
+		_ = json.NewEncoder(w).Encode(skipped[0])
+	})
+	mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.CreateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		created = append(created, opts)
+		_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr(int64(76 + len(created)))})
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	processor := &WorkflowProcessor{
+		client: client,
+		arianeConfig: &config.ArianeConfig{
+			Workflows:    map[string]config.WorkflowPathsRegexConfig{"ci.yaml": {PathsRegex: "pkg/"}},
+			ChecksConfig: &config.ChecksConfig{Pending: github.Ptr(true)},
+		},
+		owner:          "owner",
+		repo:           "repo",
+		logger:         zerolog.Nop(),
+		dispatchedRuns: dispatchedRuns,
+	}
+	commenter := NewGithubCommenter(client, "owner", "repo", "ariane[bot]", zerolog.Nop())
+	err = processor.processWorkflowsForTrigger(context.Background(), []string{"/test"}, 1, "branch", "sha", "base-sha", []string{"ci.yaml"}, nil, commenter)
+	assert.NoError(t, err)
+
+	if len(created) != 1 || len(updated) != 1 {
+		t.Fatalf("Expected a pending check run created and one updated, got %d and %d", len(created), len(updated))
+	}
+	assert.Equal(t, "CI", created[0].Name, "a pending check run is created")
+	assert.Equal(t, "sha", created[0].HeadSHA)
+	assert.Equal(t, "queued", created[0].GetStatus())
+	assert.Equal(t, pendingCheckExternalID("ci.yaml"), created[0].GetExternalID())
+	assert.Equal(t, "CI (ipv6)", updated[0].Name, "the skipped check run is superseded in place")
+	assert.Equal(t, "queued", updated[0].GetStatus())
+	assert.Equal(t, pendingCheckExternalID("ci.yaml"), updated[0].GetExternalID())
+
+	run, ok := dispatchedRuns.get(4343)
+	assert.True(t, ok)
+	assert.Equal(t, []pendingCheck{{id: 77, name: "CI"}, {id: 10, name: "CI (ipv6)"}}, run.checks)
+	assert.Zero(t, run.status.runID, "the run is not listed in a workflows report")
+}
+
+func TestWorkflowRunHandler_UpdatePendingChecks(t *testing.T) {
+	dispatchedRuns := &DispatchedRunTracker{}
+	dispatchedRuns.add(5001, dispatchedRun{owner: "owner", repo: "repo", prNumber: 1, checks: []pendingCheck{{id: 77, name: "CI"}}})
+	dispatchedRuns.add(5005, dispatchedRun{owner: "owner", repo: "repo", prNumber: 1, workflow: "ci.yaml", sha: "sha"})
+
+	testCases := []struct {
+		name       string
+		action     string
+		runID      int64
+		event      string
+		conclusion string
+		headSHA    string
+		// unmanaged is whether Ariane neither creates pending nor skipped check runs for the workflow
+		unmanaged          bool
+		checkRuns          []*github.CheckRun
+		expectedCreated    []string
+		expectedUpdates    []int64
+		expectedStatus     string
+		expectedConclusion string
+	}{
+		{
+			name:            "tracked run started",
+			action:          "in_progress",
+			runID:           5001,
+			event:           "workflow_dispatch",
+			expectedUpdates: []int64{77},
+			expectedStatus:  "in_progress",
+		},
+		{
+			name:               "tracked run failed to start",
+			action:             "completed",
+			runID:              5001,
+			event:              "workflow_dispatch",
+			conclusion:         "startup_failure",
+			expectedUpdates:    []int64{77},
+			expectedStatus:     "completed",
+			expectedConclusion: "failure",
+		},
+		{
+			name:               "tracked run gone stale",
+			action:             "completed",
+			runID:              5001,
+			event:              "workflow_dispatch",
+			conclusion:         "stale",
+			expectedUpdates:    []int64{77},
+			expectedStatus:     "completed",
+			expectedConclusion: "failure",
+		},
+		{
+			name:       "tracked run of a pull request from a fork",
+			action:     "completed",
+			runID:      5005,
+			event:      "workflow_dispatch",
+			conclusion: "success",
+			headSHA:    "base-sha",
+			checkRuns: []*github.CheckRun{
+				{ID: github.Ptr[int64](87), Name: github.Ptr("CI"), ExternalID: github.Ptr(pendingCheckExternalID("ci.yaml")), Status: github.Ptr("queued")},
+			},
+			expectedUpdates:    []int64{87},
+			expectedStatus:     "completed",
+			expectedConclusion: "success",
+		},
+		{
+			name:       "dispatched run completed after a restart",
+			action:     "completed",
+			runID:      5002,
+			event:      "workflow_dispatch",
+			conclusion: "success",
+			checkRuns: []*github.CheckRun{
+				{ID: github.Ptr[int64](88), Name: github.Ptr("CI"), ExternalID: github.Ptr(pendingCheckExternalID("ci.yaml")), Status: github.Ptr("queued")},
+				{ID: github.Ptr[int64](89), Name: github.Ptr("CI"), ExternalID: github.Ptr("other"), Status: github.Ptr("queued")},
+				{ID: github.Ptr[int64](90), Name: github.Ptr("Lint"), ExternalID: github.Ptr(pendingCheckExternalID("lint.yaml")), Status: github.Ptr("queued")},
+			},
+			expectedUpdates:    []int64{88},
+			expectedStatus:     "completed",
+			expectedConclusion: "success",
+		},
+		{
+			name:   "run of a workflow marked as skipped",
+			action: "in_progress",
+			runID:  5003,
+			event:  "pull_request",
+			checkRuns: []*github.CheckRun{
+				{ID: github.Ptr[int64](91), Name: github.Ptr("CI"), ExternalID: github.Ptr(skippedCheckExternalID("ci.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")},
+				{ID: github.Ptr[int64](92), Name: github.Ptr("Lint"), ExternalID: github.Ptr(skippedCheckExternalID("lint.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")},
+			},
+			expectedUpdates: []int64{91, 91},
+			expectedStatus:  "in_progress",
+		},
+		{
+			name:   "run of a workflow whose skipped check run was superseded in the meantime",
+			action: "in_progress",
+			runID:  5003,
+			event:  "pull_request",
+			checkRuns: []*github.CheckRun{
+				{ID: github.Ptr[int64](94), Name: github.Ptr("CI"), ExternalID: github.Ptr(skippedCheckExternalID("ci.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")},
+			},
+			expectedUpdates: []int64{94},
+			expectedStatus:  "in_progress",
+		},
+		{
+			name:      "run of a workflow without pending or skipped check runs",
+			action:    "in_progress",
+			runID:     5003,
+			event:     "pull_request",
+			unmanaged: true,
+			checkRuns: []*github.CheckRun{
+				{ID: github.Ptr[int64](91), Name: github.Ptr("CI"), ExternalID: github.Ptr(skippedCheckExternalID("ci.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")},
+			},
+		},
+		{
+			name:       "run without pending check runs",
+			action:     "completed",
+			runID:      5004,
+			event:      "pull_request",
+			conclusion: "success",
+			checkRuns: []*github.CheckRun{
+				{ID: github.Ptr[int64](93), Name: github.Ptr("CI"), ExternalID: github.Ptr(pendingCheckExternalID("ci.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("success")},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				if tc.unmanaged {
+					return &config.ArianeConfig{}, nil
+				}
+				return &config.ArianeConfig{Workflows: map[string]config.WorkflowPathsRegexConfig{"ci.yaml": {PathsRegex: "pkg/"}}}, nil
+			}
+
+			var created []string
+			var updates []int64
+			var update github.UpdateCheckRunOptions
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/owner/repo/commits/sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "latest", r.FormValue("filter"))
+				_ = json.NewEncoder(w).Encode(&github.ListCheckRunsResults{Total: github.Ptr(len(tc.checkRuns)), CheckRuns: tc.checkRuns})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				var opts github.CreateCheckRunOptions
+				_ = json.NewDecoder(r.Body).Decode(&opts)
+				assert.Equal(t, pendingCheckExternalID("ci.yaml"), opts.GetExternalID())
+				created = append(created, opts.Name)
+				_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr(int64(99 + len(created)))})
+			})
+			mux.HandleFunc("GET /repos/owner/repo/check-runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+				for _, checkRun := range tc.checkRuns {
+					if strconv.FormatInt(checkRun.GetID(), 10) != r.PathValue("id") {
+						continue
+					}
+					if checkRun.GetID() == 94 {
+						// superseded after the check runs of the commit were listed
+						checkRun = &github.CheckRun{ID: checkRun.ID, Name: checkRun.Name, ExternalID: github.Ptr(pendingCheckExternalID("ci.yaml")), Status: github.Ptr("queued")}
+					}
+					_ = json.NewEncoder(w).Encode(checkRun)
+					return
+				}
+				http.NotFound(w, r)
+			})
+			mux.HandleFunc("PATCH /repos/owner/repo/check-runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+				id, _ := strconv.ParseInt(r.PathValue("id"), 10, 64)
+				updates = append(updates, id)
+				_ = json.NewDecoder(r.Body).Decode(&update)
+				_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr(id)})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil).AnyTimes()
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator:  mockClientCreator,
+					DispatchedRuns: dispatchedRuns,
+				},
+			}
+
+			status := "completed"
+			if tc.action != "completed" {
+				status = tc.action
+			}
+			headSHA := "sha"
+			if tc.headSHA != "" {
+				headSHA = tc.headSHA
+			}
+			payload := []byte(`{
+				"action": "` + tc.action + `",
+				"workflow": {
+					"name": "CI",
+					"path": ".github/workflows/ci.yaml"
+				},
+				"workflow_run": {
+					"id": ` + strconv.FormatInt(tc.runID, 10) + `,
+					"event": "` + tc.event + `",
+					"status": "` + status + `",
+					"conclusion": "` + tc.conclusion + `",
+					"head_sha": "` + headSHA + `",
+					"html_url": "https://github.com/owner/repo/actions/runs/1",
+					"pull_requests": []
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCreated, created)
+			assert.Equal(t, tc.expectedUpdates, updates)
+			if len(tc.expectedUpdates) > 0 {
+				assert.Equal(t, "CI", update.Name)
+				assert.Equal(t, tc.expectedStatus, update.GetStatus())
+				assert.Equal(t, tc.expectedConclusion, update.GetConclusion())
+				assert.Equal(t, "https://github.com/owner/repo/actions/runs/1", update.GetDetailsURL())
+			}
+		})
+	}
+}
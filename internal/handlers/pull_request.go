@@ -7,8 +7,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"time"
 
+	"github.com/cilium/ariane/internal/config"
 	"github.com/cilium/ariane/internal/log"
 	"github.com/google/go-github/v88/github"
 	"github.com/palantir/go-githubapp/githubapp"
@@ -18,9 +18,7 @@ import (
 const defaultRunTrigger = "/default"
 
 type PullRequestHandler struct {
-	githubapp.ClientCreator
-	RunDelay         time.Duration
-	MaxRetryAttempts int
+	Config
 }
 
 func (*PullRequestHandler) Handles() []string {
@@ -61,14 +59,15 @@ func (p *PullRequestHandler) Handle(ctx context.Context, eventType, deliveryID s
 	repositoryOwner := repository.GetOwner().GetLogin()
 	repositoryName := repository.GetName()
 
-	commenter := NewGithubCommenter(client, repositoryOwner, repositoryName, logger)
+	commenter := NewGithubCommenter(client, repositoryOwner, repositoryName, p.BotLogin, logger)
 
 	// Get PR metadata and validate PR author permissions
 	pr, err := getPullRequest(ctx, client, repositoryOwner, repositoryName, prNumber, logger, p.MaxRetryAttempts)
 	if err != nil {
-		comment := fmt.Sprintf("Failed to retrieve pull request: %v", err)
-		logger.Error().Err(err).Msg(comment)
-		_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
+		logger.Error().Err(err).Msg("Failed to retrieve pull request")
+		defaultConfig := fallbackConfig(ctx, client, repositoryOwner, repositoryName, logger)
+		comment := feedbackMessage(defaultConfig, config.TemplatePullRequestFailed, config.FeedbackData{Author: event.GetSender().GetLogin(), Command: defaultRunTrigger, Reason: err.Error()}, logger)
+		_ = commenter.report(ctx, defaultConfig, prNumber, config.TemplatePullRequestFailed, defaultRunTrigger, comment)
 		return err
 	}
 
@@ -78,9 +77,10 @@ func (p *PullRequestHandler) Handle(ctx context.Context, eventType, deliveryID s
 	// retrieve Ariane configuration (triggers, etc.) from repository based on chosen context
 	arianeConfig, err := configGetArianeConfigFromRepository(client, ctx, repositoryOwner, repositoryName, contextRef)
 	if err != nil {
-		comment := "Failed to retrieve config file"
-		logger.Error().Err(err).Msg(comment)
-		_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
+		logger.Error().Err(err).Msg("Failed to retrieve config file")
+		defaultConfig := fallbackConfig(ctx, client, repositoryOwner, repositoryName, logger)
+		comment := feedbackMessage(defaultConfig, config.TemplateConfigFailed, config.FeedbackData{Author: event.GetSender().GetLogin(), Command: defaultRunTrigger, Reason: err.Error()}, logger)
+		_ = commenter.report(ctx, defaultConfig, prNumber, config.TemplateConfigFailed, defaultRunTrigger, comment)
 		return err
 	}
 
@@ -93,7 +93,9 @@ func (p *PullRequestHandler) Handle(ctx context.Context, eventType, deliveryID s
 		return nil
 	}
 
-	if err := commenter.reactToPR(ctx, prNumber, "eyes"); err != nil {
+	// Reactions of previous pull request events are replaced, as the PR only shows the current state
+	lifecycle := newReactionLifecycle(commenter, reactionTarget{kind: reactionTargetPullRequest, id: int64(prNumber)}, true)
+	if err := lifecycle.transition(ctx, arianeConfig, reactionStateProcessing); err != nil {
 		return err
 	}
 
@@ -104,19 +106,29 @@ func (p *PullRequestHandler) Handle(ctx context.Context, eventType, deliveryID s
 		arianeConfig: arianeConfig,
 		logger:       logger,
 		runDelay:     p.RunDelay,
+		sender:       event.GetSender().GetLogin(),
+		baseRef:      pr.GetBase().GetRef(),
+
+		scheduler:      p.Scheduler,
+		installationID: installationID,
+		appID:          p.AppID,
+		dispatchedRuns: p.DispatchedRuns,
 	}
 
 	err = processor.processWorkflowsForTrigger(ctx, submatch, prNumber, contextRef, headSHA, baseSHA, workflowsToTrigger, dependsOn, commenter)
 	if err != nil {
-		comment := fmt.Sprintf("Failed to process workflows for trigger: %v", err)
-		logger.Error().Err(err).Msg(comment)
+		logger.Error().Err(err).Msg("Failed to process workflows for trigger")
+		if err := lifecycle.transition(ctx, arianeConfig, reactionStateFailed); err != nil {
+			logger.Error().Err(err).Msg("Failed to react to pull request with failed state")
+		}
 		if arianeConfig.GetVerbose() {
-			_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
+			comment := feedbackMessage(arianeConfig, config.TemplateTriggerFailed, config.FeedbackData{Author: event.GetSender().GetLogin(), Command: submatch[0], Reason: err.Error()}, logger)
+			_ = commenter.report(ctx, arianeConfig, prNumber, config.TemplateTriggerFailed, submatch[0], comment)
 		}
 		return err
 	}
 
-	if err := commenter.reactToPR(ctx, prNumber, "rocket"); err != nil {
+	if err := lifecycle.transition(ctx, arianeConfig, reactionStateTriggered); err != nil {
 		return err
 	}
 
@@ -0,0 +1,177 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/palantir/go-githubapp/githubapp"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/log"
+)
+
+// PRReviewHandler handles trigger phrases found in the body of submitted pull request reviews, and
+// optionally runs a trigger when a review is approved
+type PRReviewHandler struct {
+	Config
+}
+
+func (*PRReviewHandler) Handles() []string {
+	return []string{"pull_request_review"}
+}
+
+func (h *PRReviewHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.PullRequestReviewEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("failed to parse pull_request_review event payload: %w", err)
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	repository := event.GetRepo()
+	prNumber := event.GetPullRequest().GetNumber()
+	ctx, logger := githubapp.PreparePRContext(ctx, installationID, repository, prNumber)
+	ctx = log.WithLogger(ctx, &logger)
+
+	// only handle submitted reviews
+	logger.Debug().Msgf("Event action is %s", event.GetAction())
+	if event.GetAction() != "submitted" {
+		return nil
+	}
+
+	review := event.GetReview()
+	approved := review.GetState() == "approved"
+	commands := commentCommands(review.GetBody())
+	if len(commands) == 0 && !approved {
+		logger.Debug().Msg("Pull request review does not contain any command")
+		return nil
+	}
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	runner := commandRunner{
+		client:           client,
+		runDelay:         h.RunDelay,
+		maxRetryAttempts: h.MaxRetryAttempts,
+		flakeStore:       h.FlakeStore,
+		scheduler:        h.Scheduler,
+		installationID:   installationID,
+		appID:            h.AppID,
+		dispatchedRuns:   h.DispatchedRuns,
+		botLogin:         h.BotLogin,
+		logger:           logger,
+	}
+	return runner.run(ctx, commandRequest{
+		source:   "Pull request review",
+		owner:    repository.GetOwner().GetLogin(),
+		repo:     repository.GetName(),
+		prNumber: prNumber,
+		author:   review.GetUser().GetLogin(),
+		// reviews do not support reactions, react on the pull request instead
+		target:                reactionTarget{kind: reactionTargetPullRequest, id: int64(prNumber)},
+		replacePriorReactions: true,
+		commands: func(arianeConfig *config.ArianeConfig) []string {
+			if onApproval := arianeConfig.GetOnApproval(); approved && onApproval != "" {
+				if !slices.Contains(commands, onApproval) {
+					return append(commands, onApproval)
+				}
+			}
+			return commands
+		},
+	})
+}
+
+// PRReviewCommentHandler handles trigger phrases found in pull request review comments (comments on
+// the diff), if enabled in the repository's Ariane configuration
+type PRReviewCommentHandler struct {
+	Config
+
+	history commandHistory
+}
+
+func (*PRReviewCommentHandler) Handles() []string {
+	return []string{"pull_request_review_comment"}
+}
+
+func (h *PRReviewCommentHandler) Handle(ctx context.Context, eventType, deliveryID string, payload []byte) error {
+	var event github.PullRequestReviewCommentEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("failed to parse pull_request_review_comment event payload: %w", err)
+	}
+
+	installationID := githubapp.GetInstallationIDFromEvent(&event)
+	repository := event.GetRepo()
+	prNumber := event.GetPullRequest().GetNumber()
+	ctx, logger := githubapp.PreparePRContext(ctx, installationID, repository, prNumber)
+	ctx = log.WithLogger(ctx, &logger)
+
+	commentID := event.GetComment().GetID()
+	commentBody := event.GetComment().GetBody()
+
+	// only handle new comments, and edited comments that introduce a new command or still hold a
+	// command which failed
+	logger.Debug().Msgf("Event action is %s", event.GetAction())
+	var commands []string
+	switch event.GetAction() {
+	case "created":
+		commands = newCommands("", commentBody)
+	case "edited":
+		commands = h.history.editedCommands(commentID, event.GetChanges().GetBody().GetFrom(), commentBody)
+	default:
+		return nil
+	}
+
+	// never replay a command that was already handled for this comment
+	commands = h.history.claim(commentID, commands)
+	if len(commands) == 0 {
+		logger.Debug().Msg("Pull request review comment does not contain any new command")
+		return nil
+	}
+	defer h.history.release(commentID, commands)
+
+	client, err := h.NewInstallationClient(installationID)
+	if err != nil {
+		return err
+	}
+
+	runner := commandRunner{
+		client:           client,
+		runDelay:         h.RunDelay,
+		maxRetryAttempts: h.MaxRetryAttempts,
+		flakeStore:       h.FlakeStore,
+		scheduler:        h.Scheduler,
+		installationID:   installationID,
+		appID:            h.AppID,
+		dispatchedRuns:   h.DispatchedRuns,
+		botLogin:         h.BotLogin,
+		logger:           logger,
+	}
+	return runner.run(ctx, commandRequest{
+		source:   "Pull request review comment",
+		owner:    repository.GetOwner().GetLogin(),
+		repo:     repository.GetName(),
+		prNumber: prNumber,
+		author:   commandAuthor(event.GetAction(), event.GetComment().GetUser(), event.GetSender()),
+		target:   reactionTarget{kind: reactionTargetReviewComment, id: commentID},
+		commands: func(arianeConfig *config.ArianeConfig) []string {
+			if !arianeConfig.GetReviewComments() {
+				logger.Debug().Msg("Pull request review comments are not enabled")
+				return nil
+			}
+			return commands
+		},
+		done: func(command string, err error) {
+			h.history.done(commentID, command, err)
+		},
+		// an edited comment still holds the reaction of its previous commands
+		replacePriorReactions: event.GetAction() == "edited",
+	})
+}
@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func mockGetArianeConfigFromRepositoryWithReviews(reviewComments bool, onApproval string) func(*github.Client, context.Context, string, string, string) (*config.ArianeConfig, error) {
+	return func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		return &config.ArianeConfig{
+			Triggers: map[string]config.TriggerConfig{
+				"/test": {
+					Workflows: []string{"foo.yaml"},
+				},
+			},
+			Workflows: map[string]config.WorkflowPathsRegexConfig{
+				"foo.yaml": {
+					PathsRegex: ".*",
+				},
+			},
+			ReviewsConfig: &config.ReviewsConfig{
+				ReviewComments: &reviewComments,
+				OnApproval:     onApproval,
+			},
+		}, nil
+	}
+}
+
+func TestPRReviewHandler(t *testing.T) {
+	testCases := []struct {
+		name              string
+		state             string
+		body              string
+		onApproval        string
+		expectClient      bool
+		expectedReactions []string
+	}{
+		{
+			name:              "command in review body",
+			state:             "commented",
+			body:              "Looks good overall\n/test",
+			expectClient:      true,
+			expectedReactions: []string{"eyes", "rocket"},
+		},
+		{
+			name:              "approved review runs on-approval trigger",
+			state:             "approved",
+			body:              "LGTM",
+			onApproval:        "/test",
+			expectClient:      true,
+			expectedReactions: []string{"eyes", "rocket"},
+		},
+		{
+			name:              "approved review does not run on-approval trigger twice",
+			state:             "approved",
+			body:              "/test",
+			onApproval:        "/test",
+			expectClient:      true,
+			expectedReactions: []string{"eyes", "rocket"},
+		},
+		{
+			name:              "approved review without on-approval trigger",
+			state:             "approved",
+			body:              "LGTM",
+			expectClient:      true,
+			expectedReactions: []string{},
+		},
+		{
+			name:              "review without command",
+			state:             "changes_requested",
+			body:              "Please fix",
+			expectClient:      false,
+			expectedReactions: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = mockGetArianeConfigFromRepositoryWithReviews(false, tc.onApproval)
+
+			reactions := make([]string, 0, 10)
+			server := setMockServerWithFeedbackConfig(false, false, &reactions, false, false)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			if tc.expectClient {
+				mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
+			}
+
+			handler := &PRReviewHandler{
+				Config: Config{
+					ClientCreator:    mockClientCreator,
+					RunDelay:         time.Second,
+					MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+				},
+			}
+
+			event := github.PullRequestReviewEvent{
+				Action:      github.Ptr("submitted"),
+				PullRequest: &github.PullRequest{Number: github.Ptr(0)},
+				Review: &github.PullRequestReview{
+					ID:    github.Ptr(int64(1)),
+					State: github.Ptr(tc.state),
+					Body:  github.Ptr(tc.body),
+					User:  &github.User{Login: github.Ptr("user")},
+				},
+				Repo: &github.Repository{
+					Owner: &github.User{Login: github.Ptr("owner")},
+					Name:  github.Ptr("repo"),
+				},
+			}
+			payload, err := json.Marshal(event)
+			if err != nil {
+				t.Fatalf("Failed to marshal event: %v", err)
+			}
+
+			err = handler.Handle(context.Background(), "pull_request_review", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.EqualValues(t, tc.expectedReactions, reactions)
+		})
+	}
+}
+
+func TestPRReviewCommentHandler(t *testing.T) {
+	testCases := []struct {
+		name              string
+		reviewComments    bool
+		expectedReactions []string
+	}{
+		{
+			name:              "review comments enabled",
+			reviewComments:    true,
+			expectedReactions: []string{"eyes", "rocket"},
+		},
+		{
+			name:              "review comments disabled",
+			reviewComments:    false,
+			expectedReactions: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = mockGetArianeConfigFromRepositoryWithReviews(tc.reviewComments, "")
+
+			reactions := make([]string, 0, 10)
+			server := setMockServerWithFeedbackConfig(false, false, &reactions, false, false)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(0)).Return(client, nil)
+
+			handler := &PRReviewCommentHandler{
+				Config: Config{
+					ClientCreator:    mockClientCreator,
+					RunDelay:         time.Second,
+					MaxRetryAttempts: config.DefaultMaxRetryAttempts,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "created",
+				"pull_request": {
+					"number": 0
+				},
+				"comment": {
+					"id": 1,
+					"body": "/test",
+					"user": {
+						"login": "user"
+					}
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "pull_request_review_comment", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.EqualValues(t, tc.expectedReactions, reactions)
+		})
+	}
+}
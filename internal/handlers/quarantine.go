@@ -0,0 +1,232 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+// quarantineExternalID identifies the check runs Ariane completes on behalf of failed jobs of quarantined workflows
+const quarantineExternalID = "ariane-quarantine"
+
+// isQuarantined returns whether workflow is currently quarantined in repository
+func isQuarantined(store *flakes.Store, repository, workflow string) bool {
+	if store == nil {
+		return false
+	}
+	decision, ok := store.Decision(repository, workflow)
+	return ok && decision.Kind == flakes.KindQuarantine
+}
+
+// reportQuarantine reports a quarantine decision about workflow on a pull request
+func reportQuarantine(ctx context.Context, commenter *GithubCommenter, arianeConfig *config.ArianeConfig, prNumber int, author, command, workflow, message string, logger zerolog.Logger) error {
+	data := config.FeedbackData{Author: author, Command: command, Workflow: workflow, Quarantine: message}
+	comment := feedbackMessage(arianeConfig, config.TemplateQuarantine, data, logger)
+	return commenter.report(ctx, arianeConfig, prNumber, config.TemplateQuarantine, workflow, comment)
+}
+
+// evaluateQuarantine quarantines workflowName if its flake rate reached the configured threshold, and
+// reports the decision on the pull request. Only the runs since the workflow was last un-quarantined
+// are considered, so that it is not quarantined again right away.
+func (w *WorkflowRunHandler) evaluateQuarantine(
+	ctx context.Context,
+	client *github.Client,
+	workflowName string,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	logger zerolog.Logger,
+) {
+	if w.FlakeStore == nil || arianeConfig.QuarantineConfig == nil {
+		return
+	}
+	threshold := arianeConfig.QuarantineConfig.FlakeRate
+	if threshold <= 0 {
+		// every workflow would be quarantined, including the ones which never flaked
+		logger.Warn().Msgf("Invalid quarantine flake rate %.3f, not evaluating quarantine", threshold)
+		return
+	}
+	repository := repositoryOwner + "/" + repositoryName
+	decision, decided := w.FlakeStore.Decision(repository, workflowName)
+	if decided && decision.Kind == flakes.KindQuarantine {
+		return
+	}
+
+	period, err := flakes.ParsePeriod(arianeConfig.GetQuarantinePeriod())
+	if err != nil {
+		logger.Error().Err(err).Msg("Invalid quarantine period, not evaluating quarantine")
+		return
+	}
+	since := time.Now().Add(-period)
+	if decided && decision.Time.After(since) {
+		since = decision.Time
+	}
+
+	for _, rate := range w.FlakeStore.Rates(repository, since) {
+		if rate.Workflow != workflowName || rate.Job != "" {
+			continue
+		}
+		logger.Debug().Msgf("Workflow '%s' flake rate is %.3f over %d runs (quarantine threshold: %.3f)", workflowName, rate.FlakeRate, rate.Runs, threshold)
+		if rate.Runs < arianeConfig.GetQuarantineMinRuns() || rate.FlakeRate < threshold {
+			return
+		}
+
+		reason := fmt.Sprintf("flake rate of %.1f%% over the last %d runs, reaching the %.1f%% threshold", rate.FlakeRate*100, rate.Runs, threshold*100)
+		err := w.FlakeStore.Add(flakes.Record{
+			Kind:       flakes.KindQuarantine,
+			Repository: repository,
+			Workflow:   workflowName,
+			PR:         pullRequest.GetNumber(),
+			Reason:     reason,
+		})
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to quarantine workflow '%s'", workflowName)
+			return
+		}
+		logger.Info().Msgf("Quarantined workflow '%s': %s", workflowName, reason)
+
+		message := fmt.Sprintf("🚧 Workflow `%s` is now quarantined, with a %s. Its failures are flagged as known flakes, until a maintainer runs `/ariane unquarantine %s`.", workflowName, reason, workflowName)
+		_ = reportQuarantine(ctx, NewGithubCommenter(client, repositoryOwner, repositoryName, w.BotLogin, logger), arianeConfig, pullRequest.GetNumber(), "", "", workflowName, message, logger)
+
+		// the failure of the workflow no longer fails the aggregate check run of the pull request
+		if defaultConfig, err := configGetArianeConfigFromRepository(client, ctx, repositoryOwner, repositoryName, ""); err != nil {
+			logger.Debug().Err(err).Msg("Failed to retrieve Ariane config of the default branch")
+		} else {
+			_ = updateRequiredCheck(ctx, client, repositoryOwner, repositoryName, pullRequest.GetHead().GetSHA(), defaultConfig, w.FlakeStore, w.DispatchedRuns, logger)
+		}
+		return
+	}
+}
+
+// flagQuarantinedFailure flags the failed jobs of a quarantined workflow's run as known flakes with
+// neutral check runs of the same names, linking to the real jobs, and reports it. The failed check runs
+// of the jobs are created by GitHub Actions and cannot be completed by Ariane, so they still apply to
+// branch protection when required individually: quarantined workflows only stop blocking pull requests
+// through the aggregate check run (see updateRequiredCheck).
+func (w *WorkflowRunHandler) flagQuarantinedFailure(
+	ctx context.Context,
+	client *github.Client,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	logger zerolog.Logger,
+) error {
+	jobs, err := listFailedJobs(ctx, client, repositoryOwner, repositoryName, workflowRun.GetID())
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to list workflow jobs for run ID %d", workflowRun.GetID())
+		return err
+	}
+
+	var flagged []string
+	for _, job := range jobs {
+		summary := fmt.Sprintf("Workflow `%s` is quarantined as flaky, so this failure is a known flake. The check of the [failed job](%s) still applies to branch protection.", workflowName, job.GetHTMLURL())
+		_, _, err := client.Checks.CreateCheckRun(ctx, repositoryOwner, repositoryName, github.CreateCheckRunOptions{
+			Name:        job.GetName(),
+			HeadSHA:     workflowRun.GetHeadSHA(),
+			DetailsURL:  github.Ptr(job.GetHTMLURL()),
+			ExternalID:  github.Ptr(quarantineExternalID),
+			Status:      github.Ptr("completed"),
+			Conclusion:  github.Ptr("neutral"),
+			CompletedAt: &github.Timestamp{Time: time.Now()},
+			Output: &github.CheckRunOutput{
+				Title:   github.Ptr(fmt.Sprintf("Quarantined: %s failed", job.GetName())),
+				Summary: github.Ptr(summary),
+			},
+		})
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to complete check %s of quarantined workflow '%s'", job.GetName(), workflowName)
+			return err
+		}
+		flagged = append(flagged, fmt.Sprintf("`%s`", job.GetName()))
+	}
+	if len(flagged) == 0 {
+		return nil
+	}
+	logger.Info().Msgf("Flagged failed checks of quarantined workflow '%s' (run ID: %d) as known flakes", workflowName, workflowRun.GetID())
+
+	name := fmt.Sprintf("`%s`", workflowName)
+	if workflowRun.GetHTMLURL() != "" {
+		name = fmt.Sprintf("[`%s`](%s)", workflowName, workflowRun.GetHTMLURL())
+	}
+	message := fmt.Sprintf("🚧 Workflow %s failed, but it is quarantined as flaky: its failed checks (%s) were flagged as known flakes. They do not fail the aggregate required check, but still apply to branch protection if required individually.", name, strings.Join(flagged, ", "))
+	return reportQuarantine(ctx, NewGithubCommenter(client, repositoryOwner, repositoryName, w.BotLogin, logger), arianeConfig, pullRequest.GetNumber(), "", "", workflowName, message, logger)
+}
+
+// parseUnquarantineCommand returns whether command is the built-in /ariane unquarantine <workflow>
+// command, and the workflow it un-quarantines
+func parseUnquarantineCommand(command string) (bool, string) {
+	fields := strings.Fields(command)
+	if len(fields) < 2 || fields[0] != "/ariane" || fields[1] != "unquarantine" {
+		return false, ""
+	}
+	return true, strings.Join(fields[2:], " ")
+}
+
+// unquarantine replies to the /ariane unquarantine command, so that the failures of workflow are no
+// longer flagged as known flakes. Only repository maintainers, with the admin or maintain role, can un-quarantine workflows.
+func (r *commandRunner) unquarantine(ctx context.Context, commenter *GithubCommenter, lifecycle *reactionLifecycle, arianeConfig *config.ArianeConfig, req commandRequest, command, headSHA, workflow string) error {
+	if err := lifecycle.transition(ctx, arianeConfig, reactionStateProcessing); err != nil {
+		return err
+	}
+
+	repository := req.owner + "/" + req.repo
+	reject := func(message, details string) error {
+		r.record(ctx, arianeConfig, req, headSHA, command, commandRejected, details)
+		_ = lifecycle.transition(ctx, arianeConfig, reactionStateFailed)
+		return reportQuarantine(ctx, commenter, arianeConfig, req.prNumber, req.author, command, workflow, message, r.logger)
+	}
+
+	switch {
+	case workflow == "":
+		return reject("❌ Usage: `/ariane unquarantine <workflow>`, with the name of a quarantined workflow.", "no workflow given")
+	case !isMaintainer(ctx, r.client, req.owner, req.repo, req.author, r.logger):
+		return reject(fmt.Sprintf("❌ Sorry @%s, only maintainers of the repository can un-quarantine workflows.", req.author), "author is not a maintainer")
+	case r.flakeStore == nil:
+		return reject("ℹ️ Flakiness history is not recorded by this Ariane instance, no workflow is quarantined.", "flakiness history is not recorded")
+	case !isQuarantined(r.flakeStore, repository, workflow):
+		message := fmt.Sprintf("ℹ️ Workflow `%s` is not quarantined.", workflow)
+		var names []string
+		for _, decision := range r.flakeStore.Quarantined(repository) {
+			names = append(names, fmt.Sprintf("`%s`", decision.Workflow))
+		}
+		if len(names) > 0 {
+			message += fmt.Sprintf(" Quarantined workflows: %s.", strings.Join(names, ", "))
+		}
+		return reject(message, "workflow is not quarantined")
+	}
+
+	err := r.flakeStore.Add(flakes.Record{
+		Kind:       flakes.KindRelease,
+		Repository: repository,
+		Workflow:   workflow,
+		PR:         req.prNumber,
+		Actor:      req.author,
+		Reason:     fmt.Sprintf("un-quarantined by @%s", req.author),
+	})
+	if err != nil {
+		r.logger.Error().Err(err).Msgf("Failed to un-quarantine workflow '%s'", workflow)
+		r.record(ctx, arianeConfig, req, headSHA, command, commandFailed, err.Error())
+		_ = lifecycle.transition(ctx, arianeConfig, reactionStateFailed)
+		return err
+	}
+	r.logger.Info().Msgf("Workflow '%s' un-quarantined by %s", workflow, req.author)
+	r.record(ctx, arianeConfig, req, headSHA, command, commandAccepted, fmt.Sprintf("un-quarantined %s", workflow))
+	if err := lifecycle.transition(ctx, arianeConfig, reactionStateTriggered); err != nil {
+		return err
+	}
+
+	message := fmt.Sprintf("✅ Workflow `%s` was un-quarantined by @%s: its failures are no longer flagged as known flakes.", workflow, req.author)
+	return reportQuarantine(ctx, commenter, arianeConfig, req.prNumber, req.author, command, workflow, message, r.logger)
+}
@@ -0,0 +1,253 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+func TestWorkflowRunHandler_Quarantine(t *testing.T) {
+	testCases := []struct {
+		name               string
+		flakeRate          float64
+		decisions          []flakes.Record
+		expectedComments   []string
+		expectedChecks     []string
+		expectedQuarantine bool
+	}{
+		{
+			name:      "flake rate reaches the threshold",
+			flakeRate: 0.5,
+			expectedComments: []string{
+				"🚧 Workflow `test-workflow` is now quarantined, with a flake rate of 66.7% over the last 3 runs, reaching the 50.0% threshold. Its failures are flagged as known flakes, until a maintainer runs `/ariane unquarantine test-workflow`.",
+				"🚧 Workflow [`test-workflow`](https://github.com/owner/repo/actions/runs/123) failed, but it is quarantined as flaky: its failed checks (`unit`) were flagged as known flakes. They do not fail the aggregate required check, but still apply to branch protection if required individually.",
+			},
+			expectedChecks:     []string{"unit"},
+			expectedQuarantine: true,
+		},
+		{
+			name:      "runs before un-quarantine are not considered",
+			flakeRate: 0.5,
+			decisions: []flakes.Record{
+				{Kind: flakes.KindQuarantine, Repository: "owner/repo", Workflow: "test-workflow"},
+				{Kind: flakes.KindRelease, Repository: "owner/repo", Workflow: "test-workflow", Actor: "maintainer"},
+			},
+		},
+		{
+			name: "flake rate unset",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					QuarantineConfig: &config.QuarantineConfig{FlakeRate: tc.flakeRate, MinRuns: 3},
+				}, nil
+			}
+
+			store, err := flakes.Open("")
+			if err != nil {
+				t.Fatalf("Failed to open flakes store: %v", err)
+			}
+			// two runs of the workflow failed at first, then succeeded once rerun
+			for _, runID := range []int64{1, 2} {
+				assert.NoError(t, store.Add(flakes.Record{Kind: flakes.KindOutcome, Repository: "owner/repo", Workflow: "test-workflow", RunID: runID, Attempt: 1, Conclusion: "failure"}))
+				assert.NoError(t, store.Add(flakes.Record{Kind: flakes.KindOutcome, Repository: "owner/repo", Workflow: "test-workflow", RunID: runID, Attempt: 2, Conclusion: "success"}))
+			}
+			for _, decision := range tc.decisions {
+				assert.NoError(t, store.Add(decision))
+			}
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			var comments, checks []string
+			mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+					Number: github.Ptr(1),
+					User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+				}})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Jobs{
+					TotalCount: github.Ptr(2),
+					Jobs: []*github.WorkflowJob{
+						{ID: github.Ptr[int64](1), Name: github.Ptr("build"), Conclusion: github.Ptr("success")},
+						{ID: github.Ptr[int64](2), Name: github.Ptr("unit"), Conclusion: github.Ptr("failure"), HTMLURL: github.Ptr("https://github.com/owner/repo/actions/runs/123/job/2")},
+					},
+				})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				var check github.CreateCheckRunOptions
+				_ = json.NewDecoder(r.Body).Decode(&check)
+				assert.Equal(t, "abc123", check.HeadSHA)
+				assert.Equal(t, "neutral", check.GetConclusion())
+				assert.Equal(t, "https://github.com/owner/repo/actions/runs/123/job/2", check.GetDetailsURL())
+				checks = append(checks, check.Name)
+				_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr[int64](1)})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				comments = append(comments, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(comment)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator: mockClientCreator,
+					FlakeStore:    store,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "completed",
+				"workflow": {
+					"name": "test-workflow",
+					"path": ".github/workflows/test.yaml"
+				},
+				"workflow_run": {
+					"id": 123,
+					"run_attempt": 1,
+					"head_sha": "abc123",
+					"conclusion": "failure",
+					"html_url": "https://github.com/owner/repo/actions/runs/123",
+					"pull_requests": [
+						{
+							"number": 1
+						}
+					]
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedComments, comments)
+			assert.Equal(t, tc.expectedChecks, checks)
+			assert.Equal(t, tc.expectedQuarantine, isQuarantined(store, "owner/repo", "test-workflow"))
+		})
+	}
+}
+
+func TestCommandRunner_Unquarantine(t *testing.T) {
+	testCases := []struct {
+		name               string
+		command            string
+		role               string
+		expectedComment    string
+		expectedQuarantine bool
+	}{
+		{
+			name:            "quarantined workflow",
+			command:         "/ariane unquarantine test workflow",
+			role:            "maintain",
+			expectedComment: "✅ Workflow `test workflow` was un-quarantined by @maintainer: its failures are no longer flagged as known flakes.",
+		},
+		{
+			name:               "author is not a maintainer",
+			command:            "/ariane unquarantine test workflow",
+			role:               "write",
+			expectedComment:    "❌ Sorry @maintainer, only maintainers of the repository can un-quarantine workflows.",
+			expectedQuarantine: true,
+		},
+		{
+			name:               "workflow not quarantined",
+			command:            "/ariane unquarantine other",
+			role:               "admin",
+			expectedComment:    "ℹ️ Workflow `other` is not quarantined. Quarantined workflows: `test workflow`.",
+			expectedQuarantine: true,
+		},
+		{
+			name:               "no workflow",
+			command:            "/ariane unquarantine",
+			expectedComment:    "❌ Usage: `/ariane unquarantine <workflow>`, with the name of a quarantined workflow.",
+			expectedQuarantine: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := flakes.Open("")
+			if err != nil {
+				t.Fatalf("Failed to open flakes store: %v", err)
+			}
+			assert.NoError(t, store.Add(flakes.Record{Kind: flakes.KindQuarantine, Repository: "owner/repo", Workflow: "test workflow"}))
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			var comments []string
+			mux.HandleFunc("/repos/owner/repo/issues/comments/42/reactions", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Reaction{ID: github.Ptr[int64](1)})
+			})
+			mux.HandleFunc("/repos/owner/repo/issues/comments/42/reactions/{id}", func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				comments = append(comments, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(comment)
+			})
+			mux.HandleFunc("GET /repos/owner/repo/collaborators/maintainer/permission", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.RepositoryPermissionLevel{RoleName: github.Ptr(tc.role)})
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			logger := zerolog.Nop()
+			runner := &commandRunner{client: client, flakeStore: store, logger: logger}
+			req := commandRequest{owner: "owner", repo: "repo", prNumber: 1, author: "maintainer"}
+			arianeConfig := &config.ArianeConfig{}
+			commenter := NewGithubCommenter(client, "owner", "repo", "ariane[bot]", logger)
+			lifecycle := newReactionLifecycle(commenter, reactionTarget{kind: reactionTargetIssueComment, id: 42}, false)
+
+			ok, workflow := parseUnquarantineCommand(tc.command)
+			assert.True(t, ok)
+			_ = runner.unquarantine(context.Background(), commenter, lifecycle, arianeConfig, req, tc.command, "abc123", workflow)
+			assert.Equal(t, []string{tc.expectedComment}, comments)
+			assert.Equal(t, tc.expectedQuarantine, isQuarantined(store, "owner/repo", "test workflow"))
+		})
+	}
+}
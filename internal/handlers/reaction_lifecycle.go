@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+// reactionState is a stage of the command lifecycle, reported by Ariane's reaction on the command
+type reactionState string
+
+const (
+	reactionStateNone                 reactionState = ""
+	reactionStateProcessing           reactionState = config.ReactionProcessing
+	reactionStateDependencyInProgress reactionState = config.ReactionDependencyInProgress
+	reactionStateFailed               reactionState = config.ReactionFailed
+	reactionStateTriggered            reactionState = config.ReactionTriggered
+)
+
+// reactionTransitions lists the states reachable from each state. Final states can go back to
+// processing, as a single comment may contain several commands.
+var reactionTransitions = map[reactionState][]reactionState{
+	reactionStateNone:                 {reactionStateProcessing},
+	reactionStateProcessing:           {reactionStateDependencyInProgress, reactionStateFailed, reactionStateTriggered},
+	reactionStateDependencyInProgress: {reactionStateProcessing},
+	reactionStateFailed:               {reactionStateProcessing},
+	reactionStateTriggered:            {reactionStateProcessing},
+}
+
+// reactionLifecycle reports the state of the commands sent through a target with a single reaction,
+// replacing Ariane's previous reaction at each transition
+type reactionLifecycle struct {
+	commenter *GithubCommenter
+	target    reactionTarget
+	state     reactionState
+	// reactionID is the ID of the reaction currently reporting state
+	reactionID int64
+	// replacePrior makes the first transition also remove the reactions Ariane added to the target
+	// while handling earlier events (e.g. before a comment was edited, or on previous PR events)
+	replacePrior bool
+}
+
+func newReactionLifecycle(commenter *GithubCommenter, target reactionTarget, replacePrior bool) *reactionLifecycle {
+	return &reactionLifecycle{
+		commenter:    commenter,
+		target:       target,
+		replacePrior: replacePrior,
+	}
+}
+
+// transition reacts on the target with the reaction configured for the given state, and removes the
+// reaction of the previous state
+func (l *reactionLifecycle) transition(ctx context.Context, arianeConfig *config.ArianeConfig, to reactionState) error {
+	if !slices.Contains(reactionTransitions[l.state], to) {
+		return fmt.Errorf("invalid reaction transition from %q to %q", l.state, to)
+	}
+
+	reaction, err := l.commenter.react(ctx, l.target, arianeConfig.GetReaction(string(to)))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case l.replacePrior:
+		// Ariane's login is only known from the reactions it created
+		if login := reaction.GetUser().GetLogin(); login != "" {
+			reactions, err := l.commenter.listReactions(ctx, l.target)
+			if err == nil {
+				for _, prior := range reactions {
+					if prior.GetID() != reaction.GetID() && prior.GetUser().GetLogin() == login {
+						_ = l.commenter.deleteReaction(ctx, l.target, prior.GetID())
+					}
+				}
+			}
+		}
+		l.replacePrior = false
+	case l.reactionID != 0 && l.reactionID != reaction.GetID():
+		// creating a reaction which already exists returns the existing one, which must be kept
+		_ = l.commenter.deleteReaction(ctx, l.target, l.reactionID)
+	}
+
+	l.state = to
+	l.reactionID = reaction.GetID()
+	return nil
+}
@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func Test_reactionLifecycle(t *testing.T) {
+	reactionIDs := map[string]int64{"eyes": 1, "+1": 2, "confused": 3, "rocket": 4, "heart": 5}
+
+	testCases := []struct {
+		name              string
+		target            reactionTarget
+		replacePrior      bool
+		prior             []*github.Reaction
+		transitions       []reactionState
+		expectedReactions []string
+		expectedDeleted   []string
+		expectedError     bool
+	}{
+		{
+			name:              "each transition replaces the previous reaction",
+			target:            reactionTarget{kind: reactionTargetIssueComment, id: 1},
+			transitions:       []reactionState{reactionStateProcessing, reactionStateDependencyInProgress},
+			expectedReactions: []string{"eyes", "+1"},
+			expectedDeleted:   []string{"/repos/owner/repo/issues/comments/1/reactions/1"},
+		},
+		{
+			name:   "several commands on the same target",
+			target: reactionTarget{kind: reactionTargetReviewComment, id: 1},
+			transitions: []reactionState{
+				reactionStateProcessing, reactionStateTriggered,
+				reactionStateProcessing, reactionStateFailed,
+			},
+			expectedReactions: []string{"eyes", "rocket", "eyes", "confused"},
+			expectedDeleted: []string{
+				"/repos/owner/repo/pulls/comments/1/reactions/1",
+				"/repos/owner/repo/pulls/comments/1/reactions/4",
+				"/repos/owner/repo/pulls/comments/1/reactions/1",
+			},
+		},
+		{
+			name:         "prior reactions of Ariane are replaced",
+			target:       reactionTarget{kind: reactionTargetPullRequest, id: 7},
+			replacePrior: true,
+			prior: []*github.Reaction{
+				{ID: github.Ptr(int64(4)), Content: github.Ptr("rocket"), User: &github.User{Login: github.Ptr("ariane[bot]")}},
+				{ID: github.Ptr(int64(10)), Content: github.Ptr("rocket"), User: &github.User{Login: github.Ptr("user")}},
+				{ID: github.Ptr(int64(1)), Content: github.Ptr("eyes"), User: &github.User{Login: github.Ptr("ariane[bot]")}},
+			},
+			transitions:       []reactionState{reactionStateProcessing, reactionStateTriggered},
+			expectedReactions: []string{"eyes", "rocket"},
+			expectedDeleted: []string{
+				"/repos/owner/repo/issues/7/reactions/4",
+				"/repos/owner/repo/issues/7/reactions/1",
+			},
+		},
+		{
+			name:          "invalid transition",
+			target:        reactionTarget{kind: reactionTargetIssueComment, id: 1},
+			transitions:   []reactionState{reactionStateTriggered},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var reactions, deleted []string
+			mux := http.NewServeMux()
+			for _, path := range []string{"/repos/owner/repo/issues/comments/1/reactions", "/repos/owner/repo/pulls/comments/1/reactions", "/repos/owner/repo/issues/7/reactions"} {
+				mux.HandleFunc("POST "+path, func(w http.ResponseWriter, r *http.Request) {
+					var reaction github.Reaction
+					_ = json.NewDecoder(r.Body).Decode(&reaction)
+					reactions = append(reactions, reaction.GetContent())
+					_ = json.NewEncoder(w).Encode(github.Reaction{
+						ID:      github.Ptr(reactionIDs[reaction.GetContent()]),
+						Content: reaction.Content,
+						User:    &github.User{Login: github.Ptr("ariane[bot]")},
+					})
+				})
+				mux.HandleFunc("GET "+path, func(w http.ResponseWriter, r *http.Request) {
+					_ = json.NewEncoder(w).Encode(tc.prior)
+				})
+				mux.HandleFunc("DELETE "+path+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+					deleted = append(deleted, r.URL.Path)
+					w.WriteHeader(http.StatusNoContent)
+				})
+			}
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			lifecycle := newReactionLifecycle(NewGithubCommenter(client, "owner", "repo", "ariane[bot]", zerolog.Nop()), tc.target, tc.replacePrior)
+			for _, state := range tc.transitions {
+				err = lifecycle.transition(context.Background(), &config.ArianeConfig{}, state)
+				if tc.expectedError {
+					assert.Error(t, err, fmt.Sprintf("transition to %q", state))
+				} else {
+					assert.NoError(t, err, fmt.Sprintf("transition to %q", state))
+				}
+			}
+			assert.Equal(t, tc.expectedReactions, reactions)
+			assert.Equal(t, tc.expectedDeleted, deleted)
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+// requiredCheckExternalID identifies the aggregate check runs maintained by Ariane
+const requiredCheckExternalID = "ariane-required"
+
+// requiredWorkflowState returns the state of a workflow on sha: the conclusion of its latest run, skipped
+// if Ariane marked it as skipped, or an empty string while it has not completed, along with its run URL
+func requiredWorkflowState(ctx context.Context, client *github.Client, owner, repo, workflow, sha string, dispatchedRuns *DispatchedRunTracker) (string, string, error) {
+	runs, _, err := client.Actions.ListWorkflowRunsByFileName(ctx, owner, repo, workflow, &github.ListWorkflowRunsOptions{
+		HeadSHA:     sha,
+		ListOptions: github.ListOptions{PerPage: 1},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list runs of workflow %s: %w", workflow, err)
+	}
+	var lastRun *github.WorkflowRun
+	if len(runs.WorkflowRuns) > 0 {
+		lastRun = runs.WorkflowRuns[0]
+	}
+	// Runs dispatched for pull requests from forks run on the base branch, so only Ariane knows their commit
+	if runID, ok := dispatchedRuns.latest(owner, repo, workflow, sha); ok && runID > lastRun.GetID() {
+		lastRun, _, err = client.Actions.GetWorkflowRunByID(ctx, owner, repo, runID)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to retrieve run %d of workflow %s: %w", runID, workflow, err)
+		}
+	}
+	if lastRun != nil {
+		if lastRun.GetStatus() != "completed" {
+			return "", lastRun.GetHTMLURL(), nil
+		}
+		return lastRun.GetConclusion(), lastRun.GetHTMLURL(), nil
+	}
+
+	// Workflows skipped by path rules have no run, only the skipped check runs created by Ariane
+	checkRuns, err := latestCheckRuns(ctx, client, owner, repo, sha)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list check runs of %s: %w", sha, err)
+	}
+	for _, checkRun := range checkRuns {
+		if checkRun.GetExternalID() == skippedCheckExternalID(workflow) && checkRun.GetConclusion() == "skipped" {
+			return "skipped", "", nil
+		}
+	}
+	return "", "", nil
+}
+
+// isQuarantinedWorkflow returns whether the workflow file is quarantined in the repository. Quarantine
+// decisions are made on workflow names, so the name of the workflow is only retrieved if some
+// workflow of the repository is quarantined.
+func isQuarantinedWorkflow(ctx context.Context, client *github.Client, flakeStore *flakes.Store, owner, repo, workflow string) (bool, error) {
+	if flakeStore == nil || len(flakeStore.Quarantined(owner+"/"+repo)) == 0 {
+		return false, nil
+	}
+	wf, _, err := client.Actions.GetWorkflowByFileName(ctx, owner, repo, workflow)
+	if err != nil {
+		return false, fmt.Errorf("failed to retrieve workflow %s: %w", workflow, err)
+	}
+	return isQuarantined(flakeStore, owner+"/"+repo, wf.GetName()), nil
+}
+
+// updateRequiredCheck creates or updates the aggregate check run of sha from the states of the workflows
+// it summarizes. The check run is in progress until all of them completed, then succeeds if they all
+// succeeded, were skipped or failed while quarantined as flaky, and fails otherwise.
+func updateRequiredCheck(ctx context.Context, client *github.Client, owner, repo, sha string, arianeConfig *config.ArianeConfig, flakeStore *flakes.Store, dispatchedRuns *DispatchedRunTracker, logger zerolog.Logger) error {
+	name, workflows := arianeConfig.GetRequiredCheck()
+	if len(workflows) == 0 {
+		return nil
+	}
+
+	pending, failed, quarantined := 0, 0, 0
+	summary := "| Workflow | State |\n|----------|-------|\n"
+	for _, workflow := range workflows {
+		state, url, err := requiredWorkflowState(ctx, client, owner, repo, workflow, sha, dispatchedRuns)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to retrieve the state of required workflow %s on %s", workflow, sha)
+			return err
+		}
+		label := state
+		switch state {
+		case "":
+			pending++
+			label = "pending"
+		case "success", "skipped":
+		default:
+			isQuarantined, err := isQuarantinedWorkflow(ctx, client, flakeStore, owner, repo, workflow)
+			if err != nil {
+				logger.Error().Err(err).Msgf("Failed to check whether required workflow %s is quarantined", workflow)
+				return err
+			}
+			if isQuarantined {
+				quarantined++
+				label += " (quarantined)"
+			} else {
+				failed++
+			}
+		}
+		if url != "" {
+			label = fmt.Sprintf("[%s](%s)", label, url)
+		}
+		summary += fmt.Sprintf("| `%s` | %s |\n", workflow, label)
+	}
+
+	status, conclusion, title := "in_progress", "", fmt.Sprintf("%d/%d workflows pending", pending, len(workflows))
+	switch {
+	case pending > 0:
+		if failed > 0 {
+			title += fmt.Sprintf(", %d failed", failed)
+		}
+	case failed > 0:
+		status, conclusion, title = "completed", "failure", fmt.Sprintf("%d/%d workflows failed", failed, len(workflows))
+	case quarantined > 0:
+		status, conclusion, title = "completed", "success", fmt.Sprintf("All workflows succeeded or were skipped, %d/%d failed while quarantined", quarantined, len(workflows))
+	default:
+		status, conclusion, title = "completed", "success", "All workflows succeeded or were skipped"
+	}
+	output := &github.CheckRunOutput{Title: github.Ptr(title), Summary: github.Ptr(strings.TrimSuffix(summary, "\n"))}
+
+	checkRuns, _, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, &github.ListCheckRunsOptions{
+		CheckName: github.Ptr(name),
+		Filter:    github.Ptr("latest"),
+	})
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to list check runs of %s", sha)
+		return err
+	}
+	var existing *github.CheckRun
+	if i := slices.IndexFunc(checkRuns.CheckRuns, func(checkRun *github.CheckRun) bool {
+		return checkRun.GetExternalID() == requiredCheckExternalID
+	}); i >= 0 {
+		existing = checkRuns.CheckRuns[i]
+	}
+
+	// A completed check run is only updated with the same conclusion, a new check run replaces it otherwise
+	if existing != nil && (existing.GetStatus() != "completed" || existing.GetConclusion() == conclusion) {
+		opts := github.UpdateCheckRunOptions{Name: name, Status: github.Ptr(status), Output: output}
+		if conclusion != "" {
+			opts.Conclusion = github.Ptr(conclusion)
+		}
+		if _, _, err := client.Checks.UpdateCheckRun(ctx, owner, repo, existing.GetID(), opts); err != nil {
+			logger.Error().Err(err).Msgf("Failed to update check run %s of %s", name, sha)
+			return err
+		}
+	} else {
+		opts := github.CreateCheckRunOptions{
+			Name:       name,
+			HeadSHA:    sha,
+			Status:     github.Ptr(status),
+			ExternalID: github.Ptr(requiredCheckExternalID),
+			Output:     output,
+		}
+		if conclusion != "" {
+			opts.Conclusion = github.Ptr(conclusion)
+		}
+		if _, _, err := client.Checks.CreateCheckRun(ctx, owner, repo, opts); err != nil {
+			logger.Error().Err(err).Msgf("Failed to create check run %s of %s", name, sha)
+			return err
+		}
+	}
+	logger.Debug().Msgf("Updated check run %s of %s: %s", name, sha, title)
+	return nil
+}
+
+// isPullRequestEvent returns whether a workflow run was triggered by a pull request
+func isPullRequestEvent(event string) bool {
+	return event == "pull_request" || event == "pull_request_target"
+}
+
+// requiresWorkflow returns whether a workflow file is summarized by the aggregate check run
+func requiresWorkflow(arianeConfig *config.ArianeConfig, workflow string) bool {
+	_, workflows := arianeConfig.GetRequiredCheck()
+	return slices.Contains(workflows, workflow)
+}
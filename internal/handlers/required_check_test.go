@@ -0,0 +1,354 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+// requiredCheckServer serves the runs and check runs of the workflows summarized by an aggregate check run,
+// recording the aggregate check runs created and updated
+type requiredCheckServer struct {
+	runs map[string]*github.WorkflowRun
+	// runsByID are the runs which are not listed for the commit, e.g. runs dispatched for a pull request from a fork
+	runsByID  map[string]*github.WorkflowRun
+	checkRuns map[string][]*github.CheckRun
+	created   []github.CreateCheckRunOptions
+	updated   map[string]github.UpdateCheckRunOptions
+}
+
+func (s *requiredCheckServer) client(t *testing.T) (*github.Client, func()) {
+	s.updated = make(map[string]github.UpdateCheckRunOptions)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/actions/workflows/{workflow}/runs", func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "sha", r.FormValue("head_sha"))
+		var runs []*github.WorkflowRun
+		if run, ok := s.runs[r.PathValue("workflow")]; ok {
+			runs = append(runs, run)
+		}
+		_ = json.NewEncoder(w).Encode(github.WorkflowRuns{TotalCount: github.Ptr(len(runs)), WorkflowRuns: runs})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/actions/workflows/{workflow}", func(w http.ResponseWriter, r *http.Request) {
+		names := map[string]string{"ci.yaml": "CI", "e2e.yaml": "E2E"}
+		_ = json.NewEncoder(w).Encode(&github.Workflow{Name: github.Ptr(names[r.PathValue("workflow")])})
+	})
+	mux.HandleFunc("GET /repos/owner/repo/actions/runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		run, ok := s.runsByID[r.PathValue("id")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(run)
+	})
+	mux.HandleFunc("GET /repos/owner/repo/commits/sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		var checkRuns []*github.CheckRun
+		for name, runs := range s.checkRuns {
+			if r.FormValue("check_name") == "" || r.FormValue("check_name") == name {
+				checkRuns = append(checkRuns, runs...)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(&github.ListCheckRunsResults{Total: github.Ptr(len(checkRuns)), CheckRuns: checkRuns})
+	})
+	mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.CreateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		s.created = append(s.created, opts)
+		_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr[int64](1)})
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/check-runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.UpdateCheckRunOptions
+		_ = json.NewDecoder(r.Body).Decode(&opts)
+		s.updated[r.PathValue("id")] = opts
+		_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr[int64](1)})
+	})
+	server := httptest.NewServer(mux)
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+	return client, server.Close
+}
+
+func Test_updateRequiredCheck(t *testing.T) {
+	requiredCheck := func(id int64, status, conclusion string) []*github.CheckRun {
+		return []*github.CheckRun{{ID: github.Ptr(id), ExternalID: github.Ptr(requiredCheckExternalID), Status: github.Ptr(status), Conclusion: github.Ptr(conclusion)}}
+	}
+
+	testCases := []struct {
+		name               string
+		runs               map[string]*github.WorkflowRun
+		checkRuns          map[string][]*github.CheckRun
+		quarantined        []string
+		expectedCreated    bool
+		expectedUpdated    string
+		expectedStatus     string
+		expectedConclusion string
+		expectedTitle      string
+		expectedSummary    string
+	}{
+		{
+			name: "all workflows succeeded or were skipped",
+			runs: map[string]*github.WorkflowRun{
+				"ci.yaml": {Status: github.Ptr("completed"), Conclusion: github.Ptr("success"), HTMLURL: github.Ptr("https://github.com/owner/repo/actions/runs/1")},
+			},
+			checkRuns: map[string][]*github.CheckRun{
+				"E2E (ipv4)": {{ExternalID: github.Ptr(skippedCheckExternalID("e2e.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")}},
+			},
+			expectedCreated:    true,
+			expectedStatus:     "completed",
+			expectedConclusion: "success",
+			expectedTitle:      "All workflows succeeded or were skipped",
+			expectedSummary:    "| Workflow | State |\n|----------|-------|\n| `ci.yaml` | [success](https://github.com/owner/repo/actions/runs/1) |\n| `e2e.yaml` | skipped |",
+		},
+		{
+			name: "workflow pending",
+			runs: map[string]*github.WorkflowRun{
+				"ci.yaml": {Status: github.Ptr("completed"), Conclusion: github.Ptr("failure")},
+			},
+			checkRuns: map[string][]*github.CheckRun{
+				"ariane/required": requiredCheck(42, "in_progress", ""),
+			},
+			expectedUpdated: "42",
+			expectedStatus:  "in_progress",
+			expectedTitle:   "1/2 workflows pending, 1 failed",
+			expectedSummary: "| Workflow | State |\n|----------|-------|\n| `ci.yaml` | failure |\n| `e2e.yaml` | pending |",
+		},
+		{
+			name: "workflow failed after succeeding",
+			runs: map[string]*github.WorkflowRun{
+				"ci.yaml":  {Status: github.Ptr("completed"), Conclusion: github.Ptr("success")},
+				"e2e.yaml": {Status: github.Ptr("completed"), Conclusion: github.Ptr("timed_out")},
+			},
+			checkRuns: map[string][]*github.CheckRun{
+				"ariane/required": requiredCheck(42, "completed", "success"),
+			},
+			expectedCreated:    true,
+			expectedStatus:     "completed",
+			expectedConclusion: "failure",
+			expectedTitle:      "1/2 workflows failed",
+			expectedSummary:    "| Workflow | State |\n|----------|-------|\n| `ci.yaml` | success |\n| `e2e.yaml` | timed_out |",
+		},
+		{
+			name: "quarantined workflow failed",
+			runs: map[string]*github.WorkflowRun{
+				"ci.yaml":  {Status: github.Ptr("completed"), Conclusion: github.Ptr("success")},
+				"e2e.yaml": {Status: github.Ptr("completed"), Conclusion: github.Ptr("failure")},
+			},
+			quarantined:        []string{"E2E"},
+			expectedCreated:    true,
+			expectedStatus:     "completed",
+			expectedConclusion: "success",
+			expectedTitle:      "All workflows succeeded or were skipped, 1/2 failed while quarantined",
+			expectedSummary:    "| Workflow | State |\n|----------|-------|\n| `ci.yaml` | success |\n| `e2e.yaml` | failure (quarantined) |",
+		},
+		{
+			name: "other workflow quarantined",
+			runs: map[string]*github.WorkflowRun{
+				"ci.yaml":  {Status: github.Ptr("completed"), Conclusion: github.Ptr("success")},
+				"e2e.yaml": {Status: github.Ptr("completed"), Conclusion: github.Ptr("failure")},
+			},
+			quarantined:        []string{"CI"},
+			expectedCreated:    true,
+			expectedStatus:     "completed",
+			expectedConclusion: "failure",
+			expectedTitle:      "1/2 workflows failed",
+			expectedSummary:    "| Workflow | State |\n|----------|-------|\n| `ci.yaml` | success |\n| `e2e.yaml` | failure |",
+		},
+		{
+			name: "workflow rerun",
+			runs: map[string]*github.WorkflowRun{
+				"ci.yaml":  {Status: github.Ptr("completed"), Conclusion: github.Ptr("success")},
+				"e2e.yaml": {Status: github.Ptr("queued")},
+			},
+			checkRuns: map[string][]*github.CheckRun{
+				"ariane/required": requiredCheck(42, "completed", "failure"),
+			},
+			expectedCreated: true,
+			expectedStatus:  "in_progress",
+			expectedTitle:   "1/2 workflows pending",
+			expectedSummary: "| Workflow | State |\n|----------|-------|\n| `ci.yaml` | success |\n| `e2e.yaml` | pending |",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := &requiredCheckServer{runs: tc.runs, checkRuns: tc.checkRuns}
+			client, closeServer := server.client(t)
+			defer closeServer()
+
+			flakeStore, err := flakes.Open("")
+			if err != nil {
+				t.Fatalf("Failed to open flake store: %v", err)
+			}
+			for _, workflow := range tc.quarantined {
+				_ = flakeStore.Add(flakes.Record{Kind: flakes.KindQuarantine, Repository: "owner/repo", Workflow: workflow})
+			}
+
+			arianeConfig := &config.ArianeConfig{
+				ChecksConfig: &config.ChecksConfig{Required: &config.RequiredCheckConfig{Workflows: []string{"ci.yaml", "e2e.yaml"}}},
+			}
+			err = updateRequiredCheck(context.Background(), client, "owner", "repo", "sha", arianeConfig, flakeStore, nil, zerolog.Nop())
+			assert.NoError(t, err)
+
+			var status, conclusion string
+			var output *github.CheckRunOutput
+			if tc.expectedCreated {
+				if !assert.Len(t, server.created, 1) {
+					return
+				}
+				assert.Empty(t, server.updated)
+				assert.Equal(t, "ariane/required", server.created[0].Name)
+				assert.Equal(t, "sha", server.created[0].HeadSHA)
+				assert.Equal(t, requiredCheckExternalID, server.created[0].GetExternalID())
+				status, conclusion, output = server.created[0].GetStatus(), server.created[0].GetConclusion(), server.created[0].Output
+			} else {
+				assert.Empty(t, server.created)
+				update, ok := server.updated[tc.expectedUpdated]
+				if !assert.True(t, ok) {
+					return
+				}
+				status, conclusion, output = update.GetStatus(), update.GetConclusion(), update.Output
+			}
+			assert.Equal(t, tc.expectedStatus, status)
+			assert.Equal(t, tc.expectedConclusion, conclusion)
+			assert.Equal(t, tc.expectedTitle, output.GetTitle())
+			assert.Equal(t, tc.expectedSummary, output.GetSummary())
+		})
+	}
+}
+
+func TestWorkflowRunHandler_RequiredCheck(t *testing.T) {
+	dispatchedRuns := &DispatchedRunTracker{}
+	dispatchedRuns.add(5999, dispatchedRun{owner: "owner", repo: "repo", prNumber: 1, workflow: "ci.yaml", sha: "sha"})
+
+	testCases := []struct {
+		name               string
+		workflowPath       string
+		runID              int64
+		event              string
+		headSHA            string
+		expectedConfigRead bool
+		expectedCreated    bool
+	}{
+		{
+			name:               "required workflow",
+			workflowPath:       ".github/workflows/ci.yaml",
+			runID:              6001,
+			event:              "pull_request",
+			headSHA:            "sha",
+			expectedConfigRead: true,
+			expectedCreated:    true,
+		},
+		{
+			name:               "other workflow",
+			workflowPath:       ".github/workflows/lint.yaml",
+			runID:              6001,
+			event:              "pull_request",
+			headSHA:            "sha",
+			expectedConfigRead: true,
+		},
+		{
+			name:         "run unrelated to a pull request",
+			workflowPath: ".github/workflows/ci.yaml",
+			runID:        6001,
+			event:        "push",
+			headSHA:      "sha",
+		},
+		{
+			name:               "run dispatched for a pull request from a fork",
+			workflowPath:       ".github/workflows/ci.yaml",
+			runID:              5999,
+			event:              "workflow_dispatch",
+			headSHA:            "base-sha",
+			expectedConfigRead: true,
+			expectedCreated:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configRead := false
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				assert.Empty(t, ref, "the aggregate check run is configured on the default branch")
+				configRead = true
+				return &config.ArianeConfig{
+					ChecksConfig: &config.ChecksConfig{Required: &config.RequiredCheckConfig{Name: "required", Workflows: []string{"ci.yaml"}}},
+				}, nil
+			}
+
+			server := &requiredCheckServer{runs: map[string]*github.WorkflowRun{}, runsByID: map[string]*github.WorkflowRun{}}
+			if tc.headSHA == "sha" {
+				server.runs["ci.yaml"] = &github.WorkflowRun{ID: github.Ptr(tc.runID), Status: github.Ptr("in_progress")}
+			} else {
+				server.runsByID[strconv.FormatInt(tc.runID, 10)] = &github.WorkflowRun{ID: github.Ptr(tc.runID), Status: github.Ptr("in_progress")}
+			}
+			client, closeServer := server.client(t)
+			defer closeServer()
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil).MaxTimes(1)
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator:  mockClientCreator,
+					DispatchedRuns: dispatchedRuns,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "in_progress",
+				"workflow": {
+					"name": "CI",
+					"path": "` + tc.workflowPath + `"
+				},
+				"workflow_run": {
+					"id": ` + strconv.FormatInt(tc.runID, 10) + `,
+					"event": "` + tc.event + `",
+					"status": "in_progress",
+					"head_sha": "` + tc.headSHA + `"
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err := handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfigRead, configRead)
+			if tc.expectedCreated {
+				if assert.Len(t, server.created, 1) {
+					assert.Equal(t, "required", server.created[0].Name)
+					assert.Equal(t, "sha", server.created[0].HeadSHA, "the aggregate check run is created on the pull request head")
+					assert.Equal(t, "in_progress", server.created[0].GetStatus())
+				}
+			} else {
+				assert.Empty(t, server.created)
+			}
+		})
+	}
+}
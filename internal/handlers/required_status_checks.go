@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/google/go-github/v88/github"
+)
+
+// requiredStatusCheck is a status check required to merge into a branch, along with the ID of the app
+// which must provide it, 0 if any app can provide it
+type requiredStatusCheck struct {
+	context string
+	appID   int64
+}
+
+// requiredStatusChecks returns the status checks required to merge into a branch, by its branch
+// protection and by the rulesets applying to it
+func requiredStatusChecks(ctx context.Context, client *github.Client, owner, repo, branch string) ([]requiredStatusCheck, error) {
+	var checks []requiredStatusCheck
+	add := func(check requiredStatusCheck) {
+		if !slices.Contains(checks, check) {
+			checks = append(checks, check)
+		}
+	}
+
+	protection, _, err := client.Repositories.GetBranchProtection(ctx, owner, repo, branch)
+	if err != nil && !errors.Is(err, github.ErrBranchNotProtected) {
+		return nil, err
+	}
+	for _, check := range protection.GetRequiredStatusChecks().GetChecks() {
+		appID := check.GetAppID()
+		if appID < 0 {
+			appID = 0
+		}
+		add(requiredStatusCheck{context: check.Context, appID: appID})
+	}
+
+	for rule, err := range client.Repositories.ListRulesForBranchIter(ctx, owner, repo, branch, &github.ListOptions{PerPage: 100}) {
+		if err != nil {
+			return nil, err
+		}
+		// merge queue rules only set how merge groups are built and merged, along with the timeout of
+		// their checks: the checks merge groups require are the ones of required_status_checks rules
+		if rule, ok := rule.(*github.RequiredStatusChecksBranchRule); ok {
+			for _, check := range rule.Parameters.RequiredStatusChecks {
+				add(requiredStatusCheck{context: check.Context, appID: check.GetIntegrationID()})
+			}
+		}
+	}
+	return checks, nil
+}
+
+// providedBy returns whether the check can be provided by the app with the given ID, i.e. whether it is
+// required from that app or from any app
+func (c requiredStatusCheck) providedBy(appID int64) bool {
+	return c.appID == 0 || c.appID == appID
+}
+
+// isRequiredCheck returns whether a check run name is required to merge into the base branch of the pull
+// request, and can be provided by Ariane. Required status checks are retrieved once per processor, and
+// all checks are considered required if they cannot be retrieved.
+func (w *WorkflowProcessor) isRequiredCheck(ctx context.Context, name string) bool {
+	if w.requiredChecks == nil {
+		w.requiredChecks = make(map[string]bool)
+		if w.baseRef == "" {
+			w.allChecksRequired = true
+			return true
+		}
+		checks, err := requiredStatusChecks(ctx, w.client, w.owner, w.repo, w.baseRef)
+		if err != nil {
+			w.logger.Warn().Err(err).Msgf("Failed to retrieve the required status checks of %s, considering all checks as required", w.baseRef)
+			w.allChecksRequired = true
+			return true
+		}
+		for _, check := range checks {
+			if check.providedBy(w.appID) {
+				w.requiredChecks[check.context] = true
+			}
+		}
+	}
+	return w.allChecksRequired || w.requiredChecks[name]
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+// reserveRerun reserves the rerun of the given attempt of a workflow run in the rerun budget of its head
+// commit and in the daily rerun budget of the installation, by recording it in the flakiness history.
+// It returns whether the rerun fits in both, reporting on the pull request the budget it would exceed
+// otherwise. Reruns scheduled for later are reserved as well, so that they are accounted for until
+// they run. Without flakiness history, reruns are neither recorded nor limited.
+func (w *WorkflowRunHandler) reserveRerun(
+	ctx context.Context,
+	client *github.Client,
+	installationID int64,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	runAttempt int,
+	logger zerolog.Logger,
+) bool {
+	budgets := flakes.RerunBudgets{
+		Installation: w.DailyRerunBudget,
+		Since:        time.Now().UTC().Truncate(24 * time.Hour),
+	}
+	if arianeConfig.RerunConfig != nil {
+		budgets.Commit = arianeConfig.RerunConfig.PRBudget
+	}
+	if w.FlakeStore == nil {
+		if budgets.Commit > 0 || budgets.Installation > 0 {
+			logger.Warn().Msg("No flakiness history recorded, rerun budgets are not enforced")
+		}
+		return true
+	}
+
+	record := w.newFlakeRecord(flakes.KindRerun, installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, runAttempt, "")
+	commitReruns, installationReruns, reserved, err := w.FlakeStore.Reruns().Reserve(record, budgets)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to record rerun of workflow run %d in flakiness history", workflowRun.GetID())
+	}
+	if reserved {
+		return true
+	}
+
+	var reason string
+	if budgets.Commit > 0 && commitReruns >= budgets.Commit {
+		reason = fmt.Sprintf("the rerun budget of this PR is exhausted (%d/%d reruns of its head commit)", commitReruns, budgets.Commit)
+	} else {
+		reason = fmt.Sprintf("the daily rerun budget of Ariane is exhausted (%d/%d reruns today), reruns resume at midnight UTC", installationReruns, budgets.Installation)
+	}
+	logger.Info().Msgf("Not rerunning workflow '%s' (run ID: %d): %s", workflowName, workflowRun.GetID(), reason)
+
+	name := fmt.Sprintf("`%s`", workflowName)
+	if workflowRun.GetHTMLURL() != "" {
+		name = fmt.Sprintf("[`%s`](%s)", workflowName, workflowRun.GetHTMLURL())
+	}
+	data := config.FeedbackData{
+		Workflow: workflowName,
+		Budget:   fmt.Sprintf("💸 Not rerunning %s: %s.", name, reason),
+	}
+	comment := feedbackMessage(arianeConfig, config.TemplateRerunBudget, data, logger)
+	_ = NewGithubCommenter(client, repositoryOwner, repositoryName, w.BotLogin, logger).report(ctx, arianeConfig, pullRequest.GetNumber(), config.TemplateRerunBudget, workflowName, comment)
+	return false
+}
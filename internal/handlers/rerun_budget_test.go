@@ -0,0 +1,215 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+func TestWorkflowRunHandler_Failure_RerunBudget(t *testing.T) {
+	testCases := []struct {
+		name             string
+		prBudget         int
+		dailyBudget      int
+		reruns           []flakes.Record
+		dispatchedSHA    string
+		expectedRerun    bool
+		expectedComments []string
+	}{
+		{
+			name:     "within the PR budget",
+			prBudget: 2,
+			reruns: []flakes.Record{
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 7},
+			},
+			expectedRerun: true,
+		},
+		{
+			name:     "PR budget exhausted",
+			prBudget: 2,
+			reruns: []flakes.Record{
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 7},
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 8},
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "def456", Installation: 1, RunID: 9},
+			},
+			expectedComments: []string{"💸 Not rerunning [`test-workflow`](https://github.com/owner/repo/actions/runs/123): the rerun budget of this PR is exhausted (2/2 reruns of its head commit)."},
+		},
+		{
+			name:        "daily budget exhausted",
+			dailyBudget: 2,
+			reruns: []flakes.Record{
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "def456", Installation: 1, RunID: 7},
+				{Kind: flakes.KindRerun, Repository: "owner/other", SHA: "ghi789", Installation: 1, RunID: 8},
+				{Kind: flakes.KindRerun, Repository: "owner/other", SHA: "ghi789", Installation: 2, RunID: 9},
+			},
+			expectedComments: []string{"💸 Not rerunning [`test-workflow`](https://github.com/owner/repo/actions/runs/123): the daily rerun budget of Ariane is exhausted (2/2 reruns today), reruns resume at midnight UTC."},
+		},
+		{
+			name:     "pr budget released by a cancelled rerun",
+			prBudget: 2,
+			reruns: []flakes.Record{
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 7},
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 8},
+				{Kind: flakes.KindCancelledRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 8},
+			},
+			expectedRerun: true,
+		},
+		{
+			name:     "PR budget of a run dispatched for a pull request from a fork",
+			prBudget: 2,
+			reruns: []flakes.Record{
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 7},
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "abc123", Installation: 1, RunID: 8},
+			},
+			dispatchedSHA: "fork123",
+			expectedRerun: true,
+		},
+		{
+			name:     "PR budget of a pull request from a fork exhausted",
+			prBudget: 2,
+			reruns: []flakes.Record{
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "fork123", Installation: 1, RunID: 7},
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "fork123", Installation: 1, RunID: 8},
+			},
+			dispatchedSHA:    "fork123",
+			expectedComments: []string{"💸 Not rerunning [`test-workflow`](https://github.com/owner/repo/actions/runs/123): the rerun budget of this PR is exhausted (2/2 reruns of its head commit)."},
+		},
+		{
+			name:        "daily budget of previous days",
+			dailyBudget: 1,
+			reruns: []flakes.Record{
+				{Kind: flakes.KindRerun, Repository: "owner/repo", SHA: "def456", Installation: 1, RunID: 7, Time: time.Now().Add(-48 * time.Hour)},
+			},
+			expectedRerun: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					RerunConfig: &config.RerunConfig{MaxRetries: 3, PRBudget: tc.prBudget},
+				}, nil
+			}
+
+			// runs dispatched for pull requests from forks run on the base branch, whose head is abc123
+			dispatchedRuns := &DispatchedRunTracker{}
+			if tc.dispatchedSHA != "" {
+				assert.NoError(t, dispatchedRuns.add(123, dispatchedRun{owner: "owner", repo: "repo", prNumber: 1, workflow: "test.yaml", sha: tc.dispatchedSHA}))
+			}
+
+			flakeStore, err := flakes.Open("")
+			if err != nil {
+				t.Fatalf("Failed to open flakes store: %v", err)
+			}
+			for _, record := range tc.reruns {
+				assert.NoError(t, flakeStore.Add(record))
+			}
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			rerunCalled := false
+			var comments []string
+			mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+					Number: github.Ptr(1),
+					User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+				}})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(1)})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Jobs{
+					TotalCount: github.Ptr(1),
+					Jobs:       []*github.WorkflowJob{{ID: github.Ptr[int64](1), Name: github.Ptr("unit"), Conclusion: github.Ptr("failure")}},
+				})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+				rerunCalled = true
+				w.WriteHeader(http.StatusCreated)
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				comments = append(comments, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(comment)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator:  mockClientCreator,
+					FlakeStore:     flakeStore,
+					DispatchedRuns: dispatchedRuns,
+				},
+				DailyRerunBudget: tc.dailyBudget,
+			}
+
+			payload := []byte(`{
+				"action": "completed",
+				"workflow": {
+					"name": "test-workflow",
+					"path": ".github/workflows/test.yaml"
+				},
+				"workflow_run": {
+					"id": 123,
+					"run_attempt": 1,
+					"head_sha": "abc123",
+					"conclusion": "failure",
+					"html_url": "https://github.com/owner/repo/actions/runs/123",
+					"pull_requests": [
+						{
+							"number": 1
+						}
+					]
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			reruns := flakeStore.Reruns().InstallationReruns(1, time.Time{})
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRerun, rerunCalled)
+			assert.Equal(t, tc.expectedComments, comments)
+			if tc.expectedRerun {
+				reruns++
+			}
+			assert.Equal(t, reruns, flakeStore.Reruns().InstallationReruns(1, time.Time{}))
+		})
+	}
+}
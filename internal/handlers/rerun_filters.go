@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+// jobFilter selects the failed jobs which may be rerun, by job and step names
+type jobFilter struct {
+	jobs         []*regexp.Regexp
+	excludeJobs  []*regexp.Regexp
+	steps        []*regexp.Regexp
+	excludeSteps []*regexp.Regexp
+}
+
+// matchNothing is a regex which does not match any string
+var matchNothing = regexp.MustCompile(`[^\x00-\x{10FFFF}]`)
+
+// compilePatterns compiles regexes. Invalid ones match nothing, so that an invalid included pattern
+// does not let every job or step through.
+func compilePatterns(patterns []string, logger zerolog.Logger) []*regexp.Regexp {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("Invalid rerun pattern %q matches nothing", pattern)
+			re = matchNothing
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled
+}
+
+// newJobFilter returns the job filter of the rerun configuration, or nil if it does not filter jobs
+func newJobFilter(rerunConfig *config.RerunConfig, logger zerolog.Logger) *jobFilter {
+	if rerunConfig == nil || len(rerunConfig.Jobs)+len(rerunConfig.ExcludeJobs)+len(rerunConfig.Steps)+len(rerunConfig.ExcludeSteps) == 0 {
+		return nil
+	}
+	return &jobFilter{
+		jobs:         compilePatterns(rerunConfig.Jobs, logger),
+		excludeJobs:  compilePatterns(rerunConfig.ExcludeJobs, logger),
+		steps:        compilePatterns(rerunConfig.Steps, logger),
+		excludeSteps: compilePatterns(rerunConfig.ExcludeSteps, logger),
+	}
+}
+
+func matchAny(patterns []*regexp.Regexp, s string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// eligible returns whether the failure of job may be rerun: its name must match the included jobs (if
+// any) and not the excluded ones, and so must each of its failed steps. Otherwise, the reason is returned.
+func (f *jobFilter) eligible(job *github.WorkflowJob) (bool, string) {
+	name := job.GetName()
+	if len(f.jobs) > 0 && !matchAny(f.jobs, name) {
+		return false, fmt.Sprintf("job %s does not match the rerun jobs", name)
+	}
+	if matchAny(f.excludeJobs, name) {
+		return false, fmt.Sprintf("job %s matches the excluded jobs", name)
+	}
+
+	steps := failedSteps(job)
+	if len(f.steps) > 0 && len(steps) == 0 {
+		return false, fmt.Sprintf("job %s has no failed step matching the rerun steps", name)
+	}
+	for _, step := range steps {
+		if len(f.steps) > 0 && !matchAny(f.steps, step) {
+			return false, fmt.Sprintf("step %s of job %s does not match the rerun steps", step, name)
+		}
+		if matchAny(f.excludeSteps, step) {
+			return false, fmt.Sprintf("step %s of job %s matches the excluded steps", step, name)
+		}
+	}
+	return true, ""
+}
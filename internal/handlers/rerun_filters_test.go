@@ -0,0 +1,178 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func newJob(name string, steps map[string]string) *github.WorkflowJob {
+	job := &github.WorkflowJob{Name: github.Ptr(name), Conclusion: github.Ptr("failure")}
+	for step, conclusion := range steps {
+		job.Steps = append(job.Steps, &github.TaskStep{Name: github.Ptr(step), Conclusion: github.Ptr(conclusion)})
+	}
+	return job
+}
+
+func Test_jobFilter_eligible(t *testing.T) {
+	rerunConfig := &config.RerunConfig{
+		Jobs:         []string{"^e2e"},
+		ExcludeJobs:  []string{"lint"},
+		Steps:        []string{"^Setup cluster$", "^Upload artifacts$"},
+		ExcludeSteps: []string{"^Run tests$"},
+	}
+	filter := newJobFilter(rerunConfig, zerolog.Nop())
+
+	testCases := []struct {
+		name     string
+		job      *github.WorkflowJob
+		expected bool
+	}{
+		{name: "selected step", job: newJob("e2e (1)", map[string]string{"Setup cluster": "failure", "Run tests": "skipped"}), expected: true},
+		{name: "other selected step", job: newJob("e2e (2)", map[string]string{"Upload artifacts": "failure"}), expected: true},
+		{name: "genuine test failure", job: newJob("e2e (1)", map[string]string{"Setup cluster": "success", "Run tests": "failure"})},
+		{name: "job not selected", job: newJob("unit", map[string]string{"Setup cluster": "failure"})},
+		{name: "excluded job", job: newJob("e2e-lint", map[string]string{"Setup cluster": "failure"})},
+		{name: "no failed step", job: newJob("e2e (1)", nil)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, reason := filter.eligible(tc.job)
+			assert.Equal(t, tc.expected, ok, reason)
+			if !ok {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+
+	// invalid patterns match nothing, so that invalid included patterns do not select every job
+	filter = newJobFilter(&config.RerunConfig{Jobs: []string{"e2e("}, ExcludeSteps: []string{"Run tests["}}, zerolog.Nop())
+	ok, _ := filter.eligible(newJob("e2e(", map[string]string{"Setup cluster": "failure"}))
+	assert.False(t, ok)
+	filter = newJobFilter(&config.RerunConfig{ExcludeSteps: []string{"Run tests["}}, zerolog.Nop())
+	ok, _ = filter.eligible(newJob("e2e", map[string]string{"Run tests[": "failure"}))
+	assert.True(t, ok)
+
+	assert.Nil(t, newJobFilter(&config.RerunConfig{MaxRetries: 3}, zerolog.Nop()))
+	assert.Nil(t, newJobFilter(nil, zerolog.Nop()))
+}
+
+func TestWorkflowRunHandler_Failure_RerunFilters(t *testing.T) {
+	testCases := []struct {
+		name          string
+		jobs          []*github.WorkflowJob
+		expectedRerun bool
+	}{
+		{
+			name: "infrastructure failures",
+			jobs: []*github.WorkflowJob{
+				newJob("e2e (1)", map[string]string{"Setup cluster": "failure"}),
+				newJob("e2e (2)", map[string]string{"Run tests": "success", "Upload artifacts": "failure"}),
+			},
+			expectedRerun: true,
+		},
+		{
+			name: "genuine test failure among infrastructure failures",
+			jobs: []*github.WorkflowJob{
+				newJob("e2e (1)", map[string]string{"Setup cluster": "failure"}),
+				newJob("e2e (2)", map[string]string{"Run tests": "failure"}),
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					RerunConfig: &config.RerunConfig{
+						MaxRetries: 3,
+						Steps:      []string{"^Setup cluster$", "^Upload artifacts$"},
+					},
+				}, nil
+			}
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			rerunCalled := false
+			mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+					Number: github.Ptr(1),
+					User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+				}})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(1)})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Jobs{TotalCount: github.Ptr(len(tc.jobs)), Jobs: tc.jobs})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+				rerunCalled = true
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator: mockClientCreator,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "completed",
+				"workflow": {
+					"name": "test-workflow",
+					"path": ".github/workflows/test.yaml"
+				},
+				"workflow_run": {
+					"id": 123,
+					"conclusion": "failure",
+					"pull_requests": [
+						{
+							"number": 1
+						}
+					]
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedRerun, rerunCalled)
+		})
+	}
+}
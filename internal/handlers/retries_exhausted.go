@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+// listRunAttempts returns the failed jobs of each attempt of a workflow run, up to the given attempt
+func listRunAttempts(ctx context.Context, client *github.Client, owner, repo string, runID int64, attempts int) ([]config.RunAttempt, error) {
+	var runAttempts []config.RunAttempt
+	for attempt := 1; attempt <= attempts; attempt++ {
+		runAttempt := config.RunAttempt{Attempt: attempt}
+		opts := &github.ListOptions{PerPage: 100}
+		for {
+			jobs, response, err := client.Actions.ListWorkflowJobsAttempt(ctx, owner, repo, runID, int64(attempt), opts)
+			if err != nil {
+				return nil, err
+			}
+			for _, job := range jobs.Jobs {
+				if isFailedJob(job) {
+					runAttempt.FailedJobs = append(runAttempt.FailedJobs, job.GetName())
+				}
+			}
+			if response.NextPage == 0 {
+				break
+			}
+			opts.Page = response.NextPage
+		}
+		runAttempts = append(runAttempts, runAttempt)
+	}
+	return runAttempts, nil
+}
+
+// buildExhaustedSummary renders the attempts of a workflow run which exhausted its retries after the
+// given number of attempts, listing their failed jobs if known
+func buildExhaustedSummary(workflowName string, workflowRun *github.WorkflowRun, label string, runAttempt int, attempts []config.RunAttempt) string {
+	var builder strings.Builder
+	name := fmt.Sprintf("`%s`", workflowName)
+	if workflowRun.GetHTMLURL() != "" {
+		name = fmt.Sprintf("[`%s`](%s)", workflowName, workflowRun.GetHTMLURL())
+	}
+	fmt.Fprintf(&builder, "🛑 %s exhausted its retries after %d attempts, labeling this PR `%s` until it succeeds.\n", name, runAttempt, label)
+	if len(attempts) == 0 {
+		return builder.String()
+	}
+	builder.WriteString("\n| Attempt | Failed jobs |\n|---------|-------------|\n")
+	for _, attempt := range attempts {
+		jobs := make([]string, 0, len(attempt.FailedJobs))
+		for _, job := range attempt.FailedJobs {
+			jobs = append(jobs, fmt.Sprintf("`%s`", strings.ReplaceAll(escapeTableCell(job), "`", "'")))
+		}
+		fmt.Fprintf(&builder, "| #%d | %s |\n", attempt.Attempt, strings.Join(jobs, ", "))
+	}
+	return builder.String()
+}
+
+// reportRetriesExhausted posts a summary of the attempts and failed jobs of a workflow run which exhausted
+// its retries, labels its pull request and records the workflow as exhausted in the flakiness history, so
+// that the label is only removed once it succeeds. It is a no-op unless an exhausted label is configured
+// and a flakes store is set, or if the workflow is already recorded as exhausted on the labeled pull
+// request so that the summary is only posted once.
+func (w *WorkflowRunHandler) reportRetriesExhausted(
+	ctx context.Context,
+	client *github.Client,
+	installationID int64,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	runAttempt int,
+	logger zerolog.Logger,
+) error {
+	if w.FlakeStore == nil || arianeConfig.RerunConfig == nil || arianeConfig.RerunConfig.ExhaustedLabel == "" {
+		return nil
+	}
+	label := arianeConfig.RerunConfig.ExhaustedLabel
+	prNumber := pullRequest.GetNumber()
+	labeled, _ := prHasLabel(ctx, client, pullRequest, label, logger)
+	if labeled && slices.Contains(w.FlakeStore.ExhaustedRetries().Workflows(repositoryOwner+"/"+repositoryName, prNumber), workflowName) {
+		logger.Debug().Msgf("Workflow '%s' already exhausted its retries on PR #%d, skipping retries summary", workflowName, prNumber)
+		return nil
+	}
+
+	// the summary is still posted without the failed jobs of each attempt if they can't be listed
+	attempts, err := listRunAttempts(ctx, client, repositoryOwner, repositoryName, workflowRun.GetID(), runAttempt)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to list attempts of workflow run %d", workflowRun.GetID())
+	}
+	data := config.FeedbackData{
+		Workflow:  workflowName,
+		Exhausted: buildExhaustedSummary(workflowName, workflowRun, label, runAttempt, attempts),
+		Attempts:  attempts,
+	}
+	comment := feedbackMessage(arianeConfig, config.TemplateRetriesExhausted, data, logger)
+	reportErr := NewGithubCommenter(client, repositoryOwner, repositoryName, w.BotLogin, logger).report(ctx, arianeConfig, prNumber, config.TemplateRetriesExhausted, workflowName, comment)
+
+	if !labeled {
+		if _, _, err := client.Issues.AddLabelsToIssue(ctx, repositoryOwner, repositoryName, prNumber, []string{label}); err != nil {
+			logger.Error().Err(err).Msgf("Failed to add label %s to PR #%d", label, prNumber)
+			return err
+		}
+		logger.Info().Msgf("Labeled PR #%d %s, as workflow '%s' (run ID: %d) exhausted its retries", prNumber, label, workflowName, workflowRun.GetID())
+	}
+	w.recordFlakes(flakes.KindExhausted, installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, runAttempt, logger, "")
+	return reportErr
+}
+
+// clearRetriesExhausted records that a workflow which exhausted its retries on a pull request succeeded,
+// and removes the exhausted label from the pull request unless other workflows are still exhausted
+func (w *WorkflowRunHandler) clearRetriesExhausted(
+	ctx context.Context,
+	client *github.Client,
+	installationID int64,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	logger zerolog.Logger,
+) error {
+	if w.FlakeStore == nil || arianeConfig.RerunConfig == nil || arianeConfig.RerunConfig.ExhaustedLabel == "" {
+		return nil
+	}
+	label := arianeConfig.RerunConfig.ExhaustedLabel
+	prNumber := pullRequest.GetNumber()
+	repository := repositoryOwner + "/" + repositoryName
+	if !slices.Contains(w.FlakeStore.ExhaustedRetries().Workflows(repository, prNumber), workflowName) {
+		return nil
+	}
+	w.recordFlakes(flakes.KindRecovered, installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, workflowRun.GetRunAttempt(), logger, "")
+
+	if exhausted := w.FlakeStore.ExhaustedRetries().Workflows(repository, prNumber); len(exhausted) > 0 {
+		logger.Debug().Msgf("Workflows %v still exhausted their retries, keeping label %s on PR #%d", exhausted, label, prNumber)
+		return nil
+	}
+	if labeled, _ := prHasLabel(ctx, client, pullRequest, label, logger); !labeled {
+		return nil
+	}
+	if _, err := client.Issues.RemoveLabelForIssue(ctx, repositoryOwner, repositoryName, prNumber, url.PathEscape(label)); err != nil {
+		logger.Error().Err(err).Msgf("Failed to remove label %s from PR #%d", label, prNumber)
+		return err
+	}
+	logger.Info().Msgf("Removed label %s from PR #%d, as workflow '%s' (run ID: %d) succeeded", label, prNumber, workflowName, workflowRun.GetID())
+	return nil
+}
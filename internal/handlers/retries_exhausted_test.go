@@ -0,0 +1,224 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+)
+
+func TestWorkflowRunHandler_RetriesExhausted(t *testing.T) {
+	testCases := []struct {
+		name       string
+		workflow   string
+		conclusion string
+		prLabels   []*github.Label
+		// exhausted are the workflows already recorded as exhausted on the pull request
+		exhausted         []string
+		failAttempts      bool
+		expectedLabels    []string
+		expectedRemoved   bool
+		expectedComments  []string
+		expectedExhausted []string
+	}{
+		{
+			name:           "failed run exhausted its retries",
+			workflow:       "test-workflow",
+			conclusion:     "failure",
+			expectedLabels: []string{"ci/retries-exhausted"},
+			expectedComments: []string{"🛑 [`test-workflow`](https://github.com/owner/repo/actions/runs/123) exhausted its retries after 3 attempts, labeling this PR `ci/retries-exhausted` until it succeeds.\n\n" +
+				"| Attempt | Failed jobs |\n|---------|-------------|\n" +
+				"| #1 | `unit`, `e2e` |\n| #2 | `e2e` |\n| #3 | `e2e` |\n"},
+			expectedExhausted: []string{"test-workflow"},
+		},
+		{
+			name:              "failed run exhausted its retries without listing its attempts",
+			workflow:          "test-workflow",
+			conclusion:        "failure",
+			failAttempts:      true,
+			expectedLabels:    []string{"ci/retries-exhausted"},
+			expectedComments:  []string{"🛑 [`test-workflow`](https://github.com/owner/repo/actions/runs/123) exhausted its retries after 3 attempts, labeling this PR `ci/retries-exhausted` until it succeeds.\n"},
+			expectedExhausted: []string{"test-workflow"},
+		},
+		{
+			name:              "failed run exhausted its retries again",
+			workflow:          "test-workflow",
+			conclusion:        "failure",
+			prLabels:          []*github.Label{{Name: github.Ptr("ci/retries-exhausted")}},
+			exhausted:         []string{"test-workflow"},
+			expectedExhausted: []string{"test-workflow"},
+		},
+		{
+			name:       "failed run exhausted its retries after another workflow",
+			workflow:   "test-workflow",
+			conclusion: "failure",
+			prLabels:   []*github.Label{{Name: github.Ptr("ci/retries-exhausted")}},
+			exhausted:  []string{"other-workflow"},
+			expectedComments: []string{"🛑 [`test-workflow`](https://github.com/owner/repo/actions/runs/123) exhausted its retries after 3 attempts, labeling this PR `ci/retries-exhausted` until it succeeds.\n\n" +
+				"| Attempt | Failed jobs |\n|---------|-------------|\n" +
+				"| #1 | `unit`, `e2e` |\n| #2 | `e2e` |\n| #3 | `e2e` |\n"},
+			expectedExhausted: []string{"other-workflow", "test-workflow"},
+		},
+		{
+			name:            "later run succeeded",
+			workflow:        "test-workflow",
+			conclusion:      "success",
+			prLabels:        []*github.Label{{Name: github.Ptr("ci/retries-exhausted")}},
+			exhausted:       []string{"test-workflow"},
+			expectedRemoved: true,
+		},
+		{
+			name:              "later run succeeded while another workflow is still exhausted",
+			workflow:          "test-workflow",
+			conclusion:        "success",
+			prLabels:          []*github.Label{{Name: github.Ptr("ci/retries-exhausted")}},
+			exhausted:         []string{"test-workflow", "other-workflow"},
+			expectedExhausted: []string{"other-workflow"},
+		},
+		{
+			name:              "run of a workflow which did not exhaust its retries succeeded",
+			workflow:          "test-workflow",
+			conclusion:        "success",
+			prLabels:          []*github.Label{{Name: github.Ptr("ci/retries-exhausted")}},
+			exhausted:         []string{"other-workflow"},
+			expectedExhausted: []string{"other-workflow"},
+		},
+		{
+			name:       "later run succeeded without label",
+			workflow:   "test-workflow",
+			conclusion: "success",
+			exhausted:  []string{"test-workflow"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+			defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+			configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+				return &config.ArianeConfig{
+					RerunConfig: &config.RerunConfig{MaxRetries: 2, ExhaustedLabel: "ci/retries-exhausted"},
+				}, nil
+			}
+
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			store, err := flakes.Open("")
+			if err != nil {
+				t.Fatalf("Failed to open flakes store: %v", err)
+			}
+			for _, workflow := range tc.exhausted {
+				assert.NoError(t, store.Add(flakes.Record{Kind: flakes.KindExhausted, Repository: "owner/repo", Workflow: workflow, PR: 1}))
+			}
+
+			var labels, comments []string
+			removed := false
+			mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+					Number: github.Ptr(1),
+					User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+					Labels: tc.prLabels,
+				}})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(3)})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/123/attempts/{attempt}/jobs", func(w http.ResponseWriter, r *http.Request) {
+				if tc.failAttempts {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				jobs := []*github.WorkflowJob{
+					{Name: github.Ptr("unit"), Conclusion: github.Ptr("success")},
+					{Name: github.Ptr("e2e"), Conclusion: github.Ptr("timed_out")},
+				}
+				if r.PathValue("attempt") == "1" {
+					jobs[0].Conclusion = github.Ptr("failure")
+				}
+				_ = json.NewEncoder(w).Encode(&github.Jobs{TotalCount: github.Ptr(len(jobs)), Jobs: jobs})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/labels", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewDecoder(r.Body).Decode(&labels)
+				_ = json.NewEncoder(w).Encode([]*github.Label{})
+			})
+			mux.HandleFunc("DELETE /repos/owner/repo/issues/1/labels/{label}", func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "ci/retries-exhausted", r.PathValue("label"))
+				removed = true
+				w.WriteHeader(http.StatusOK)
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				comments = append(comments, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(comment)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			mockClientCreator := NewMockClientCreator(mockCtrl)
+			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+			handler := &WorkflowRunHandler{
+				Config: Config{
+					ClientCreator: mockClientCreator,
+					FlakeStore:    store,
+				},
+			}
+
+			payload := []byte(`{
+				"action": "completed",
+				"workflow": {
+					"name": "` + tc.workflow + `",
+					"path": ".github/workflows/test.yaml"
+				},
+				"workflow_run": {
+					"id": 123,
+					"workflow_id": 1,
+					"run_attempt": 3,
+					"head_sha": "abc123",
+					"conclusion": "` + tc.conclusion + `",
+					"html_url": "https://github.com/owner/repo/actions/runs/123",
+					"pull_requests": [
+						{
+							"number": 1
+						}
+					]
+				},
+				"repository": {
+					"owner": {
+						"login": "owner"
+					},
+					"name": "repo"
+				},
+				"installation": {
+					"id": 1
+				}
+			}`)
+
+			err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedLabels, labels)
+			assert.Equal(t, tc.expectedRemoved, removed)
+			assert.Equal(t, tc.expectedComments, comments)
+			assert.Equal(t, tc.expectedExhausted, store.ExhaustedRetries().Workflows("owner/repo", 1))
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v88/github"
+	"gopkg.in/yaml.v3"
+)
+
+// skippedCheckExternalID identifies the skipped check runs created by Ariane for a workflow
+func skippedCheckExternalID(workflow string) string {
+	return "ariane-skipped:" + workflow
+}
+
+// latestCheckRuns returns the latest check run of each name on sha
+func latestCheckRuns(ctx context.Context, client *github.Client, owner, repo, sha string) ([]*github.CheckRun, error) {
+	var checkRuns []*github.CheckRun
+	opts := &github.ListCheckRunsOptions{Filter: github.Ptr("latest"), ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		results, response, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+		if err != nil {
+			return nil, err
+		}
+		checkRuns = append(checkRuns, results.CheckRuns...)
+		if response.NextPage == 0 {
+			return checkRuns, nil
+		}
+		opts.Page = response.NextPage
+	}
+}
+
+// skippedChecks returns the check runs Ariane marked as skipped for a workflow on sha, unless they were
+// superseded since
+func skippedChecks(ctx context.Context, client *github.Client, owner, repo, workflow, sha string) ([]*github.CheckRun, error) {
+	checkRuns, err := latestCheckRuns(ctx, client, owner, repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	var skipped []*github.CheckRun
+	for _, checkRun := range checkRuns {
+		if checkRun.GetExternalID() == skippedCheckExternalID(workflow) && checkRun.GetConclusion() == "skipped" {
+			skipped = append(skipped, checkRun)
+		}
+	}
+	return skipped, nil
+}
+
+// skippedCheckNames returns the names of the check runs to mark as skipped when a workflow is skipped:
+// the check names declared in its configuration, the names of its jobs, or the name of the workflow.
+// Jobs are read from the workflow file of the base branch, so that a pull request cannot choose which
+// checks are marked as skipped by editing it.
+func (w *WorkflowProcessor) skippedCheckNames(ctx context.Context, workflow string) ([]string, error) {
+	workflowConfig := w.arianeConfig.Workflows[workflow]
+	if len(workflowConfig.SkippedChecks) > 0 {
+		return workflowConfig.SkippedChecks, nil
+	}
+
+	if workflowConfig.SkippedChecksFromJobs {
+		content, _, _, err := w.client.Repositories.GetContents(ctx, w.owner, w.repo, ".github/workflows/"+workflow, &github.RepositoryContentGetOptions{Ref: w.baseRef})
+		if err != nil {
+			return nil, err
+		}
+		fileContent, err := content.GetContent()
+		if err != nil {
+			return nil, err
+		}
+		names, err := jobCheckNames([]byte(fileContent))
+		if err == nil {
+			return names, nil
+		}
+		w.logger.Warn().Err(err).Msgf("Failed to derive check names from the jobs of workflow %s, marking the workflow as skipped instead", workflow)
+	}
+
+	githubWorkflow, _, err := w.client.Actions.GetWorkflowByFileName(ctx, w.owner, w.repo, workflow)
+	if err != nil {
+		w.logger.Error().Err(err).Msg("Failed to retrieve workflow")
+		return nil, err
+	}
+	return []string{githubWorkflow.GetName()}, nil
+}
+
+type workflowJobs struct {
+	Jobs map[string]struct {
+		Name     string `yaml:"name"`
+		Uses     string `yaml:"uses"`
+		Strategy struct {
+			Matrix yaml.Node `yaml:"matrix"`
+		} `yaml:"strategy"`
+	} `yaml:"jobs"`
+}
+
+// matrixValue is the value of a matrix variable in a matrix combination
+type matrixValue struct {
+	key, value string
+}
+
+var (
+	jobNameExpression = regexp.MustCompile(`\$\{\{(.*?)\}\}`)
+	matrixExpression  = regexp.MustCompile(`^\s*matrix\.([\w-]+)\s*$`)
+)
+
+// jobCheckNames returns the names of the check runs of the jobs of a workflow file, expanding their
+// matrices like GitHub does: matrix variables used in a job name are replaced by their values, the values
+// of the combination are appended to the job name otherwise. An error is returned for the names which
+// cannot be derived from the file: jobs calling reusable workflows, whose checks are named after the
+// called jobs, job names with other expressions, and matrices with values which are not scalars.
+func jobCheckNames(content []byte) ([]string, error) {
+	var workflow workflowJobs
+	if err := yaml.Unmarshal(content, &workflow); err != nil {
+		return nil, err
+	}
+	if len(workflow.Jobs) == 0 {
+		return nil, fmt.Errorf("workflow has no jobs")
+	}
+
+	var names []string
+	for id, job := range workflow.Jobs {
+		if job.Uses != "" {
+			return nil, fmt.Errorf("job %s calls reusable workflow %s, whose jobs are unknown", id, job.Uses)
+		}
+		name := job.Name
+		if name == "" {
+			name = id
+		}
+		combinations, err := matrixCombinations(&job.Strategy.Matrix)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", id, err)
+		}
+		for _, combination := range combinations {
+			combinationName, err := matrixJobName(name, combination)
+			if err != nil {
+				return nil, fmt.Errorf("job %s: %w", id, err)
+			}
+			names = append(names, combinationName)
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names), nil
+}
+
+// matrixJobName returns the name of the job of a matrix combination. Only expressions made of a matrix
+// variable can be evaluated in the job name.
+func matrixJobName(name string, combination []matrixValue) (string, error) {
+	if jobNameExpression.MatchString(name) {
+		var err error
+		name = jobNameExpression.ReplaceAllStringFunc(name, func(match string) string {
+			submatch := matrixExpression.FindStringSubmatch(jobNameExpression.FindStringSubmatch(match)[1])
+			if submatch == nil {
+				err = fmt.Errorf("expression %s in job name cannot be evaluated", match)
+				return match
+			}
+			if i := slices.IndexFunc(combination, func(v matrixValue) bool { return v.key == submatch[1] }); i >= 0 {
+				return combination[i].value
+			}
+			return ""
+		})
+		return name, err
+	}
+	if len(combination) == 0 {
+		return name, nil
+	}
+	values := make([]string, 0, len(combination))
+	for _, v := range combination {
+		values = append(values, v.value)
+	}
+	return fmt.Sprintf("%s (%s)", name, strings.Join(values, ", ")), nil
+}
+
+// matrixCombinations returns the combinations of a job matrix, after applying its exclude and include
+// entries, or a single empty combination for jobs without matrix
+func matrixCombinations(matrix *yaml.Node) ([][]matrixValue, error) {
+	if matrix.Kind == 0 {
+		return [][]matrixValue{nil}, nil
+	}
+	if matrix.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("matrix %q cannot be expanded", matrix.Value)
+	}
+
+	var dimensions []string
+	var include, exclude [][]matrixValue
+	combinations := [][]matrixValue{nil}
+	for i := 0; i+1 < len(matrix.Content); i += 2 {
+		key, values := matrix.Content[i].Value, matrix.Content[i+1]
+		if values.Kind != yaml.SequenceNode {
+			return nil, fmt.Errorf("matrix variable %s %q cannot be expanded", key, values.Value)
+		}
+		switch key {
+		case "include", "exclude":
+			for _, entry := range values.Content {
+				if entry.Kind != yaml.MappingNode {
+					return nil, fmt.Errorf("matrix %s entry %q cannot be expanded", key, entry.Value)
+				}
+				var values []matrixValue
+				for j := 0; j+1 < len(entry.Content); j += 2 {
+					if entry.Content[j+1].Kind != yaml.ScalarNode {
+						return nil, fmt.Errorf("matrix %s variable %s is not a scalar", key, entry.Content[j].Value)
+					}
+					values = append(values, matrixValue{key: entry.Content[j].Value, value: entry.Content[j+1].Value})
+				}
+				if key == "include" {
+					include = append(include, values)
+				} else {
+					exclude = append(exclude, values)
+				}
+			}
+		default:
+			dimensions = append(dimensions, key)
+			var expanded [][]matrixValue
+			for _, combination := range combinations {
+				for _, value := range values.Content {
+					if value.Kind != yaml.ScalarNode {
+						return nil, fmt.Errorf("matrix variable %s has values which are not scalars", key)
+					}
+					expanded = append(expanded, append(slices.Clone(combination), matrixValue{key: key, value: value.Value}))
+				}
+			}
+			combinations = expanded
+		}
+	}
+	if len(dimensions) == 0 {
+		combinations = nil
+	}
+
+	// An exclude entry removes the combinations matching all its values
+	combinations = slices.DeleteFunc(combinations, func(combination []matrixValue) bool {
+		return slices.ContainsFunc(exclude, func(entry []matrixValue) bool {
+			return matchesMatrixValues(combination, entry)
+		})
+	})
+
+	// An include entry extends the combinations whose original values it does not overwrite, or is added
+	// as a new combination if there are none
+	original := len(combinations)
+	for _, entry := range include {
+		extended := false
+		for i := range combinations[:original] {
+			var dimensionValues []matrixValue
+			for _, v := range entry {
+				if slices.Contains(dimensions, v.key) {
+					dimensionValues = append(dimensionValues, v)
+				}
+			}
+			if !matchesMatrixValues(combinations[i], dimensionValues) {
+				continue
+			}
+			for _, v := range entry {
+				if slices.Contains(dimensions, v.key) {
+					continue
+				}
+				if j := slices.IndexFunc(combinations[i], func(c matrixValue) bool { return c.key == v.key }); j >= 0 {
+					combinations[i][j] = v
+				} else {
+					combinations[i] = append(combinations[i], v)
+				}
+			}
+			extended = true
+		}
+		if !extended {
+			combinations = append(combinations, slices.Clone(entry))
+		}
+	}
+	return combinations, nil
+}
+
+// matchesMatrixValues returns whether a matrix combination has all the given values
+func matchesMatrixValues(combination, values []matrixValue) bool {
+	for _, v := range values {
+		if !slices.Contains(combination, v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,355 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func Test_jobCheckNames(t *testing.T) {
+	testCases := []struct {
+		name          string
+		workflow      string
+		expectedNames []string
+		expectedError bool
+	}{
+		{
+			name: "jobs without matrix",
+			workflow: `
+jobs:
+  lint:
+    runs-on: ubuntu-latest
+  build:
+    name: Build
+`,
+			expectedNames: []string{"Build", "lint"},
+		},
+		{
+			name: "matrix appended to the job name",
+			workflow: `
+jobs:
+  test:
+    name: Installation and Connectivity Test
+    strategy:
+      matrix:
+        ipFamily: [ipv4, ipv6]
+        kernel: ["5.15"]
+`,
+			expectedNames: []string{"Installation and Connectivity Test (ipv4, 5.15)", "Installation and Connectivity Test (ipv6, 5.15)"},
+		},
+		{
+			name: "matrix variables in the job name",
+			workflow: `
+jobs:
+  test:
+    name: Test ${{ matrix.ipFamily }} on ${{matrix.kernel}}
+    strategy:
+      matrix:
+        ipFamily: [ipv4, ipv6]
+        kernel: ["5.15", "6.1"]
+        exclude:
+          - ipFamily: ipv6
+            kernel: "5.15"
+`,
+			expectedNames: []string{"Test ipv4 on 5.15", "Test ipv4 on 6.1", "Test ipv6 on 6.1"},
+		},
+		{
+			name: "matrix include entries",
+			workflow: `
+jobs:
+  test:
+    strategy:
+      matrix:
+        ipFamily: [ipv4, ipv6]
+        include:
+          - ipFamily: ipv6
+            encryption: wireguard
+          - ipFamily: dual
+`,
+			expectedNames: []string{"test (dual)", "test (ipv4)", "test (ipv6, wireguard)"},
+		},
+		{
+			name: "matrix made of include entries",
+			workflow: `
+jobs:
+  test:
+    name: Test
+    strategy:
+      matrix:
+        include:
+          - k8s: "1.30"
+          - k8s: "1.31"
+`,
+			expectedNames: []string{"Test (1.30)", "Test (1.31)"},
+		},
+		{
+			name: "matrix expression",
+			workflow: `
+jobs:
+  test:
+    strategy:
+      matrix: ${{ fromJSON(needs.setup.outputs.matrix) }}
+`,
+			expectedError: true,
+		},
+		{
+			name: "matrix variable expression",
+			workflow: `
+jobs:
+  test:
+    strategy:
+      matrix:
+        k8s: ${{ fromJSON(needs.setup.outputs.versions) }}
+`,
+			expectedError: true,
+		},
+		{
+			name: "job calling a reusable workflow",
+			workflow: `
+jobs:
+  build:
+    uses: ./.github/workflows/build.yaml
+`,
+			expectedError: true,
+		},
+		{
+			name: "matrix object property in the job name",
+			workflow: `
+jobs:
+  test:
+    name: Test ${{ matrix.k8s.version }}
+    strategy:
+      matrix:
+        k8s: ["1.30"]
+`,
+			expectedError: true,
+		},
+		{
+			name: "other expression in the job name",
+			workflow: `
+jobs:
+  test:
+    name: Test ${{ inputs.version }}
+`,
+			expectedError: true,
+		},
+		{
+			name: "matrix object values",
+			workflow: `
+jobs:
+  test:
+    strategy:
+      matrix:
+        k8s:
+          - version: "1.30"
+            kind: v0.24
+`,
+			expectedError: true,
+		},
+		{
+			name:          "no jobs",
+			workflow:      "name: CI\n",
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			names, err := jobCheckNames([]byte(tc.workflow))
+			if tc.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
+
+func TestWorkflowProcessor_markWorkflowAsSkipped(t *testing.T) {
+	testCases := []struct {
+		name           string
+		workflowConfig config.WorkflowPathsRegexConfig
+		workflowFile   string
+		baseRef        string
+		checksConfig   *config.ChecksConfig
+		checkRuns      []*github.CheckRun
+		expectedNames  []string
+	}{
+		{
+			name:          "workflow name",
+			expectedNames: []string{"CI"},
+		},
+		{
+			name:           "declared check names",
+			workflowConfig: config.WorkflowPathsRegexConfig{SkippedChecks: []string{"Installation and Connectivity Test (ipv6)"}},
+			expectedNames:  []string{"Installation and Connectivity Test (ipv6)"},
+		},
+		{
+			name:           "check names derived from jobs",
+			workflowConfig: config.WorkflowPathsRegexConfig{SkippedChecksFromJobs: true},
+			workflowFile:   "jobs:\n  test:\n    strategy:\n      matrix:\n        ipFamily: [ipv4, ipv6]\n",
+			expectedNames:  []string{"test (ipv4)", "test (ipv6)"},
+		},
+		{
+			name:           "check names not derived from jobs",
+			workflowConfig: config.WorkflowPathsRegexConfig{SkippedChecksFromJobs: true},
+			workflowFile:   "jobs:\n  test:\n    strategy:\n      matrix: ${{ fromJSON(inputs.matrix) }}\n",
+			expectedNames:  []string{"CI"},
+		},
+		{
+			name:           "required checks only",
+			workflowConfig: config.WorkflowPathsRegexConfig{SkippedChecks: []string{"Test (ipv4)", "Test (ipv6)", "Lint"}},
+			baseRef:        "main",
+			checksConfig:   &config.ChecksConfig{Skipped: config.SkippedChecksRequired},
+			expectedNames:  []string{"Test (ipv4)", "Lint"},
+		},
+		{
+			name:           "all checks by default",
+			workflowConfig: config.WorkflowPathsRegexConfig{SkippedChecks: []string{"Test (ipv4)", "Test (ipv6)", "Lint"}},
+			baseRef:        "main",
+			expectedNames:  []string{"Test (ipv4)", "Test (ipv6)", "Lint"},
+		},
+		{
+			name:           "workflow summarized by the aggregate check run",
+			workflowConfig: config.WorkflowPathsRegexConfig{SkippedChecks: []string{"Test (ipv4)", "Test (ipv6)", "Lint"}},
+			baseRef:        "main",
+			checksConfig: &config.ChecksConfig{
+				Skipped:  config.SkippedChecksRequired,
+				Required: &config.RequiredCheckConfig{Workflows: []string{"ci.yaml"}},
+			},
+			expectedNames: []string{"Test (ipv4)", "Test (ipv6)", "Lint"},
+		},
+		{
+			name:           "checks already marked as skipped",
+			workflowConfig: config.WorkflowPathsRegexConfig{SkippedChecks: []string{"Test (ipv4)", "Test (ipv6)"}},
+			checkRuns: []*github.CheckRun{
+				{Name: github.Ptr("Test (ipv4)"), ExternalID: github.Ptr(skippedCheckExternalID("ci.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("skipped")},
+				{Name: github.Ptr("Test (ipv6)"), ExternalID: github.Ptr(pendingCheckExternalID("ci.yaml")), Status: github.Ptr("completed"), Conclusion: github.Ptr("success")},
+			},
+			expectedNames: []string{"Test (ipv6)"},
+		},
+		{
+			name:          "unprotected branch",
+			baseRef:       "feature",
+			checksConfig:  &config.ChecksConfig{Skipped: config.SkippedChecksRequired},
+			expectedNames: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var created []github.CreateCheckRunOptions
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/owner/repo/actions/workflows/ci.yaml", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Workflow{Name: github.Ptr("CI")})
+			})
+			mux.HandleFunc("GET /repos/owner/repo/contents/.github/workflows/ci.yaml", func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, tc.baseRef, r.FormValue("ref"), "the workflow file is read from the base branch")
+				_ = json.NewEncoder(w).Encode(&github.RepositoryContent{
+					Encoding: github.Ptr("base64"),
+					Content:  github.Ptr(base64.StdEncoding.EncodeToString([]byte(tc.workflowFile))),
+				})
+			})
+			mux.HandleFunc("GET /repos/owner/repo/branches/{branch}/protection", func(w http.ResponseWriter, r *http.Request) {
+				if r.PathValue("branch") != "main" {
+					w.WriteHeader(http.StatusNotFound)
+					_ = json.NewEncoder(w).Encode(&github.ErrorResponse{Message: "Branch not protected"})
+					return
+				}
+				_ = json.NewEncoder(w).Encode(&github.Protection{RequiredStatusChecks: &github.RequiredStatusChecks{
+					Checks: &[]*github.RequiredStatusCheck{{Context: "Test (ipv4)"}, {Context: "Test (ipv6)", AppID: github.Ptr[int64](7)}},
+				}})
+			})
+			mux.HandleFunc("GET /repos/owner/repo/rules/branches/{branch}", func(w http.ResponseWriter, r *http.Request) {
+				if r.PathValue("branch") != "main" {
+					_, _ = w.Write([]byte(`[]`))
+					return
+				}
+				_, _ = w.Write([]byte(`[{"type": "required_status_checks", "parameters": {"required_status_checks": [{"context": "Lint", "integration_id": 42}]}}]`))
+			})
+			mux.HandleFunc("GET /repos/owner/repo/commits/sha/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.ListCheckRunsResults{Total: github.Ptr(len(tc.checkRuns)), CheckRuns: tc.checkRuns})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+				var opts github.CreateCheckRunOptions
+				_ = json.NewDecoder(r.Body).Decode(&opts)
+				created = append(created, opts)
+				_ = json.NewEncoder(w).Encode(&github.CheckRun{ID: github.Ptr[int64](1)})
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			processor := &WorkflowProcessor{
+				client: client,
+				arianeConfig: &config.ArianeConfig{
+					Workflows:    map[string]config.WorkflowPathsRegexConfig{"ci.yaml": tc.workflowConfig},
+					ChecksConfig: tc.checksConfig,
+				},
+				owner:   "owner",
+				repo:    "repo",
+				logger:  zerolog.Nop(),
+				baseRef: tc.baseRef,
+				appID:   42,
+			}
+			assert.NoError(t, processor.markWorkflowAsSkipped(context.Background(), "ci.yaml", "sha"))
+
+			var names []string
+			for _, opts := range created {
+				names = append(names, opts.Name)
+				assert.Equal(t, "sha", opts.HeadSHA)
+				assert.Equal(t, "skipped", opts.GetConclusion())
+				assert.Equal(t, skippedCheckExternalID("ci.yaml"), opts.GetExternalID())
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
+
+func TestWorkflowProcessor_isRequiredCheck(t *testing.T) {
+	var requests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/branches/main/protection", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "server error", http.StatusInternalServerError)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	processor := &WorkflowProcessor{
+		client:  client,
+		owner:   "owner",
+		repo:    "repo",
+		logger:  zerolog.Nop(),
+		baseRef: "main",
+	}
+	// all checks are considered required when the required status checks cannot be retrieved, which is
+	// only attempted once
+	assert.True(t, processor.isRequiredCheck(context.Background(), "Lint"))
+	assert.True(t, processor.isRequiredCheck(context.Background(), "Test"))
+	assert.Equal(t, 1, requests)
+}
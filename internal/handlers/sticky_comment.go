@@ -0,0 +1,217 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/shurcooL/githubv4"
+)
+
+const (
+	// stickyCommentMarker is the hidden marker identifying the sticky comment among the pull request comments
+	stickyCommentMarker = "<!-- ariane:sticky-comment -->"
+	// stickyCommentHistoryLimit is the maximum number of replaced sections kept in the sticky comment history
+	stickyCommentHistoryLimit = 5
+)
+
+// stickySectionRegex matches the sections and history entries of a sticky comment. Keys are path
+// escaped so they do not contain spaces, history entries also record when they were replaced.
+var stickySectionRegex = regexp.MustCompile(`(?s)<!-- ariane:(section|history) (\S+)(?: (\S+))? -->\n(.*?)\n<!-- ariane:end -->`)
+
+type stickySection struct {
+	key string
+	// replacedAt is the time a history entry was replaced by a newer section, empty for current sections
+	replacedAt string
+	body       string
+}
+
+// stickyComment is the content of the sticky comment: one section per trigger phrase, and a short
+// history of the sections which were replaced, most recent first
+type stickyComment struct {
+	sections []stickySection
+	history  []stickySection
+}
+
+func parseStickyComment(body string) *stickyComment {
+	content := &stickyComment{}
+	for _, match := range stickySectionRegex.FindAllStringSubmatch(body, -1) {
+		key, err := url.PathUnescape(match[2])
+		if err != nil {
+			continue
+		}
+		section := stickySection{key: key, replacedAt: match[3], body: match[4]}
+		if match[1] == "history" {
+			content.history = append(content.history, section)
+		} else {
+			content.sections = append(content.sections, section)
+		}
+	}
+	return content
+}
+
+// update sets the body of the section identified by key, moving its previous body to the history.
+// It returns false if the section already had this body.
+func (s *stickyComment) update(key, body string, now time.Time) bool {
+	body = strings.TrimSpace(body)
+	for i, section := range s.sections {
+		if section.key != key {
+			continue
+		}
+		if section.body == body {
+			return false
+		}
+		section.replacedAt = now.UTC().Format(time.RFC3339)
+		s.history = append([]stickySection{section}, s.history...)
+		if len(s.history) > stickyCommentHistoryLimit {
+			s.history = s.history[:stickyCommentHistoryLimit]
+		}
+		s.sections[i].body = body
+		return true
+	}
+	s.sections = append(s.sections, stickySection{key: key, body: body})
+	return true
+}
+
+func (s *stickyComment) render() string {
+	return stickyCommentMarker + "\n" + s.renderSections()
+}
+
+// renderSections renders the sections and history, without the sticky comment marker, so they can
+// also be used by other feedback channels
+func (s *stickyComment) renderSections() string {
+	var builder strings.Builder
+	builder.WriteString("## Ariane\n")
+	for _, section := range s.sections {
+		fmt.Fprintf(&builder, "\n### `%s`\n", section.key)
+		fmt.Fprintf(&builder, "<!-- ariane:section %s -->\n%s\n<!-- ariane:end -->\n", url.PathEscape(section.key), section.body)
+	}
+	if len(s.history) > 0 {
+		builder.WriteString("\n<details><summary>History</summary>\n")
+		for _, entry := range s.history {
+			fmt.Fprintf(&builder, "\n#### `%s` (replaced at %s)\n", entry.key, entry.replacedAt)
+			fmt.Fprintf(&builder, "<!-- ariane:history %s %s -->\n%s\n<!-- ariane:end -->\n", url.PathEscape(entry.key), entry.replacedAt, entry.body)
+		}
+		builder.WriteString("\n</details>\n")
+	}
+	return builder.String()
+}
+
+// updateStickyComment sets the section of the pull request's sticky comment identified by key,
+// creating the sticky comment if needed. Only comments posted by Ariane are considered, so that other
+// comments carrying the sticky comment marker are left alone. If minimizeOutdated is set, Ariane
+// comments posted since the sticky comment's previous update (or all of them when it is created) are
+// minimized as outdated, except the trigger phrases Ariane posts to trigger stages and dependent
+// workflows.
+func (c *GithubCommenter) updateStickyComment(ctx context.Context, prNumber int, key, body string, minimizeOutdated bool) error {
+	defer c.lockFeedback(prNumber)()
+
+	comments, err := c.listPullRequestComments(ctx, prNumber)
+	if err != nil {
+		return err
+	}
+
+	var sticky *github.IssueComment
+	for _, comment := range comments {
+		if c.ownComment(comment) && strings.HasPrefix(comment.GetBody(), stickyCommentMarker) {
+			sticky = comment
+			break
+		}
+	}
+
+	content := parseStickyComment(sticky.GetBody())
+	if !content.update(key, body, time.Now()) {
+		c.logger.Debug().Msgf("Section %s of the sticky comment on PR %d is up to date", key, prNumber)
+		return nil
+	}
+
+	var previousUpdate time.Time
+	comment := &github.IssueComment{Body: github.Ptr(content.render())}
+	if sticky == nil {
+		sticky, _, err = c.client.Issues.CreateComment(ctx, c.owner, c.repo, prNumber, comment)
+		if err != nil {
+			c.logger.Error().Err(err).Msgf("Failed to create sticky comment on PR %d", prNumber)
+			return err
+		}
+	} else {
+		previousUpdate = sticky.GetUpdatedAt().Time
+		if _, _, err := c.client.Issues.EditComment(ctx, c.owner, c.repo, sticky.GetID(), comment); err != nil {
+			c.logger.Error().Err(err).Msgf("Failed to edit sticky comment on PR %d", prNumber)
+			return err
+		}
+	}
+
+	if minimizeOutdated {
+		for _, outdated := range comments {
+			if outdated.GetID() == sticky.GetID() ||
+				!c.ownComment(outdated) ||
+				outdated.GetCreatedAt().Before(previousUpdate) ||
+				isCommandComment(outdated.GetBody()) {
+				continue
+			}
+			if err := c.minimizeComment(ctx, outdated.GetNodeID()); err != nil {
+				c.logger.Error().Err(err).Msgf("Failed to minimize outdated comment %d on PR %d", outdated.GetID(), prNumber)
+			}
+		}
+	}
+	return nil
+}
+
+// isCommandComment returns whether a comment only holds trigger phrases, such as the comments Ariane
+// posts to trigger stages and dependent workflows
+func isCommandComment(body string) bool {
+	lines := 0
+	for _, line := range strings.Split(body, "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines++
+		}
+	}
+	return lines > 0 && len(commentCommands(body)) == lines
+}
+
+func (c *GithubCommenter) listPullRequestComments(ctx context.Context, prNumber int) ([]*github.IssueComment, error) {
+	var comments []*github.IssueComment
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		page, response, err := c.client.Issues.ListComments(ctx, c.owner, c.repo, prNumber, opts)
+		if err != nil {
+			c.logger.Error().Err(err).Msgf("Failed to list comments for PR %d", prNumber)
+			return nil, err
+		}
+		comments = append(comments, page...)
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+	return comments, nil
+}
+
+// minimizeComment hides the comment identified by nodeID as outdated. Minimizing comments is only
+// available through the GraphQL API.
+func (c *GithubCommenter) minimizeComment(ctx context.Context, nodeID string) error {
+	var mutation struct {
+		MinimizeComment struct {
+			ClientMutationID string
+		} `graphql:"minimizeComment(input: $input)"`
+	}
+	input := githubv4.MinimizeCommentInput{
+		SubjectID:  githubv4.ID(nodeID),
+		Classifier: githubv4.ReportedContentClassifiersOutdated,
+	}
+	return graphQLClient(c.client).Mutate(ctx, &mutation, input, nil)
+}
+
+// graphQLClient returns a GraphQL client sharing the authentication of client. The GraphQL endpoint
+// is /graphql on GitHub.com, and /api/graphql on GitHub Enterprise Server (REST API at /api/v3/).
+func graphQLClient(client *github.Client) *githubv4.Client {
+	endpoint := strings.TrimSuffix(client.BaseURL(), "v3/") + "graphql"
+	return githubv4.NewEnterpriseClient(endpoint, client.Client())
+}
@@ -0,0 +1,235 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func Test_stickyComment(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	content := parseStickyComment("")
+	assert.True(t, content.update("/test", "## Workflow Status\n", now))
+	assert.True(t, content.update("/ci e2e", "Command /ci e2e not found", now))
+	assert.False(t, content.update("/test", "## Workflow Status", now))
+
+	body := content.render()
+	assert.True(t, strings.HasPrefix(body, stickyCommentMarker))
+	assert.NotContains(t, body, "History")
+
+	content = parseStickyComment(body)
+	assert.Equal(t, []stickySection{
+		{key: "/test", body: "## Workflow Status"},
+		{key: "/ci e2e", body: "Command /ci e2e not found"},
+	}, content.sections)
+
+	for i := 0; i < stickyCommentHistoryLimit+1; i++ {
+		assert.True(t, content.update("/test", fmt.Sprintf("run %d", i), now.Add(time.Duration(i)*time.Minute)))
+	}
+
+	content = parseStickyComment(content.render())
+	assert.Equal(t, "run 5", content.sections[0].body)
+	assert.Equal(t, "Command /ci e2e not found", content.sections[1].body)
+	if assert.Len(t, content.history, stickyCommentHistoryLimit) {
+		assert.Equal(t, stickySection{key: "/test", replacedAt: "2024-01-02T03:09:05Z", body: "run 4"}, content.history[0])
+		assert.Equal(t, "run 0", content.history[stickyCommentHistoryLimit-1].body)
+	}
+}
+
+func TestGithubCommenter_report(t *testing.T) {
+	previousUpdate := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	sticky := &github.IssueComment{
+		ID:        github.Ptr(int64(2)),
+		Body:      github.Ptr(stickyCommentMarker + "\n<!-- ariane:section %2Ftest -->\nold\n<!-- ariane:end -->\n"),
+		User:      &github.User{Login: github.Ptr("ariane[bot]")},
+		UpdatedAt: &github.Timestamp{Time: previousUpdate},
+	}
+
+	foreign := &github.IssueComment{
+		ID:        github.Ptr(int64(7)),
+		NodeID:    github.Ptr("IC_7"),
+		Body:      github.Ptr(stickyCommentMarker + "\n<!-- ariane:section %2Ftest -->\nforged\n<!-- ariane:end -->\n"),
+		User:      &github.User{Login: github.Ptr("user")},
+		CreatedAt: &github.Timestamp{Time: previousUpdate.Add(time.Hour)},
+	}
+
+	testCases := []struct {
+		name              string
+		config            *config.ArianeConfig
+		comments          []*github.IssueComment
+		expectedCreated   []string
+		expectedEdited    []string
+		expectedMinimized []string
+	}{
+		{
+			name:            "sticky comment disabled",
+			config:          &config.ArianeConfig{},
+			expectedCreated: []string{"new"},
+		},
+		{
+			name:   "sticky comment created",
+			config: &config.ArianeConfig{Feedback: config.FeedbackConfig{StickyComment: github.Ptr(true)}},
+			comments: []*github.IssueComment{
+				{ID: github.Ptr(int64(1)), NodeID: github.Ptr("IC_1"), User: &github.User{Login: github.Ptr("ariane[bot]")}},
+			},
+			expectedCreated: []string{stickyCommentMarker},
+		},
+		{
+			name:   "sticky comment created and outdated comments minimized",
+			config: &config.ArianeConfig{Feedback: config.FeedbackConfig{StickyComment: github.Ptr(true), MinimizeOutdated: github.Ptr(true)}},
+			comments: []*github.IssueComment{
+				{ID: github.Ptr(int64(1)), NodeID: github.Ptr("IC_1"), User: &github.User{Login: github.Ptr("ariane[bot]")}},
+				{ID: github.Ptr(int64(3)), NodeID: github.Ptr("IC_3"), User: &github.User{Login: github.Ptr("user")}},
+			},
+			expectedCreated:   []string{stickyCommentMarker},
+			expectedMinimized: []string{"IC_1"},
+		},
+		{
+			name:   "sticky comment edited and comments posted since its last update minimized",
+			config: &config.ArianeConfig{Feedback: config.FeedbackConfig{StickyComment: github.Ptr(true), MinimizeOutdated: github.Ptr(true)}},
+			comments: []*github.IssueComment{
+				{ID: github.Ptr(int64(1)), NodeID: github.Ptr("IC_1"), User: &github.User{Login: github.Ptr("ariane[bot]")}, CreatedAt: &github.Timestamp{Time: previousUpdate.Add(-time.Hour)}},
+				sticky,
+				{ID: github.Ptr(int64(4)), NodeID: github.Ptr("IC_4"), User: &github.User{Login: github.Ptr("ariane[bot]")}, CreatedAt: &github.Timestamp{Time: previousUpdate.Add(time.Hour)}},
+			},
+			expectedEdited:    []string{"History"},
+			expectedMinimized: []string{"IC_4"},
+		},
+		{
+			name:   "trigger phrases posted by Ariane not minimized",
+			config: &config.ArianeConfig{Feedback: config.FeedbackConfig{StickyComment: github.Ptr(true), MinimizeOutdated: github.Ptr(true)}},
+			comments: []*github.IssueComment{
+				sticky,
+				{ID: github.Ptr(int64(4)), NodeID: github.Ptr("IC_4"), Body: github.Ptr("Command /lint not found"), User: &github.User{Login: github.Ptr("ariane[bot]")}, CreatedAt: &github.Timestamp{Time: previousUpdate.Add(time.Hour)}},
+				{ID: github.Ptr(int64(6)), NodeID: github.Ptr("IC_6"), Body: github.Ptr("/ci-e2e"), User: &github.User{Login: github.Ptr("ariane[bot]")}, CreatedAt: &github.Timestamp{Time: previousUpdate.Add(time.Hour)}},
+			},
+			expectedEdited:    []string{"History"},
+			expectedMinimized: []string{"IC_4"},
+		},
+		{
+			name:   "comment of another user carrying the marker not mistaken for the sticky comment",
+			config: &config.ArianeConfig{Feedback: config.FeedbackConfig{StickyComment: github.Ptr(true), MinimizeOutdated: github.Ptr(true)}},
+			comments: []*github.IssueComment{
+				foreign,
+				{ID: github.Ptr(int64(1)), NodeID: github.Ptr("IC_1"), User: &github.User{Login: github.Ptr("ariane[bot]")}},
+			},
+			expectedCreated:   []string{stickyCommentMarker},
+			expectedMinimized: []string{"IC_1"},
+		},
+		{
+			name:   "sticky comment edited instead of a comment of another user carrying the marker",
+			config: &config.ArianeConfig{Feedback: config.FeedbackConfig{StickyComment: github.Ptr(true), MinimizeOutdated: github.Ptr(true)}},
+			comments: []*github.IssueComment{
+				foreign,
+				sticky,
+			},
+			expectedEdited: []string{"History"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var created, edited, minimized []string
+			mux := http.NewServeMux()
+			mux.HandleFunc("GET /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(tc.comments)
+			})
+			mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				created = append(created, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(github.IssueComment{ID: github.Ptr(int64(5)), User: &github.User{Login: github.Ptr("ariane[bot]")}})
+			})
+			mux.HandleFunc("PATCH /repos/owner/repo/issues/comments/2", func(w http.ResponseWriter, r *http.Request) {
+				var comment github.IssueComment
+				_ = json.NewDecoder(r.Body).Decode(&comment)
+				edited = append(edited, comment.GetBody())
+				_ = json.NewEncoder(w).Encode(comment)
+			})
+			mux.HandleFunc("PATCH /repos/owner/repo/issues/comments/7", func(w http.ResponseWriter, r *http.Request) {
+				t.Error("the comment of another user was edited")
+			})
+			mux.HandleFunc("POST /graphql", func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				var query struct {
+					Query     string `json:"query"`
+					Variables struct {
+						Input struct {
+							SubjectID  string `json:"subjectId"`
+							Classifier string `json:"classifier"`
+						} `json:"input"`
+					} `json:"variables"`
+				}
+				_ = json.Unmarshal(body, &query)
+				assert.Contains(t, query.Query, "minimizeComment")
+				assert.Equal(t, "OUTDATED", query.Variables.Input.Classifier)
+				minimized = append(minimized, query.Variables.Input.SubjectID)
+				_, _ = w.Write([]byte(`{"data": {"minimizeComment": {"clientMutationId": ""}}}`))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			commenter := NewGithubCommenter(client, "owner", "repo", "ariane[bot]", zerolog.Nop())
+			err = commenter.report(context.Background(), tc.config, 1, config.TemplateWorkflowsReport, "/test", "new")
+			assert.NoError(t, err)
+
+			assert.Len(t, created, len(tc.expectedCreated))
+			for i, expected := range tc.expectedCreated {
+				assert.Contains(t, created[i], expected)
+			}
+			assert.Len(t, edited, len(tc.expectedEdited))
+			for i, expected := range tc.expectedEdited {
+				assert.Contains(t, edited[i], expected)
+				assert.Contains(t, edited[i], "<!-- ariane:section %2Ftest -->\nnew\n")
+			}
+			assert.Equal(t, tc.expectedMinimized, minimized)
+		})
+	}
+}
+
+func TestGithubCommenter_lockFeedback(t *testing.T) {
+	commenter := NewGithubCommenter(nil, "owner", "repo", "ariane[bot]", zerolog.Nop())
+
+	unlock := commenter.lockFeedback(1)
+	locked := make(chan struct{})
+	go func() {
+		defer commenter.lockFeedback(1)()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("the feedback of a pull request must be locked by a single update at a time")
+	case <-time.After(50 * time.Millisecond):
+	}
+	unlock()
+	<-locked
+
+	// locks are dropped once released
+	assert.Eventually(t, func() bool {
+		feedbackLocks.mu.Lock()
+		defer feedbackLocks.mu.Unlock()
+		return len(feedbackLocks.locks) == 0
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+const (
+	// triageLogSizeLimit is the maximum number of bytes read from the log of a failed job
+	triageLogSizeLimit = 64 << 20
+	// triageLineLengthLimit is the maximum length of a log line in a triage excerpt, longer lines are truncated
+	triageLineLengthLimit = 500
+)
+
+// triageHTTPClient downloads job logs. Logs are served from pre-signed URLs, which must be requested
+// without the GitHub authentication.
+var triageHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+var (
+	// logTimestampRegex matches the timestamp prefixing each line of a job log
+	logTimestampRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}T[\d:.]+Z `)
+	// ansiEscapeRegex matches the terminal escape sequences (e.g. colors) found in job logs
+	ansiEscapeRegex = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+)
+
+// extractLogExcerpt returns the last lines of the log matching one of patterns, or the last lines of
+// the log if there are no patterns or none of them matches
+func extractLogExcerpt(log io.Reader, lines int, patterns []*regexp.Regexp) ([]string, error) {
+	var last, matching []string
+	scanner := newLogScanner(log)
+	for scanner.Scan() {
+		line := cleanLogLine(scanner.Text())
+		last = appendBounded(last, line, lines)
+		for _, pattern := range patterns {
+			if pattern.MatchString(line) {
+				matching = appendBounded(matching, line, lines)
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(matching) > 0 {
+		return matching, nil
+	}
+	return last, nil
+}
+
+// cleanLogLine removes the timestamp and escape sequences of a job log line, and truncates it
+func cleanLogLine(line string) string {
+	line = logTimestampRegex.ReplaceAllString(line, "")
+	line = ansiEscapeRegex.ReplaceAllString(line, "")
+	line = strings.TrimRight(line, "\r")
+	if len(line) > triageLineLengthLimit {
+		line = strings.ToValidUTF8(line[:triageLineLengthLimit], "") + "…"
+	}
+	return line
+}
+
+// newLogScanner returns a scanner over the lines of a job log, reading at most triageLogSizeLimit bytes
+func newLogScanner(log io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(io.LimitReader(log, triageLogSizeLimit))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return scanner
+}
+
+// appendBounded appends line to lines, dropping the first lines to keep at most limit lines
+func appendBounded(lines []string, line string, limit int) []string {
+	lines = append(lines, line)
+	if len(lines) > limit {
+		lines = lines[len(lines)-limit:]
+	}
+	return lines
+}
+
+// openJobLog downloads the log of a job, which must be closed by the caller
+func openJobLog(ctx context.Context, client *github.Client, owner, repo string, jobID int64) (io.ReadCloser, error) {
+	logURL, _, err := client.Actions.GetWorkflowJobLogs(ctx, owner, repo, jobID, 1)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := triageHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %d downloading logs of job %d", resp.StatusCode, jobID)
+	}
+	return resp.Body, nil
+}
+
+// downloadJobLogExcerpt downloads the log of a job and extracts its excerpt, see extractLogExcerpt
+func downloadJobLogExcerpt(ctx context.Context, client *github.Client, owner, repo string, jobID int64, lines int, patterns []*regexp.Regexp) ([]string, error) {
+	log, err := openJobLog(ctx, client, owner, repo, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+	return extractLogExcerpt(log, lines, patterns)
+}
+
+// listFailedJobs returns the failed (or timed out) jobs of the latest attempt of a workflow run
+func listFailedJobs(ctx context.Context, client *github.Client, owner, repo string, runID int64) ([]*github.WorkflowJob, error) {
+	var failed []*github.WorkflowJob
+	opts := &github.ListWorkflowJobsOptions{
+		Filter:      "latest",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	for {
+		jobs, response, err := client.Actions.ListWorkflowJobs(ctx, owner, repo, runID, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, job := range jobs.Jobs {
+			if isFailedJob(job) {
+				failed = append(failed, job)
+			}
+		}
+		if response.NextPage == 0 {
+			break
+		}
+		opts.Page = response.NextPage
+	}
+	return failed, nil
+}
+
+// triageFailedRun posts a summary of a workflow run which failed for good on the pull request, with
+// its failed jobs and steps and an excerpt of their logs. It is a no-op unless triage is configured.
+func (w *WorkflowRunHandler) triageFailedRun(
+	ctx context.Context,
+	client *github.Client,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	logger zerolog.Logger,
+) error {
+	if arianeConfig.TriageConfig == nil {
+		return nil
+	}
+
+	runID := workflowRun.GetID()
+	jobs, err := listFailedJobs(ctx, client, repositoryOwner, repositoryName, runID)
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to list workflow jobs for run ID %d", runID)
+		return err
+	}
+	// runs which timed out or never started are reported even without failed jobs
+	if len(jobs) == 0 && workflowRun.GetConclusion() == "failure" {
+		logger.Debug().Msgf("No failed jobs found for workflow '%s' (run ID: %d), skipping triage", workflowName, runID)
+		return nil
+	}
+
+	var patterns []*regexp.Regexp
+	for _, pattern := range arianeConfig.TriageConfig.ErrorPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("Ignoring invalid triage error pattern %q", pattern)
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+
+	var failedJobs []config.FailedJob
+	for _, job := range jobs {
+		if len(failedJobs) == arianeConfig.GetTriageMaxJobs() {
+			break
+		}
+		failedJob := config.FailedJob{Name: job.GetName(), URL: job.GetHTMLURL(), FailedSteps: failedSteps(job)}
+		failedJob.LogExcerpt, err = downloadJobLogExcerpt(ctx, client, repositoryOwner, repositoryName, job.GetID(), arianeConfig.GetTriageLogLines(), patterns)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("Failed to retrieve logs of job %d, triaging it without logs", job.GetID())
+		}
+		failedJobs = append(failedJobs, failedJob)
+	}
+
+	data := config.FeedbackData{
+		Workflow:   workflowName,
+		Triage:     buildTriageSummary(workflowName, workflowRun, failedJobs, len(jobs)),
+		FailedJobs: failedJobs,
+	}
+	commenter := NewGithubCommenter(client, repositoryOwner, repositoryName, w.BotLogin, logger)
+	comment := feedbackMessage(arianeConfig, config.TemplateRunFailed, data, logger)
+	return commenter.report(ctx, arianeConfig, pullRequest.GetNumber(), config.TemplateRunFailed, workflowName, comment)
+}
+
+// buildTriageSummary renders the triage summary of a failed run, with a collapsible section per failed
+// job. total is the number of failed jobs, which may be larger than the number of jobs detailed.
+func buildTriageSummary(workflowName string, workflowRun *github.WorkflowRun, failedJobs []config.FailedJob, total int) string {
+	var builder strings.Builder
+	name := fmt.Sprintf("`%s`", workflowName)
+	if workflowRun.GetHTMLURL() != "" {
+		name = fmt.Sprintf("[`%s`](%s)", workflowName, workflowRun.GetHTMLURL())
+	}
+	switch workflowRun.GetConclusion() {
+	case "timed_out":
+		fmt.Fprintf(&builder, "## ⏱️ %s timed out", name)
+	case "startup_failure":
+		fmt.Fprintf(&builder, "## ❌ %s failed to start", name)
+	default:
+		fmt.Fprintf(&builder, "## ❌ %s failed", name)
+	}
+	if attempt := workflowRun.GetRunAttempt(); attempt > 1 {
+		fmt.Fprintf(&builder, " after %d attempts", attempt)
+	}
+	builder.WriteString("\n")
+
+	for _, job := range failedJobs {
+		summary := fmt.Sprintf("<code>%s</code>", html.EscapeString(job.Name))
+		if len(job.FailedSteps) > 0 {
+			steps := make([]string, 0, len(job.FailedSteps))
+			for _, step := range job.FailedSteps {
+				steps = append(steps, fmt.Sprintf("<code>%s</code>", html.EscapeString(step)))
+			}
+			summary += " failed at " + strings.Join(steps, ", ")
+		}
+		fmt.Fprintf(&builder, "\n<details><summary>%s</summary>\n\n", summary)
+		if job.URL != "" {
+			fmt.Fprintf(&builder, "[Job logs](%s)\n\n", job.URL)
+		}
+		if len(job.LogExcerpt) > 0 {
+			builder.WriteString("```text\n")
+			for _, line := range job.LogExcerpt {
+				// do not let log lines close the code block
+				builder.WriteString(strings.ReplaceAll(line, "```", "'''") + "\n")
+			}
+			builder.WriteString("```\n\n")
+		}
+		builder.WriteString("</details>\n")
+	}
+
+	if total > len(failedJobs) {
+		fmt.Fprintf(&builder, "\nand %d more failed job(s).\n", total-len(failedJobs))
+	}
+	return builder.String()
+}
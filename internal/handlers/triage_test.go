@@ -0,0 +1,201 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func Test_extractLogExcerpt(t *testing.T) {
+	log := strings.Join([]string{
+		"2024-01-02T03:04:05.1234567Z ##[group]Run make test",
+		"2024-01-02T03:04:06.1234567Z \x1b[36;1mmake test\x1b[0m",
+		"2024-01-02T03:04:07.1234567Z --- FAIL: TestFoo (0.01s)",
+		"2024-01-02T03:04:08.1234567Z     foo_test.go:12: expected 1, got 2",
+		"2024-01-02T03:04:09.1234567Z FAIL",
+		"2024-01-02T03:04:10.1234567Z ##[error]Process completed with exit code 2.",
+	}, "\r\n")
+
+	testCases := []struct {
+		name     string
+		lines    int
+		patterns []string
+		expected []string
+	}{
+		{
+			name:     "last lines",
+			lines:    2,
+			expected: []string{"FAIL", "##[error]Process completed with exit code 2."},
+		},
+		{
+			name:     "lines matching error patterns",
+			lines:    5,
+			patterns: []string{`^--- FAIL`, `^##\[error\]`},
+			expected: []string{"--- FAIL: TestFoo (0.01s)", "##[error]Process completed with exit code 2."},
+		},
+		{
+			name:     "last lines matching error patterns",
+			lines:    1,
+			patterns: []string{`FAIL`},
+			expected: []string{"FAIL"},
+		},
+		{
+			name:     "last lines if no line matches",
+			lines:    1,
+			patterns: []string{`panic:`},
+			expected: []string{"##[error]Process completed with exit code 2."},
+		},
+		{
+			name:     "escape sequences removed",
+			lines:    5,
+			patterns: []string{`^make`},
+			expected: []string{"make test"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var patterns []*regexp.Regexp
+			for _, pattern := range tc.patterns {
+				patterns = append(patterns, regexp.MustCompile(pattern))
+			}
+			excerpt, err := extractLogExcerpt(strings.NewReader(log), tc.lines, patterns)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, excerpt)
+		})
+	}
+}
+
+func TestWorkflowRunHandler_Failure_Triage(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+	configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		return &config.ArianeConfig{
+			RerunConfig:  &config.RerunConfig{MaxRetries: 1},
+			TriageConfig: &config.TriageConfig{LogLines: 2, MaxJobs: 1},
+		}, nil
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	rerunCalled := false
+	var comments []string
+
+	mux.HandleFunc("/repos/owner/repo/pulls", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]*github.PullRequest{{
+			Number: github.Ptr(1),
+			User:   &github.User{Login: github.Ptr("owner-renovate[bot]")},
+		}})
+	})
+	// the run is at its second attempt, so it is not rerun anymore
+	mux.HandleFunc("/repos/owner/repo/actions/runs/123", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](123), RunAttempt: github.Ptr(2)})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/123/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+		rerunCalled = true
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/runs/123/jobs", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(&github.Jobs{
+			TotalCount: github.Ptr(3),
+			Jobs: []*github.WorkflowJob{
+				{ID: github.Ptr[int64](1), Name: github.Ptr("build"), Conclusion: github.Ptr("success")},
+				{
+					ID:         github.Ptr[int64](2),
+					Name:       github.Ptr("test <unit>"),
+					Conclusion: github.Ptr("failure"),
+					HTMLURL:    github.Ptr("https://github.com/owner/repo/actions/runs/123/job/2"),
+					Steps: []*github.TaskStep{
+						{Name: github.Ptr("Checkout"), Conclusion: github.Ptr("success")},
+						{Name: github.Ptr("Run tests"), Conclusion: github.Ptr("failure")},
+					},
+				},
+				{ID: github.Ptr[int64](3), Name: github.Ptr("e2e"), Conclusion: github.Ptr("failure")},
+			},
+		})
+	})
+	mux.HandleFunc("/repos/owner/repo/actions/jobs/2/logs", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL+"/logs/2", http.StatusFound)
+	})
+	mux.HandleFunc("/logs/2", func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Authorization"))
+		_, _ = w.Write([]byte("ok\n```go\n--- FAIL: TestFoo (0.01s)\n"))
+	})
+	mux.HandleFunc("POST /repos/owner/repo/issues/1/comments", func(w http.ResponseWriter, r *http.Request) {
+		var comment github.IssueComment
+		_ = json.NewDecoder(r.Body).Decode(&comment)
+		comments = append(comments, comment.GetBody())
+		_ = json.NewEncoder(w).Encode(comment)
+	})
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+	handler := &WorkflowRunHandler{
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
+	}
+
+	payload := []byte(`{
+		"action": "completed",
+		"workflow": {
+			"name": "test-workflow",
+			"path": ".github/workflows/test.yaml"
+		},
+		"workflow_run": {
+			"id": 123,
+			"conclusion": "failure",
+			"run_attempt": 2,
+			"html_url": "https://github.com/owner/repo/actions/runs/123",
+			"pull_requests": [
+				{
+					"number": 1
+				}
+			]
+		},
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"installation": {
+			"id": 1
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+	assert.NoError(t, err)
+	assert.False(t, rerunCalled, "Rerun should not have been called when max retries reached")
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "## ❌ [`test-workflow`](https://github.com/owner/repo/actions/runs/123) failed after 2 attempts\n"+
+			"\n<details><summary><code>test &lt;unit&gt;</code> failed at <code>Run tests</code></summary>\n\n"+
+			"[Job logs](https://github.com/owner/repo/actions/runs/123/job/2)\n\n"+
+			"```text\n'''go\n--- FAIL: TestFoo (0.01s)\n```\n\n"+
+			"</details>\n"+
+			"\nand 1 more failed job(s).\n", comments[0])
+	}
+}
@@ -10,11 +10,14 @@ import (
 	"fmt"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
+	"github.com/cilium/ariane/internal/scheduler"
 	"github.com/google/go-github/v88/github"
 	"github.com/rs/zerolog"
 	"gopkg.in/yaml.v3"
@@ -27,6 +30,34 @@ type WorkflowProcessor struct {
 	repo         string
 	logger       zerolog.Logger
 	runDelay     time.Duration
+	// sender is the user whose action triggered the workflows, reported in the workflows report
+	sender string
+	// reruns are the reruns of failed workflow runs in progress
+	reruns rerunTasks
+	// scheduler runs the reruns of failed workflow runs, along with their pre-rerun jobs, if set. Without
+	// it, they run in the background until the workflows are processed.
+	scheduler      *scheduler.Scheduler
+	installationID int64
+	// pendingChecks are the pending check runs created for dispatched workflows, by workflow
+	pendingChecks map[string][]pendingCheck
+	// baseRef is the branch targeted by the pull request, whose required status checks are the only
+	// check runs marked as skipped
+	baseRef string
+	// requiredChecks are the required status checks of baseRef which Ariane can provide, once retrieved
+	requiredChecks map[string]bool
+	// allChecksRequired is set when the required status checks of baseRef cannot be retrieved
+	allChecksRequired bool
+	// appID is the ID of the Ariane app: required checks which must be provided by other apps are not
+	// marked as skipped
+	appID int64
+	// flakeStore holds the quarantine decisions, so that quarantined workflows do not fail the aggregate
+	// check run, if set
+	flakeStore *flakes.Store
+	// dispatches are the runs created by the workflow dispatches, by workflow
+	dispatches map[string]*github.WorkflowDispatchRunDetails
+	// dispatchedRuns remembers the dispatched runs, to update their pending check runs and workflows
+	// report row once they complete, if set
+	dispatchedRuns *DispatchedRunTracker
 }
 
 func (w *WorkflowProcessor) processWorkflow(
@@ -50,6 +81,7 @@ func (w *WorkflowProcessor) processWorkflow(
 			w.logger.Error().Err(err).Msgf("Failed to trigger workflow %s", workflow)
 			return &workflowStatus{name: workflow, status: workflowStatusFailed}
 		}
+		w.createPendingChecks(ctx, workflow, sha)
 		if w.arianeConfig.GetReportAllWorkflows() {
 			return &workflowStatus{name: workflow, status: workflowStatusTriggered}
 		}
@@ -62,7 +94,7 @@ func (w *WorkflowProcessor) processWorkflow(
 		return &workflowStatus{name: workflow, status: workflowStatusFailedToMarkSkipped}
 	}
 	if w.arianeConfig.GetReportAllWorkflows() {
-		return &workflowStatus{name: workflow, status: workflowStatusSkipped}
+		return &workflowStatus{name: workflow, status: workflowStatusSkipped, reason: w.arianeConfig.SkipReason(workflow, files)}
 	}
 	return nil
 }
@@ -86,8 +118,7 @@ func (w *WorkflowProcessor) shouldSkipWorkflow(ctx context.Context, workflow, SH
 				return true
 			}
 			if conc == "failure" {
-				var wg sync.WaitGroup
-				w.rerunFailedJobs(ctx, workflow, lastRun.GetID(), &wg)
+				w.rerunFailedJobs(ctx, workflow, lastRun.GetID())
 				return true
 			}
 		}
@@ -103,68 +134,196 @@ func (w *WorkflowProcessor) shouldRunWorkflow(ctx context.Context, workflow stri
 }
 
 func (w *WorkflowProcessor) triggerWorkflow(ctx context.Context, workflow string, event github.CreateWorkflowDispatchEventRequest) error {
-	if _, _, err := w.client.Actions.CreateWorkflowDispatchEventByFileName(ctx, w.owner, w.repo, workflow, event); err != nil {
+	run, _, err := w.client.Actions.CreateWorkflowDispatchEventByFileName(ctx, w.owner, w.repo, workflow, event)
+	if err != nil {
 		w.logger.Error().Err(err).Msg("Failed to create workflow dispatch event")
 		return err
 	}
+	if run.GetWorkflowRunID() != 0 {
+		if w.dispatches == nil {
+			w.dispatches = make(map[string]*github.WorkflowDispatchRunDetails)
+		}
+		w.dispatches[workflow] = run
+	}
 	return nil
 }
 
-func (w *WorkflowProcessor) rerunFailedJobs(ctx context.Context, workflow string, runID int64, wg *sync.WaitGroup) {
-	jobListOpts := &github.ListWorkflowJobsOptions{ListOptions: github.ListOptions{PerPage: 200}}
-	wg.Add(1)
+// rerunTasks tracks the reruns of failed workflow runs started while processing workflows, so that their
+// errors can be reported once they complete, or queued to be run by the scheduler
+type rerunTasks struct {
+	wg   sync.WaitGroup
+	mu   sync.Mutex
+	errs error
+	// queued are the reruns to schedule once the workflows are processed
+	queued []scheduledPreRerun
+}
+
+// start runs task in the background
+func (t *rerunTasks) start(task func() error) {
+	t.wg.Add(1)
 	go func() {
-		defer wg.Done()
-		ctx, cancel := context.WithTimeout(ctx, w.runDelay+time.Second*5)
-		defer cancel()
+		defer t.wg.Done()
+		if err := task(); err != nil {
+			t.mu.Lock()
+			t.errs = errors.Join(t.errs, err)
+			t.mu.Unlock()
+		}
+	}()
+}
+
+// wait waits for the started tasks to complete, and returns their errors
+func (t *rerunTasks) wait() error {
+	t.wg.Wait()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.errs
+}
 
+// preRerunPollInterval is how often the run of a pre-rerun job is polled while waiting for its completion
+var preRerunPollInterval = 10 * time.Second
+
+// rerunFailedJobs reruns the failed jobs of a workflow run in the background, after its pre-rerun jobs.
+// With a scheduler, the rerun is queued to be scheduled once the workflows are processed.
+func (w *WorkflowProcessor) rerunFailedJobs(ctx context.Context, workflow string, runID int64) {
+	if w.scheduler != nil {
+		w.reruns.queued = append(w.reruns.queued, scheduledPreRerun{Workflow: workflow, RunID: runID})
+		return
+	}
+	w.reruns.start(func() error {
+		return w.rerunSequence(ctx, workflow, runID)
+	})
+}
+
+// rerunSequence reruns the jobs of a workflow run matching its pre-rerun jobs, in order, each followed by
+// a delay or by waiting for its completion, then reruns the failed jobs of the run
+func (w *WorkflowProcessor) rerunSequence(ctx context.Context, workflow string, runID int64) error {
+	preRerunJobs := w.arianeConfig.GetPreRerunJobs(workflow)
+	if len(preRerunJobs) > 0 {
+		jobListOpts := &github.ListWorkflowJobsOptions{ListOptions: github.ListOptions{PerPage: 100}}
 		jobs, _, err := w.client.Actions.ListWorkflowJobs(ctx, w.owner, w.repo, runID, jobListOpts)
 		if err != nil {
 			w.logger.Err(err).Msgf("Failed to list workflow %s jobs run_id %d", workflow, runID)
-			return
+			return fmt.Errorf("failed to list jobs of workflow %s run %d: %w", workflow, runID, err)
 		}
 
-		var jobID int64
-		// Find the commit-status-start job
-		for _, job := range jobs.Jobs {
-			if job.GetName() == "Commit Status Start" {
-				jobID = job.GetID()
-				break
+		for _, preRerunJob := range preRerunJobs {
+			re, err := regexp.Compile(preRerunJob.Job)
+			if err != nil {
+				return fmt.Errorf("invalid pre-rerun job %q of workflow %s: %w", preRerunJob.Job, workflow, err)
 			}
-		}
-		if jobID != 0 {
-			w.logger.Debug().Msgf("re-running commit-status-start job %d", jobID)
-			if _, err := w.client.Actions.RerunJobByID(ctx, w.owner, w.repo, jobID); err != nil {
-				w.logger.Error().Err(err).Msgf("Failed to re-run commit-status-start job_id %d", jobID)
-				return
+			for _, job := range jobs.Jobs {
+				if !re.MatchString(job.GetName()) {
+					continue
+				}
+				if err := w.rerunPreRerunJob(ctx, workflow, runID, job, preRerunJob); err != nil {
+					return err
+				}
 			}
-			time.Sleep(w.runDelay)
 		}
+	}
+
+	w.logger.Debug().Msgf("re-running failed workflow %s run_id %d", workflow, runID)
+	if _, err := w.client.Actions.RerunFailedJobsByID(ctx, w.owner, w.repo, runID); err != nil {
+		w.logger.Error().Err(err).Msgf("Failed to re-run workflow %s job_id %d", workflow, runID)
+		return fmt.Errorf("failed to rerun failed jobs of workflow %s run %d: %w", workflow, runID, err)
+	}
+	return nil
+}
 
-		w.logger.Debug().Msgf("re-running failed workflow %s run_id %d", workflow, runID)
-		if _, err := w.client.Actions.RerunFailedJobsByID(ctx, w.owner, w.repo, runID); err != nil {
-			w.logger.Error().Err(err).Msgf("Failed to re-run workflow %s job_id %d", workflow, runID)
+// rerunPreRerunJob reruns a job of a workflow run, then waits for its completion or for the configured delay
+func (w *WorkflowProcessor) rerunPreRerunJob(ctx context.Context, workflow string, runID int64, job *github.WorkflowJob, preRerunJob config.PreRerunJob) error {
+	var attempt int
+	if preRerunJob.WaitForCompletion {
+		run, _, err := w.client.Actions.GetWorkflowRunByID(ctx, w.owner, w.repo, runID)
+		if err != nil {
+			return fmt.Errorf("failed to get workflow %s run %d: %w", workflow, runID, err)
 		}
-	}()
+		attempt = run.GetRunAttempt()
+	}
+
+	w.logger.Debug().Msgf("re-running job %q (job_id %d) of workflow %s run_id %d", job.GetName(), job.GetID(), workflow, runID)
+	if _, err := w.client.Actions.RerunJobByID(ctx, w.owner, w.repo, job.GetID()); err != nil {
+		w.logger.Error().Err(err).Msgf("Failed to re-run job %q job_id %d", job.GetName(), job.GetID())
+		return fmt.Errorf("failed to rerun job %q of workflow %s run %d: %w", job.GetName(), workflow, runID, err)
+	}
+
+	if !preRerunJob.WaitForCompletion {
+		delay := preRerunJob.Delay
+		if delay == 0 {
+			delay = w.runDelay
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+			return nil
+		}
+	}
+
+	// rerunning the job starts a new attempt of the run, which completes with the job
+	timeout := preRerunJob.Timeout
+	if timeout == 0 {
+		timeout = config.DefaultPreRerunTimeout
+	}
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		run, _, err := w.client.Actions.GetWorkflowRunByID(waitCtx, w.owner, w.repo, runID)
+		if err == nil && run.GetRunAttempt() > attempt && run.GetStatus() == "completed" {
+			w.logger.Debug().Msgf("job %q of workflow %s run_id %d completed", job.GetName(), workflow, runID)
+			return nil
+		}
+		select {
+		case <-waitCtx.Done():
+			return fmt.Errorf("job %q of workflow %s run %d did not complete within %s", job.GetName(), workflow, runID, timeout)
+		case <-time.After(preRerunPollInterval):
+		}
+	}
 }
 
 func (w *WorkflowProcessor) markWorkflowAsSkipped(ctx context.Context, workflow, SHA string) error {
-	githubWorkflow, _, err := w.client.Actions.GetWorkflowByFileName(ctx, w.owner, w.repo, workflow)
+	names, err := w.skippedCheckNames(ctx, workflow)
 	if err != nil {
-		w.logger.Error().Err(err).Msg("Failed to retrieve workflow")
+		w.logger.Error().Err(err).Msgf("Failed to retrieve the check names of workflow %s", workflow)
 		return err
 	}
 
-	checkRunOptions := github.CreateCheckRunOptions{
-		Name:       githubWorkflow.GetName(),
-		HeadSHA:    SHA,
-		Status:     github.Ptr("completed"),
-		Conclusion: github.Ptr("skipped"),
+	// Only required checks are marked as skipped, if configured so. Workflows summarized by the aggregate
+	// check run are always marked as skipped, as it relies on their skipped check runs.
+	if w.arianeConfig.GetSkippedChecks() == config.SkippedChecksRequired && !requiresWorkflow(w.arianeConfig, workflow) {
+		names = slices.DeleteFunc(slices.Clone(names), func(name string) bool {
+			if w.isRequiredCheck(ctx, name) {
+				return false
+			}
+			w.logger.Debug().Msgf("Not marking check %s of workflow %s as skipped, as it is not required", name, workflow)
+			return true
+		})
 	}
-	if _, _, err := w.client.Checks.CreateCheckRun(ctx, w.owner, w.repo, checkRunOptions); err != nil {
-		w.logger.Error().Err(err).Msg("Failed to set check run")
+
+	// Check runs already marked as skipped on SHA are not duplicated
+	skipped, err := skippedChecks(ctx, w.client, w.owner, w.repo, workflow, SHA)
+	if err != nil {
+		w.logger.Error().Err(err).Msgf("Failed to retrieve the skipped check runs of workflow %s", workflow)
 		return err
 	}
+
+	for _, name := range names {
+		if slices.ContainsFunc(skipped, func(checkRun *github.CheckRun) bool { return checkRun.GetName() == name }) {
+			w.logger.Debug().Msgf("Check %s of workflow %s is already marked as skipped", name, workflow)
+			continue
+		}
+		checkRunOptions := github.CreateCheckRunOptions{
+			Name:       name,
+			HeadSHA:    SHA,
+			Status:     github.Ptr("completed"),
+			Conclusion: github.Ptr("skipped"),
+			ExternalID: github.Ptr(skippedCheckExternalID(workflow)),
+		}
+		if _, _, err := w.client.Checks.CreateCheckRun(ctx, w.owner, w.repo, checkRunOptions); err != nil {
+			w.logger.Error().Err(err).Msg("Failed to set check run")
+			return err
+		}
+	}
 	return nil
 }
 
@@ -172,6 +331,8 @@ func (w *WorkflowProcessor) markWorkflowAsSkipped(ctx context.Context, workflow,
 func (w *WorkflowProcessor) createWorkflowDispatchEvent(prNumber int, contextRef, headSHA, baseSHA string, submatch []string) github.CreateWorkflowDispatchEventRequest {
 	workflowDispatchEvent := github.CreateWorkflowDispatchEventRequest{
 		Ref: contextRef,
+		// The run created by the dispatch is returned, as it can't be told apart from other runs reliably
+		ReturnRunDetails: github.Ptr(true),
 		// These are parameters (inputs) on workflow_dispatch
 		Inputs: map[string]interface{}{
 			"PR-number":   strconv.Itoa(prNumber),
@@ -209,6 +370,21 @@ func (w *WorkflowProcessor) getPRFiles(ctx context.Context, prNumber int) ([]*gi
 	return files, nil
 }
 
+// comparisonFilesLimit is the maximum number of files listed in a comparison of two commits, further
+// changed files being left out
+const comparisonFilesLimit = 300
+
+// getComparisonFiles returns the list of files changed between two commits, and whether it is complete:
+// comparisons list at most comparisonFilesLimit files, and don't paginate them
+func (w *WorkflowProcessor) getComparisonFiles(ctx context.Context, base, head string) ([]*github.CommitFile, bool, error) {
+	comparison, _, err := w.client.Repositories.CompareCommits(ctx, w.owner, w.repo, base, head, nil)
+	if err != nil {
+		w.logger.Error().Err(err).Msgf("Failed to compare %s against %s", head, base)
+		return nil, false, err
+	}
+	return comparison.Files, len(comparison.Files) < comparisonFilesLimit, nil
+}
+
 type TriggerSkippedDependencyInProgressError string
 
 func (e TriggerSkippedDependencyInProgressError) Error() string {
@@ -248,9 +424,9 @@ func (w *WorkflowProcessor) processWorkflowsForTrigger(ctx context.Context, subm
 
 	files, err := w.getPRFiles(ctx, prNumber)
 	if err != nil {
-		comment := fmt.Sprintf("Failed to retrieve pull request files: %v", err)
 		if w.arianeConfig.GetVerbose() {
-			_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
+			comment := feedbackMessage(w.arianeConfig, config.TemplateFilesFailed, config.FeedbackData{Author: w.sender, Command: submatch[0], Reason: err.Error()}, w.logger)
+			_ = commenter.report(ctx, w.arianeConfig, prNumber, config.TemplateFilesFailed, submatch[0], comment)
 		}
 		return err
 	}
@@ -260,18 +436,87 @@ func (w *WorkflowProcessor) processWorkflowsForTrigger(ctx context.Context, subm
 	for _, workflow := range workflowsToTrigger {
 		status := w.processWorkflow(ctx, workflow, files, workflowDispatchEvent, headSHA)
 		if status != nil {
+			status.trigger = submatch[0]
+			status.sender = w.sender
 			workflowStatuses = append(workflowStatuses, *status)
 		}
 	}
 
+	// Remember the runs of the dispatched workflows and the commit they run for, to complete their pending
+	// check runs and update the workflows report once they complete
+	tracked := make(map[int64]dispatchedRun)
+	for _, workflow := range workflowsToTrigger {
+		if run, ok := w.dispatches[workflow]; ok {
+			tracked[run.GetWorkflowRunID()] = dispatchedRun{owner: w.owner, repo: w.repo, prNumber: prNumber, workflow: workflow, sha: headSHA, checks: w.pendingChecks[workflow]}
+		}
+	}
+
 	// Build summary comment with workflow status table
-	if w.arianeConfig.GetVerbose() && w.arianeConfig.GetWorkflowsReport() && len(workflowStatuses) > 0 {
-		comment := buildWorkflowStatusTable(workflowStatuses)
-		_ = commenter.commentOnPullRequest(ctx, prNumber, comment)
+	reportChannel := w.arianeConfig.GetFeedbackChannel(config.TemplateWorkflowsReport)
+	if w.arianeConfig.GetVerbose() && w.arianeConfig.GetWorkflowsReport() && reportChannel != config.ChannelNone && len(workflowStatuses) > 0 {
+		for i, status := range workflowStatuses {
+			if status.status != workflowStatusTriggered {
+				continue
+			}
+			run, ok := w.dispatches[status.name]
+			if !ok {
+				continue
+			}
+			workflowStatuses[i].runID = run.GetWorkflowRunID()
+			workflowStatuses[i].runURL = run.GetHTMLURL()
+			workflowStatuses[i].attempt = 1
+			trackedRun := tracked[run.GetWorkflowRunID()]
+			trackedRun.channel, trackedRun.status = reportChannel, workflowStatuses[i]
+			tracked[run.GetWorkflowRunID()] = trackedRun
+		}
+		data := config.FeedbackData{
+			Author:    w.sender,
+			Command:   submatch[0],
+			Table:     buildWorkflowStatusTable(workflowStatuses),
+			Workflows: workflowReports(workflowStatuses),
+		}
+		comment := feedbackMessage(w.arianeConfig, config.TemplateWorkflowsReport, data, w.logger)
+		_ = commenter.report(ctx, w.arianeConfig, prNumber, config.TemplateWorkflowsReport, submatch[0], comment)
+	}
+	for runID, run := range tracked {
+		if err := w.dispatchedRuns.add(runID, run); err != nil {
+			w.logger.Error().Err(err).Msgf("Failed to remember dispatched run %d", runID)
+		}
+	}
+
+	// Skipped workflows have no run whose events update the aggregate check run of the head commit
+	if defaultConfig, err := configGetArianeConfigFromRepository(w.client, ctx, w.owner, w.repo, ""); err != nil {
+		w.logger.Debug().Err(err).Msg("Failed to retrieve Ariane config of the default branch")
+	} else if slices.ContainsFunc(workflowsToTrigger, func(workflow string) bool { return requiresWorkflow(defaultConfig, workflow) }) {
+		_ = updateRequiredCheck(ctx, w.client, w.owner, w.repo, headSHA, defaultConfig, w.flakeStore, w.dispatchedRuns, w.logger)
+	}
+
+	// failed workflow runs are rerun by the scheduler, which reports their errors, as their pre-rerun jobs
+	// may take long. Without it, they are rerun in the background while the other workflows are processed.
+	if err := w.scheduleReruns(prNumber, submatch[0]); err != nil {
+		return fmt.Errorf("failed to schedule workflow reruns: %w", err)
+	}
+	if err := w.reruns.wait(); err != nil {
+		return fmt.Errorf("failed to rerun workflows: %w", err)
 	}
 	return nil
 }
 
+// scheduleReruns schedules the reruns queued while processing the workflows of trigger on a pull request
+func (w *WorkflowProcessor) scheduleReruns(prNumber int, trigger string) error {
+	var errs error
+	for _, rerun := range w.reruns.queued {
+		rerun.InstallationID, rerun.Owner, rerun.Repo = w.installationID, w.owner, w.repo
+		rerun.PR, rerun.Trigger, rerun.Sender = prNumber, trigger, w.sender
+		if err := w.scheduler.Schedule(preRerunTaskKind, time.Now(), rerun); err != nil {
+			w.logger.Error().Err(err).Msgf("Failed to schedule rerun of workflow %s run_id %d", rerun.Workflow, rerun.RunID)
+			errs = errors.Join(errs, err)
+		}
+	}
+	w.reruns.queued = nil
+	return errs
+}
+
 // checkTriggerDependency checks if all workflows from the dependency trigger have completed successfully or been skipped
 func (w *WorkflowProcessor) checkTriggerDependency(ctx context.Context, dependsOnTrigger, sha string) (canRun bool, inProgress bool, err error) {
 	// Get the trigger configuration for the dependency
@@ -5,11 +5,18 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/cilium/ariane/internal/config"
 	github "github.com/google/go-github/v88/github"
 	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
 )
 
 func Test_checkTriggerDependency(t *testing.T) {
@@ -139,3 +146,123 @@ func Test_checkTriggerDependency(t *testing.T) {
 		}
 	}
 }
+
+func TestWorkflowProcessor_rerunSequence(t *testing.T) {
+	oldPreRerunPollInterval := preRerunPollInterval
+	defer func() { preRerunPollInterval = oldPreRerunPollInterval }()
+	preRerunPollInterval = time.Millisecond
+
+	testCases := []struct {
+		name          string
+		preRerunJobs  map[string][]config.PreRerunJob
+		failedJobID   int64
+		expectedCalls []string
+		expectedError string
+	}{
+		{
+			name:          "default pre-rerun job",
+			expectedCalls: []string{"rerun job 1", "rerun failed jobs"},
+		},
+		{
+			name: "ordered pre-rerun jobs waiting for completion",
+			preRerunJobs: map[string][]config.PreRerunJob{
+				"foo.yaml": {
+					{Job: "^Setup", WaitForCompletion: true},
+					{Job: "^Commit Status Start$", WaitForCompletion: true},
+				},
+			},
+			expectedCalls: []string{"rerun job 3", "rerun job 1", "rerun failed jobs"},
+		},
+		{
+			name:          "pre-rerun jobs disabled",
+			preRerunJobs:  map[string][]config.PreRerunJob{"foo.yaml": {}},
+			expectedCalls: []string{"rerun failed jobs"},
+		},
+		{
+			name:          "pre-rerun job failed to rerun",
+			failedJobID:   1,
+			expectedCalls: []string{"rerun job 1"},
+			expectedError: `failed to rerun job "Commit Status Start" of workflow foo.yaml run 99`,
+		},
+		{
+			name: "pre-rerun job did not complete",
+			preRerunJobs: map[string][]config.PreRerunJob{
+				"foo.yaml": {{Job: "^Commit Status Start$", WaitForCompletion: true, Timeout: 10 * time.Millisecond}},
+			},
+			failedJobID:   -1,
+			expectedCalls: []string{"rerun job 1"},
+			expectedError: `job "Commit Status Start" of workflow foo.yaml run 99 did not complete within 10ms`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			var mu sync.Mutex
+			var calls []string
+			attempt := 1
+			mux.HandleFunc("/repos/owner/repo/actions/runs/99/jobs", func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(&github.Jobs{
+					TotalCount: github.Ptr(3),
+					Jobs: []*github.WorkflowJob{
+						{ID: github.Ptr[int64](1), Name: github.Ptr("Commit Status Start"), Conclusion: github.Ptr("success")},
+						{ID: github.Ptr[int64](2), Name: github.Ptr("e2e"), Conclusion: github.Ptr("failure")},
+						{ID: github.Ptr[int64](3), Name: github.Ptr("Setup cluster"), Conclusion: github.Ptr("success")},
+					},
+				})
+			})
+			mux.HandleFunc("/repos/owner/repo/actions/runs/99", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				_ = json.NewEncoder(w).Encode(&github.WorkflowRun{ID: github.Ptr[int64](99), RunAttempt: github.Ptr(attempt), Status: github.Ptr("completed")})
+			})
+			mux.HandleFunc("POST /repos/owner/repo/actions/jobs/{id}/rerun", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls = append(calls, "rerun job "+r.PathValue("id"))
+				switch {
+				case r.PathValue("id") == strconv.FormatInt(tc.failedJobID, 10):
+					w.WriteHeader(http.StatusForbidden)
+				case tc.failedJobID == -1:
+					// the rerun job never completes
+					w.WriteHeader(http.StatusCreated)
+				default:
+					attempt++
+					w.WriteHeader(http.StatusCreated)
+				}
+			})
+			mux.HandleFunc("POST /repos/owner/repo/actions/runs/99/rerun-failed-jobs", func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				calls = append(calls, "rerun failed jobs")
+				w.WriteHeader(http.StatusCreated)
+			})
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			processor := &WorkflowProcessor{
+				client:       client,
+				arianeConfig: &config.ArianeConfig{PreRerunJobs: tc.preRerunJobs},
+				owner:        "owner",
+				repo:         "repo",
+				logger:       zerolog.Nop(),
+				runDelay:     time.Millisecond,
+			}
+			processor.rerunFailedJobs(context.Background(), "foo.yaml", 99)
+			err = processor.reruns.wait()
+			if tc.expectedError == "" {
+				assert.NoError(t, err)
+			} else if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tc.expectedError)
+			}
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
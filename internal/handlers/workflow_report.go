@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+// workflowRunRowRegex matches the row of the workflows report describing a given workflow run
+func workflowRunRowRegex(runID int64) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`(?m)^\| .*<!-- ariane:run:%d --> \|.*$`, runID))
+}
+
+// workflowStatusRow renders the row of the workflows report describing ws. Rows of dispatched runs
+// embed a hidden marker, so they can be updated once the run completes.
+func workflowStatusRow(ws workflowStatus) string {
+	name := fmt.Sprintf("`%s`", ws.name)
+	if ws.runURL != "" {
+		name = fmt.Sprintf("[`%s`](%s)", ws.name, ws.runURL)
+	}
+	if ws.runID != 0 {
+		name += fmt.Sprintf(" <!-- ariane:run:%d -->", ws.runID)
+	}
+
+	status := getStatusEmoji(ws.status)
+	if ws.conclusion != "" {
+		status = getConclusionEmoji(ws.conclusion)
+	}
+	if ws.reason != "" {
+		status += ": " + ws.reason
+	}
+
+	var attempt string
+	if ws.attempt > 0 {
+		attempt = fmt.Sprintf("#%d", ws.attempt)
+	}
+
+	var triggeredBy string
+	if ws.trigger != "" {
+		triggeredBy = fmt.Sprintf("`%s`", ws.trigger)
+		if ws.sender != "" {
+			triggeredBy += " by @" + ws.sender
+		}
+	}
+
+	var duration string
+	if ws.duration > 0 {
+		duration = ws.duration.Round(time.Second).String()
+	}
+
+	return fmt.Sprintf("| %s | %s | %s | %s | %s |", name, escapeTableCell(status), attempt, escapeTableCell(triggeredBy), duration)
+}
+
+// workflowReports returns the content of the workflows report, as made available to feedback templates
+func workflowReports(workflowStatuses []workflowStatus) []config.WorkflowReport {
+	reports := make([]config.WorkflowReport, 0, len(workflowStatuses))
+	for _, ws := range workflowStatuses {
+		status := getStatusEmoji(ws.status)
+		if ws.conclusion != "" {
+			status = getConclusionEmoji(ws.conclusion)
+		}
+		reports = append(reports, config.WorkflowReport{
+			Name:    ws.name,
+			Status:  status,
+			Reason:  ws.reason,
+			RunURL:  ws.runURL,
+			Attempt: ws.attempt,
+		})
+	}
+	return reports
+}
+
+func getConclusionEmoji(conclusion string) string {
+	switch conclusion {
+	case "success":
+		return "✅ Success"
+	case "failure":
+		return "❌ Failure"
+	case "cancelled":
+		return "🚫 Cancelled"
+	case "timed_out":
+		return "⏱️ Timed Out"
+	case "skipped":
+		return "⏭️ Skipped"
+	default:
+		return conclusion
+	}
+}
+
+// reportRunCompletion updates the row of a dispatched run in the workflows report with its
+// conclusion, attempt and duration, in the channel the report was posted through
+func (c *GithubCommenter) reportRunCompletion(ctx context.Context, run dispatchedRun, workflowRun *github.WorkflowRun) error {
+	status := run.status
+	status.conclusion = workflowRun.GetConclusion()
+	status.attempt = workflowRun.GetRunAttempt()
+	if workflowRun.GetHTMLURL() != "" {
+		status.runURL = workflowRun.GetHTMLURL()
+	}
+	if startedAt := workflowRun.GetRunStartedAt(); !startedAt.IsZero() {
+		status.duration = workflowRun.GetUpdatedAt().Sub(startedAt.Time)
+	}
+
+	rowRegex := workflowRunRowRegex(status.runID)
+	row := workflowStatusRow(status)
+	return c.channel(run.channel, false).edit(ctx, run.prNumber, func(body string) (string, bool) {
+		if !rowRegex.MatchString(body) {
+			return "", false
+		}
+		return rowRegex.ReplaceAllLiteralString(body, row), true
+	})
+}
@@ -0,0 +1,205 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v88/github"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/cilium/ariane/internal/config"
+)
+
+func Test_workflowStatusRow(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   workflowStatus
+		expected string
+	}{
+		{
+			name:     "triggered workflow without run",
+			status:   workflowStatus{name: "ci.yaml", status: workflowStatusTriggered},
+			expected: "| `ci.yaml` | ✅ Triggered |  |  |  |",
+		},
+		{
+			name: "triggered workflow with run",
+			status: workflowStatus{
+				name:    "ci.yaml",
+				status:  workflowStatusTriggered,
+				trigger: "/test",
+				sender:  "user",
+				runID:   42,
+				runURL:  "https://github.com/owner/repo/actions/runs/42",
+				attempt: 1,
+			},
+			expected: "| [`ci.yaml`](https://github.com/owner/repo/actions/runs/42) <!-- ariane:run:42 --> | ✅ Triggered | #1 | `/test` by @user |  |",
+		},
+		{
+			name: "skipped workflow with reason",
+			status: workflowStatus{
+				name:    "lint.yaml",
+				status:  workflowStatusSkipped,
+				reason:  "no changed file matches paths-regex `(a|b)/`",
+				trigger: "/test",
+			},
+			expected: "| `lint.yaml` | ⏭️ Skipped: no changed file matches paths-regex `(a\\|b)/` |  | `/test` |  |",
+		},
+		{
+			name: "completed run",
+			status: workflowStatus{
+				name:       "ci.yaml",
+				status:     workflowStatusTriggered,
+				runID:      42,
+				attempt:    2,
+				conclusion: "failure",
+				duration:   12*time.Minute + 3*time.Second + 400*time.Millisecond,
+			},
+			expected: "| `ci.yaml` <!-- ariane:run:42 --> | ❌ Failure | #2 |  | 12m3s |",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, workflowStatusRow(tc.status))
+		})
+	}
+}
+
+func TestWorkflowProcessor_TriggerWorkflow(t *testing.T) {
+	testCases := []struct {
+		name          string
+		response      string
+		expectedRunID int64
+	}{
+		{
+			name:          "run details returned by the dispatch",
+			response:      `{"workflow_run_id": 4242, "html_url": "https://github.com/owner/repo/actions/runs/4242"}`,
+			expectedRunID: 4242,
+		},
+		{
+			name: "no run details returned by the dispatch",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /repos/owner/repo/actions/workflows/ci.yaml/dispatches", func(w http.ResponseWriter, r *http.Request) {
+				var event github.CreateWorkflowDispatchEventRequest
+				_ = json.NewDecoder(r.Body).Decode(&event)
+				assert.True(t, event.GetReturnRunDetails())
+				if tc.response == "" {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				_, _ = w.Write([]byte(tc.response))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			mockURL := github.Ptr(server.URL + "/")
+			client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+			if err != nil {
+				t.Fatalf("Failed to create GitHub client: %v", err)
+			}
+
+			processor := WorkflowProcessor{client: client, owner: "owner", repo: "repo", logger: zerolog.Nop()}
+			event := processor.createWorkflowDispatchEvent(1, "main", "sha", "base-sha", nil)
+			assert.NoError(t, processor.triggerWorkflow(context.Background(), "ci.yaml", event))
+			run, ok := processor.dispatches["ci.yaml"]
+			assert.Equal(t, tc.expectedRunID != 0, ok)
+			assert.Equal(t, tc.expectedRunID, run.GetWorkflowRunID())
+		})
+	}
+}
+
+func TestWorkflowRunHandler_ReportRunCompletion(t *testing.T) {
+	oldconfigGetArianeConfigFromRepository := configGetArianeConfigFromRepository
+	defer func() { configGetArianeConfigFromRepository = oldconfigGetArianeConfigFromRepository }()
+	configGetArianeConfigFromRepository = func(client *github.Client, ctx context.Context, owner string, repoName string, ref string) (*config.ArianeConfig, error) {
+		return &config.ArianeConfig{}, nil
+	}
+
+	status := workflowStatus{name: "ci.yaml", status: workflowStatusTriggered, trigger: "/test", sender: "user", runID: 4242, attempt: 1}
+	dispatchedRuns := &DispatchedRunTracker{}
+	dispatchedRuns.add(4242, dispatchedRun{owner: "owner", repo: "repo", prNumber: 7, status: status})
+
+	table := buildWorkflowStatusTable([]workflowStatus{
+		{name: "lint.yaml", status: workflowStatusSkipped},
+		status,
+	})
+
+	var edited string
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]*github.IssueComment{
+			{ID: github.Ptr(int64(1)), Body: github.Ptr("/test"), User: &github.User{Login: github.Ptr("user")}},
+			// a copy of the report by another user is left alone
+			{ID: github.Ptr(int64(3)), Body: github.Ptr(table), User: &github.User{Login: github.Ptr("user")}},
+			{ID: github.Ptr(int64(2)), Body: github.Ptr(table), User: &github.User{Login: github.Ptr("ariane[bot]")}},
+		})
+	})
+	mux.HandleFunc("PATCH /repos/owner/repo/issues/comments/2", func(w http.ResponseWriter, r *http.Request) {
+		var comment github.IssueComment
+		_ = json.NewDecoder(r.Body).Decode(&comment)
+		edited = comment.GetBody()
+		_ = json.NewEncoder(w).Encode(comment)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mockURL := github.Ptr(server.URL + "/")
+	client, err := github.NewClient(github.WithURLs(mockURL, mockURL))
+	if err != nil {
+		t.Fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	mockCtrl := gomock.NewController(t)
+	mockClientCreator := NewMockClientCreator(mockCtrl)
+	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
+
+	handler := &WorkflowRunHandler{
+		Config: Config{
+			ClientCreator:  mockClientCreator,
+			DispatchedRuns: dispatchedRuns,
+			BotLogin:       "ariane[bot]",
+		},
+	}
+
+	payload := []byte(`{
+		"action": "completed",
+		"workflow_run": {
+			"id": 4242,
+			"conclusion": "failure",
+			"run_attempt": 2,
+			"html_url": "https://github.com/owner/repo/actions/runs/4242",
+			"run_started_at": "2024-01-02T03:00:00Z",
+			"updated_at": "2024-01-02T03:12:03Z",
+			"pull_requests": []
+		},
+		"repository": {
+			"owner": {
+				"login": "owner"
+			},
+			"name": "repo"
+		},
+		"installation": {
+			"id": 1
+		}
+	}`)
+
+	err = handler.Handle(context.Background(), "workflow_run", "deliveryID", payload)
+	assert.NoError(t, err)
+	assert.Contains(t, edited, "| `lint.yaml` | ⏭️ Skipped |")
+	assert.Contains(t, edited, "| [`ci.yaml`](https://github.com/owner/repo/actions/runs/4242) <!-- ariane:run:4242 --> | ❌ Failure | #2 | `/test` by @user | 12m3s |")
+	assert.NotContains(t, edited, "✅ Triggered")
+}
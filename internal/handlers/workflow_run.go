@@ -7,9 +7,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"path"
 	"strings"
 
 	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
 	"github.com/cilium/ariane/internal/log"
 	"github.com/google/go-github/v88/github"
 	"github.com/palantir/go-githubapp/githubapp"
@@ -18,7 +20,9 @@ import (
 )
 
 type WorkflowRunHandler struct {
-	githubapp.ClientCreator
+	Config
+	// DailyRerunBudget is the maximum number of automatic reruns per installation and per day, unlimited if 0
+	DailyRerunBudget int
 }
 
 func (*WorkflowRunHandler) Handles() []string {
@@ -31,8 +35,9 @@ func (w *WorkflowRunHandler) Handle(ctx context.Context, eventType, deliveryID s
 		return fmt.Errorf("failed to parse workflow_run event payload: %w", err)
 	}
 
-	// Only handle completed events
-	if action := event.GetAction(); action != "completed" {
+	// Only handle completed events, and the start of runs to update their pending and aggregate check runs
+	action := event.GetAction()
+	if action != "completed" && action != "in_progress" {
 		return nil
 	}
 
@@ -43,13 +48,19 @@ func (w *WorkflowRunHandler) Handle(ctx context.Context, eventType, deliveryID s
 
 	workflowRun := event.GetWorkflowRun()
 	conclusion := workflowRun.GetConclusion()
-	if conclusion == "cancelled" {
+	run, tracked := w.DispatchedRuns.get(workflowRun.GetID())
+	if conclusion == "cancelled" && !tracked && workflowRun.GetEvent() != "workflow_dispatch" {
 		logger.Debug().Msg("Workflow run was cancelled, skipping")
 		return nil
 	}
 
-	// Get the associated pull requests
-	pullRequestsFromWorkflowRun := workflowRun.PullRequests
+	// Only runs dispatched by Ariane or triggered by a pull request may have pending check runs, supersede
+	// skipped check runs or count towards the aggregate check run: the start of other runs is of no interest
+	workflowEvent := workflowRun.GetEvent()
+	checksRun := tracked || isPullRequestEvent(workflowEvent) || workflowEvent == "workflow_dispatch"
+	if action != "completed" && !checksRun {
+		return nil
+	}
 
 	client, err := w.NewInstallationClient(installationID)
 	if err != nil {
@@ -59,6 +70,48 @@ func (w *WorkflowRunHandler) Handle(ctx context.Context, eventType, deliveryID s
 
 	repositoryOwner := repository.GetOwner().GetLogin()
 	repositoryName := repository.GetName()
+	workflow := path.Base(event.GetWorkflow().GetPath())
+
+	// The check runs Ariane maintains are configured from the default branch, so that pull requests cannot change them
+	var defaultConfig *config.ArianeConfig
+	if checksRun {
+		if defaultConfig, err = configGetArianeConfigFromRepository(client, ctx, repositoryOwner, repositoryName, ""); err != nil {
+			logger.Debug().Err(err).Msg("Failed to retrieve Ariane config of the default branch")
+		}
+	}
+
+	// Update the pending check runs of the run, and the workflows report row of runs dispatched by Ariane,
+	// whatever their conclusion. Other runs only have pending check runs if Ariane creates pending or
+	// skipped check runs for their workflow.
+	if tracked || (defaultConfig != nil && hasPendingChecks(defaultConfig, workflow)) {
+		_ = updatePendingChecks(ctx, client, &event, w.DispatchedRuns, logger)
+	}
+	if tracked && action == "completed" && run.status.runID != 0 {
+		_ = NewGithubCommenter(client, run.owner, run.repo, w.BotLogin, logger).reportRunCompletion(ctx, run, workflowRun)
+	}
+
+	// Update the aggregate check run of the pull request head commit if the workflow is one it summarizes.
+	// Runs dispatched for pull requests from forks run on the base branch, so their pull request commit is
+	// the one they were dispatched for.
+	if (tracked || isPullRequestEvent(workflowEvent)) && defaultConfig != nil && requiresWorkflow(defaultConfig, workflow) {
+		sha := workflowRun.GetHeadSHA()
+		if tracked && run.sha != "" {
+			sha = run.sha
+		}
+		_ = updateRequiredCheck(ctx, client, repositoryOwner, repositoryName, sha, defaultConfig, w.FlakeStore, w.DispatchedRuns, logger)
+	}
+
+	if action != "completed" {
+		return nil
+	}
+
+	if conclusion == "cancelled" {
+		logger.Debug().Msg("Workflow run was cancelled, skipping")
+		return nil
+	}
+
+	// Get the associated pull requests
+	pullRequestsFromWorkflowRun := workflowRun.PullRequests
 
 	if len(pullRequestsFromWorkflowRun) == 0 && !workflowRun.GetHeadRepository().GetFork() {
 		logger.Debug().Msg("No pull requests associated with this workflow run")
@@ -159,15 +212,20 @@ func (w *WorkflowRunHandler) Handle(ctx context.Context, eventType, deliveryID s
 		return nil
 	}
 
+	w.recordFlakes(flakes.KindOutcome, event.GetInstallation().GetID(), event.GetWorkflow().GetName(), workflowRun, fullPR, repositoryOwner, repositoryName, workflowRun.GetRunAttempt(), logger, "")
+	w.evaluateQuarantine(ctx, client, event.GetWorkflow().GetName(), fullPR, repositoryOwner, repositoryName, arianeConfig, logger)
+
 	// Handle based on conclusion
 	switch conclusion {
 	case "success":
 		return w.handleSuccessfulRun(ctx, client, &event, workflowRun, fullPR, repositoryOwner, repositoryName, arianeConfig, logger)
-	case "failure":
-		return w.handleFailedRun(ctx, client, &event, workflowRun, repositoryOwner, repositoryName, arianeConfig, logger)
 	default:
-		logger.Debug().Msgf("Workflow run conclusion is '%s', not handling", conclusion)
-		return nil
+		// failures, time outs and startup failures are handled according to their rerun policy
+		if arianeConfig.GetConclusionPolicy(conclusion) == "" {
+			logger.Debug().Msgf("Workflow run conclusion is '%s', not handling", conclusion)
+			return nil
+		}
+		return w.handleFailedRun(ctx, client, &event, workflowRun, fullPR, repositoryOwner, repositoryName, arianeConfig, logger)
 	}
 }
 
@@ -185,51 +243,94 @@ func (w *WorkflowRunHandler) handleSuccessfulRun(
 	prNumber := pullRequest.GetNumber()
 
 	processor := WorkflowProcessor{
-		client:       client,
-		owner:        repositoryOwner,
-		repo:         repositoryName,
-		arianeConfig: arianeConfig,
-		logger:       logger,
+		client:         client,
+		owner:          repositoryOwner,
+		repo:           repositoryName,
+		arianeConfig:   arianeConfig,
+		logger:         logger,
+		baseRef:        pullRequest.GetBase().GetRef(),
+		appID:          w.AppID,
+		dispatchedRuns: w.DispatchedRuns,
+		flakeStore:     w.FlakeStore,
 	}
 
 	return multierr.Combine(
+		w.clearRetriesExhausted(ctx, client, event.GetInstallation().GetID(), event.GetWorkflow().GetName(), workflowRun, pullRequest, repositoryOwner, repositoryName, arianeConfig, logger),
 		processor.processStages(ctx, pullRequest, prNumber, event, workflowRun),
 		processor.processDependantWorkflows(ctx, pullRequest, prNumber, workflowRun),
 	)
 }
 
-// handleFailedRun processes failed workflow runs and reruns failed jobs
+// handleFailedRun processes failed workflow runs (including runs which timed out or failed to start):
+// they are rerun according to the rerun policy of their conclusion if configured, otherwise the
+// run failed for good and is triaged, its failed checks being flagged as known flakes if the workflow
+// is quarantined
 func (w *WorkflowRunHandler) handleFailedRun(
 	ctx context.Context,
 	client *github.Client,
 	event *github.WorkflowRunEvent,
 	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
 	repositoryOwner, repositoryName string,
 	arianeConfig *config.ArianeConfig,
 	logger zerolog.Logger,
 ) error {
+	if w.FlakeStore != nil {
+		jobs, err := listFailedJobs(ctx, client, repositoryOwner, repositoryName, workflowRun.GetID())
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to list workflow jobs for run ID %d", workflowRun.GetID())
+		}
+		for _, job := range jobs {
+			w.recordFlakes(flakes.KindFailure, event.GetInstallation().GetID(), event.GetWorkflow().GetName(), workflowRun, pullRequest, repositoryOwner, repositoryName, workflowRun.GetRunAttempt(), logger, job.GetName())
+		}
+	}
+
+	rerun, err := w.rerunFailedRun(ctx, client, event, workflowRun, pullRequest, repositoryOwner, repositoryName, arianeConfig, logger)
+	if err != nil || rerun {
+		return err
+	}
+	if isQuarantined(w.FlakeStore, repositoryOwner+"/"+repositoryName, event.GetWorkflow().GetName()) {
+		_ = w.flagQuarantinedFailure(ctx, client, event.GetWorkflow().GetName(), workflowRun, pullRequest, repositoryOwner, repositoryName, arianeConfig, logger)
+	}
+	return w.triageFailedRun(ctx, client, event.GetWorkflow().GetName(), workflowRun, pullRequest, repositoryOwner, repositoryName, arianeConfig, logger)
+}
+
+// rerunFailedRun reruns a failed workflow run according to the rerun policy of its conclusion, if
+// allowed by the rerun configuration and, when rerunning failed jobs, if they match known flakes when
+// configured. It returns whether the run was (or is scheduled to be) rerun.
+func (w *WorkflowRunHandler) rerunFailedRun(
+	ctx context.Context,
+	client *github.Client,
+	event *github.WorkflowRunEvent,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	logger zerolog.Logger,
+) (bool, error) {
 	runID := workflowRun.GetID()
 	workflowName := event.GetWorkflow().GetName()
 	workflowPath := event.GetWorkflow().GetPath()
 	pullRequests := workflowRun.PullRequests
 
-	logger.Info().Msgf("Workflow '%s' (run ID: %d) failed, checking if rerun is needed", workflowName, runID)
+	conclusion := workflowRun.GetConclusion()
+	logger.Info().Msgf("Workflow '%s' (run ID: %d) concluded with %s, checking if rerun is needed", workflowName, runID, conclusion)
 
 	// Get the first PR to check configuration
 	if len(pullRequests) == 0 {
 		logger.Debug().Msg("No pull requests associated with this workflow run")
-		return nil
+		return false, nil
 	}
 
 	if arianeConfig.RerunConfig == nil {
 		logger.Debug().Msgf("No rerun configuration found, skipping workflow '%s' rerun", workflowPath)
-		return nil
+		return false, nil
 	} else {
 		// Check if this workflow is in the exclude list
 		for _, excludedWorkflow := range arianeConfig.RerunConfig.ExcludeWorkflows {
 			if strings.Contains(workflowPath, excludedWorkflow) {
 				logger.Debug().Msgf("Workflow '%s' is in the exclude list, skipping rerun", workflowPath)
-				return nil
+				return false, nil
 			}
 		}
 
@@ -246,7 +347,7 @@ func (w *WorkflowRunHandler) handleFailedRun(
 
 			if !workflowAllowed {
 				logger.Debug().Msgf("Workflow '%s' is not in the rerun allowed list, skipping", workflowPath)
-				return nil
+				return false, nil
 			}
 
 			logger.Debug().Msgf("Workflow '%s' is in the rerun allowed list", workflowPath)
@@ -255,6 +356,12 @@ func (w *WorkflowRunHandler) handleFailedRun(
 		}
 	}
 
+	policy := arianeConfig.GetConclusionPolicy(conclusion)
+	if policy == config.RerunPolicyReport {
+		logger.Debug().Msgf("Rerun policy for conclusion '%s' is to report only, skipping rerun", conclusion)
+		return false, nil
+	}
+
 	maxRetries := 0
 	if arianeConfig != nil && arianeConfig.RerunConfig != nil {
 		maxRetries = arianeConfig.RerunConfig.MaxRetries
@@ -264,7 +371,7 @@ func (w *WorkflowRunHandler) handleFailedRun(
 	run, _, err := client.Actions.GetWorkflowRunByID(ctx, repositoryOwner, repositoryName, runID)
 	if err != nil {
 		logger.Error().Err(err).Msgf("Failed to get workflow run %d", runID)
-		return err
+		return false, err
 	}
 
 	runAttempt := run.GetRunAttempt()
@@ -272,17 +379,160 @@ func (w *WorkflowRunHandler) handleFailedRun(
 
 	if runAttempt > maxRetries {
 		logger.Info().Msgf("Workflow run %d has reached max retries (%d/%d), not rerunning", runID, runAttempt-1, maxRetries)
-		return nil
+		if maxRetries > 0 {
+			_ = w.reportRetriesExhausted(ctx, client, event.GetInstallation().GetID(), workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, arianeConfig, runAttempt, logger)
+		}
+		return false, nil
 	}
 
 	logger.Info().Msgf("Proceeding with rerun (attempt %d/%d)", runAttempt, maxRetries)
 
-	// Check if there are any failed jobs that can be rerun
-	if err := rerunFailedJobs(ctx, client, repositoryOwner, repositoryName, runID, workflowName, logger); err != nil {
-		logger.Error().Err(err).Msgf("Failed to rerun failed jobs for workflow '%s'", workflowName)
-		return err
+	// Only retry failures of the selected jobs and steps, and matching known flakes when they are
+	// configured, real failures are reported right away
+	var matchedFlakes []config.MatchedFlake
+	filter := newJobFilter(arianeConfig.RerunConfig, logger)
+	if (filter != nil || len(arianeConfig.KnownFlakes) > 0) && policy == config.RerunPolicyFailedJobs {
+		jobs, err := listFailedJobs(ctx, client, repositoryOwner, repositoryName, runID)
+		if err != nil {
+			logger.Error().Err(err).Msgf("Failed to list workflow jobs for run ID %d", runID)
+			return false, err
+		}
+		if len(jobs) == 0 {
+			logger.Debug().Msgf("No failed jobs found for workflow '%s' (run ID: %d)", workflowName, runID)
+			return false, nil
+		}
+		if filter != nil {
+			for _, job := range jobs {
+				if ok, reason := filter.eligible(job); !ok {
+					logger.Info().Msgf("Workflow '%s' (run ID: %d) failed in jobs not selected for rerun (%s), not rerunning", workflowName, runID, reason)
+					return false, nil
+				}
+			}
+		}
+		if len(arianeConfig.KnownFlakes) > 0 {
+			var allMatched bool
+			matchedFlakes, allMatched = matchKnownFlakes(ctx, client, repositoryOwner, repositoryName, jobs, compileKnownFlakes(arianeConfig.KnownFlakes, logger), logger)
+			if !allMatched {
+				logger.Info().Msgf("Workflow '%s' (run ID: %d) failed without matching known flakes, not rerunning", workflowName, runID)
+				return false, nil
+			}
+		}
 	}
 
+	installationID := event.GetInstallation().GetID()
+	if !w.reserveRerun(ctx, client, installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, arianeConfig, runAttempt, logger) {
+		return false, nil
+	}
+
+	var rerun bool
+	if delay := arianeConfig.GetRerunDelay(runAttempt); delay > 0 && w.Scheduler != nil {
+		rerun, err = w.scheduleRerun(installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, runAttempt, policy, matchedFlakes, delay, logger)
+	} else {
+		if delay > 0 {
+			logger.Warn().Msgf("No scheduler configured, rerunning workflow '%s' right away instead of in %s", workflowName, delay)
+		}
+		rerun, err = w.rerun(ctx, client, installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, arianeConfig, runAttempt, policy, matchedFlakes, logger)
+	}
+	if !rerun {
+		w.recordFlakes(flakes.KindCancelledRerun, installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, runAttempt, logger, "")
+	}
+	return rerun, err
+}
+
+// rerun reruns the given attempt of a workflow run according to policy (its failed jobs by default),
+// and reports the known flakes they matched, if any. It returns whether the run was rerun, the rerun
+// being reserved in the rerun budgets beforehand.
+func (w *WorkflowRunHandler) rerun(
+	ctx context.Context,
+	client *github.Client,
+	installationID int64,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	arianeConfig *config.ArianeConfig,
+	runAttempt int,
+	policy string,
+	matchedFlakes []config.MatchedFlake,
+	logger zerolog.Logger,
+) (bool, error) {
+	var rerun bool
+	var err error
+	if policy == config.RerunPolicyAll {
+		rerun, err = rerunWorkflow(ctx, client, repositoryOwner, repositoryName, workflowRun.GetID(), workflowName, logger)
+	} else {
+		// Check if there are any failed jobs that can be rerun
+		rerun, err = rerunFailedJobs(ctx, client, repositoryOwner, repositoryName, workflowRun.GetID(), workflowName, logger)
+	}
+	if err != nil {
+		logger.Error().Err(err).Msgf("Failed to rerun failed jobs for workflow '%s'", workflowName)
+		return false, err
+	}
+	if !rerun {
+		return false, nil
+	}
 	logger.Info().Msgf("Successfully triggered rerun for workflow '%s'", workflowName)
-	return nil
+
+	if len(matchedFlakes) > 0 {
+		data := config.FeedbackData{
+			Workflow: workflowName,
+			Retry:    buildRetrySummary(workflowName, workflowRun, runAttempt+1, matchedFlakes),
+			Flakes:   matchedFlakes,
+		}
+		comment := feedbackMessage(arianeConfig, config.TemplateFlakeRetry, data, logger)
+		_ = NewGithubCommenter(client, repositoryOwner, repositoryName, w.BotLogin, logger).report(ctx, arianeConfig, pullRequest.GetNumber(), config.TemplateFlakeRetry, workflowName, comment)
+	}
+	return true, nil
+}
+
+// recordFlakes adds an event of a workflow run (of the given job, for failures) to the flakiness
+// history, if recorded
+func (w *WorkflowRunHandler) recordFlakes(
+	kind string,
+	installationID int64,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	attempt int,
+	logger zerolog.Logger,
+	job string,
+) {
+	if w.FlakeStore == nil {
+		return
+	}
+	record := w.newFlakeRecord(kind, installationID, workflowName, workflowRun, pullRequest, repositoryOwner, repositoryName, attempt, job)
+	if err := w.FlakeStore.Add(record); err != nil {
+		logger.Error().Err(err).Msgf("Failed to record %s of workflow run %d in flakiness history", kind, workflowRun.GetID())
+	}
+}
+
+// newFlakeRecord returns the record of an event of a workflow run in the flakiness history. The record is
+// keyed on the pull request commit the run ran for, so that reruns of runs dispatched for pull requests
+// from forks count against the budget of their pull request rather than of the base branch.
+func (w *WorkflowRunHandler) newFlakeRecord(
+	kind string,
+	installationID int64,
+	workflowName string,
+	workflowRun *github.WorkflowRun,
+	pullRequest *github.PullRequest,
+	repositoryOwner, repositoryName string,
+	attempt int,
+	job string,
+) flakes.Record {
+	record := flakes.Record{
+		Kind:         kind,
+		Repository:   repositoryOwner + "/" + repositoryName,
+		Workflow:     workflowName,
+		Job:          job,
+		SHA:          w.DispatchedRuns.pullRequestCommit(workflowRun),
+		PR:           pullRequest.GetNumber(),
+		RunID:        workflowRun.GetID(),
+		Attempt:      attempt,
+		Installation: installationID,
+	}
+	if kind == flakes.KindOutcome {
+		record.Conclusion = workflowRun.GetConclusion()
+	}
+	return record
 }
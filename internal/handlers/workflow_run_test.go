@@ -77,7 +77,9 @@ func TestWorkflowRunHandler_NoPullRequests(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -117,7 +119,9 @@ func TestWorkflowRunHandler_NoPullRequestsFromFork(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -194,7 +198,9 @@ func TestWorkflowRunHandler_UnauthorizedPRCreator(t *testing.T) {
 			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 			handler := &WorkflowRunHandler{
-				ClientCreator: mockClientCreator,
+				Config: Config{
+					ClientCreator: mockClientCreator,
+				},
 			}
 
 			payload := []byte(`{
@@ -281,7 +287,9 @@ triggers:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -368,7 +376,9 @@ stages-config:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -473,7 +483,9 @@ stages-config:
 	})
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -592,7 +604,9 @@ stages-config:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -712,7 +726,9 @@ stages-config:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -857,7 +873,9 @@ triggers:
 			mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 			handler := &WorkflowRunHandler{
-				ClientCreator: mockClientCreator,
+				Config: Config{
+					ClientCreator: mockClientCreator,
+				},
 			}
 
 			payload := []byte(`{
@@ -953,7 +971,9 @@ func TestWorkflowRunHandler_Failure_MaxRetriesReached(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1060,7 +1080,9 @@ func TestWorkflowRunHandler_Failure_NoFailedJobs(t *testing.T) {
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1148,7 +1170,9 @@ rerun:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1262,7 +1286,9 @@ rerun:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1356,7 +1382,9 @@ rerun:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1468,7 +1496,9 @@ rerun:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1556,7 +1586,9 @@ rerun:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1646,7 +1678,9 @@ rerun:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
@@ -1759,7 +1793,9 @@ rerun:
 	mockClientCreator.EXPECT().NewInstallationClient(int64(1)).Return(client, nil)
 
 	handler := &WorkflowRunHandler{
-		ClientCreator: mockClientCreator,
+		Config: Config{
+			ClientCreator: mockClientCreator,
+		},
 	}
 
 	payload := []byte(`{
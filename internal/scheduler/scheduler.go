@@ -0,0 +1,275 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+// Package scheduler runs tasks once they are due. Pending tasks are persisted to a file, so that they
+// survive a restart, and wait in a single goroutine instead of each pinning one. Due tasks run
+// concurrently, within a timeout, and failed tasks are retried a bounded number of times.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/cilium/ariane/internal/atomicfile"
+)
+
+const (
+	// DefaultMaxAttempts is the number of times a task is run before giving up on it
+	DefaultMaxAttempts = 3
+	// DefaultHandlerTimeout is how long a handler may run a task before its context is cancelled, long
+	// enough for tasks waiting for workflow jobs to complete
+	DefaultHandlerTimeout = 30 * time.Minute
+	// DefaultRetryDelay is the delay before retrying a failed task, multiplied by its failed attempts
+	DefaultRetryDelay = time.Minute
+)
+
+// Task is a unit of work to run once due, by the handler registered for its kind
+type Task struct {
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	Due     time.Time       `json:"due"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempts is the number of failed attempts to run the task
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// HandlerFunc runs a due task, given its payload
+type HandlerFunc func(ctx context.Context, payload json.RawMessage) error
+
+// DropFunc is called with the payload of a task given up on after failing DefaultMaxAttempts times, and
+// the error of its last attempt, so that what the task holds can be released
+type DropFunc func(ctx context.Context, payload json.RawMessage, err error)
+
+// Scheduler keeps pending tasks, sorted by due time, and runs them once due
+type Scheduler struct {
+	mu       sync.Mutex
+	path     string
+	tasks    []Task
+	handlers map[string]HandlerFunc
+	drops    map[string]DropFunc
+	// running are the IDs of the tasks being run
+	running map[string]bool
+	lastID  int64
+	wake    chan struct{}
+	logger  zerolog.Logger
+
+	maxAttempts    int
+	handlerTimeout time.Duration
+	retryDelay     time.Duration
+}
+
+// Open loads the pending tasks persisted at path, and returns a scheduler persisting them there. If
+// path is empty, tasks are only kept in memory and lost on restart.
+func Open(path string, logger zerolog.Logger) (*Scheduler, error) {
+	s := &Scheduler{
+		path:     path,
+		handlers: make(map[string]HandlerFunc),
+		drops:    make(map[string]DropFunc),
+		running:  make(map[string]bool),
+		wake:     make(chan struct{}, 1),
+		logger:   logger,
+
+		maxAttempts:    DefaultMaxAttempts,
+		handlerTimeout: DefaultHandlerTimeout,
+		retryDelay:     DefaultRetryDelay,
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("failed reading scheduler store: %w", err)
+	case len(data) > 0:
+		if err := json.Unmarshal(data, &s.tasks); err != nil {
+			return nil, fmt.Errorf("failed parsing scheduler store: %w", err)
+		}
+	}
+	sort.SliceStable(s.tasks, func(i, j int) bool { return s.tasks[i].Due.Before(s.tasks[j].Due) })
+	return s, nil
+}
+
+// Register sets the handler running the tasks of the given kind. Handlers must be registered before
+// running the scheduler.
+func (s *Scheduler) Register(kind string, handler HandlerFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[kind] = handler
+}
+
+// RegisterDrop sets the function called when a task of the given kind is dropped after running out of
+// attempts. Drop functions must be registered before running the scheduler.
+func (s *Scheduler) RegisterDrop(kind string, drop DropFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drops[kind] = drop
+}
+
+// Schedule adds a task of the given kind, due at the given time, whose payload is the JSON encoding of payload
+func (s *Scheduler) Schedule(kind string, due time.Time, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed encoding %s task: %w", kind, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := time.Now().UnixNano()
+	if id <= s.lastID {
+		id = s.lastID + 1
+	}
+	s.lastID = id
+	task := Task{ID: strconv.FormatInt(id, 36), Kind: kind, Due: due, Payload: data}
+	i := sort.Search(len(s.tasks), func(i int) bool { return s.tasks[i].Due.After(due) })
+	s.tasks = append(s.tasks[:i], append([]Task{task}, s.tasks[i:]...)...)
+	if err := s.persist(); err != nil {
+		s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+		return err
+	}
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the pending tasks, sorted by due time
+func (s *Scheduler) Pending() []Task {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Task(nil), s.tasks...)
+}
+
+// Run runs the tasks once due, until ctx is done. A task is only removed from the store once it ran,
+// so that tasks interrupted by a restart run again. Tasks whose handler fails, or does not complete
+// within the handler timeout, are retried later until they ran DefaultMaxAttempts times, then dropped.
+func (s *Scheduler) Run(ctx context.Context) {
+	ctx = s.logger.WithContext(ctx)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		s.startDue(ctx)
+
+		timer.Stop()
+		if next, ok := s.next(); ok {
+			timer.Reset(time.Until(next))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// next returns when the next task which is not running is due, if any
+func (s *Scheduler) next() (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, task := range s.tasks {
+		if !s.running[task.ID] {
+			return task.Due, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// startDue starts running the due tasks which are not running yet, each in its own goroutine
+func (s *Scheduler) startDue(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for _, task := range s.tasks {
+		if task.Due.After(now) {
+			break
+		}
+		if s.running[task.ID] {
+			continue
+		}
+		s.running[task.ID] = true
+		go s.run(ctx, task, s.handlers[task.Kind])
+	}
+}
+
+// run runs a due task, then removes it from the store, or reschedules it if it failed
+func (s *Scheduler) run(ctx context.Context, task Task, handler HandlerFunc) {
+	var err error
+	if handler == nil {
+		s.logger.Error().Msgf("No handler registered for %s task %s, dropping it", task.Kind, task.ID)
+	} else {
+		handlerCtx, cancel := context.WithTimeout(ctx, s.handlerTimeout)
+		err = handler(handlerCtx, task.Payload)
+		cancel()
+	}
+
+	if drop := s.complete(task, err); drop != nil {
+		drop(ctx, task.Payload, err)
+	}
+}
+
+// complete removes a task which ran from the store, or reschedules it if it failed and has attempts
+// left. It returns the drop function of the task if it was dropped after running out of attempts.
+func (s *Scheduler) complete(task Task, err error) DropFunc {
+	var drop DropFunc
+	s.mu.Lock()
+	defer func() {
+		s.mu.Unlock()
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}()
+	delete(s.running, task.ID)
+	for i := range s.tasks {
+		if s.tasks[i].ID == task.ID {
+			s.tasks = append(s.tasks[:i], s.tasks[i+1:]...)
+			break
+		}
+	}
+	if err != nil {
+		task.Attempts++
+		if task.Attempts < s.maxAttempts {
+			task.Due = time.Now().Add(time.Duration(task.Attempts) * s.retryDelay)
+			i := sort.Search(len(s.tasks), func(i int) bool { return s.tasks[i].Due.After(task.Due) })
+			s.tasks = append(s.tasks[:i], append([]Task{task}, s.tasks[i:]...)...)
+			s.logger.Warn().Err(err).Msgf("Failed to run %s task %s (attempt %d/%d), retrying at %s", task.Kind, task.ID, task.Attempts, s.maxAttempts, task.Due.Format(time.RFC3339))
+		} else {
+			s.logger.Error().Err(err).Msgf("Failed to run %s task %s (attempt %d/%d), dropping it", task.Kind, task.ID, task.Attempts, s.maxAttempts)
+			drop = s.drops[task.Kind]
+		}
+	}
+	if err := s.persist(); err != nil {
+		s.logger.Error().Err(err).Msgf("Failed to update the scheduler store after running %s task %s", task.Kind, task.ID)
+	}
+	return drop
+}
+
+// persist rewrites the store with the pending tasks. It must be called with s.mu held.
+func (s *Scheduler) persist() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.tasks)
+	if err != nil {
+		return fmt.Errorf("failed encoding scheduler store: %w", err)
+	}
+	if err := atomicfile.Write(s.path, data); err != nil {
+		return fmt.Errorf("failed writing scheduler store: %w", err)
+	}
+	return nil
+}
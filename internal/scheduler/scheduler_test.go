@@ -0,0 +1,179 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Cilium
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	now := time.Now()
+
+	s, err := Open(path, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Failed to open scheduler: %v", err)
+	}
+	assert.NoError(t, s.Schedule("rerun", now.Add(time.Hour), map[string]int{"run": 2}))
+	assert.NoError(t, s.Schedule("rerun", now.Add(time.Minute), map[string]int{"run": 1}))
+
+	// the tasks survive a restart, sorted by due time
+	s, err = Open(path, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Failed to open scheduler: %v", err)
+	}
+	pending := s.Pending()
+	if assert.Len(t, pending, 2) {
+		assert.JSONEq(t, `{"run":1}`, string(pending[0].Payload))
+		assert.JSONEq(t, `{"run":2}`, string(pending[1].Payload))
+		assert.NotEqual(t, pending[0].ID, pending[1].ID)
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scheduler.json")
+	s, err := Open(path, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Failed to open scheduler: %v", err)
+	}
+
+	ran := make(chan int, 3)
+	s.Register("rerun", func(ctx context.Context, payload json.RawMessage) error {
+		var run int
+		assert.NoError(t, json.Unmarshal(payload, &run))
+		ran <- run
+		return nil
+	})
+
+	now := time.Now()
+	assert.NoError(t, s.Schedule("rerun", now.Add(-time.Minute), 1))
+	assert.NoError(t, s.Schedule("unknown", now.Add(-time.Minute), 0))
+	assert.NoError(t, s.Schedule("rerun", now.Add(time.Hour), 3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	select {
+	case run := <-ran:
+		assert.Equal(t, 1, run)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Due task did not run")
+	}
+
+	// tasks scheduled while running wake the scheduler up
+	assert.NoError(t, s.Schedule("rerun", time.Now().Add(50*time.Millisecond), 2))
+	select {
+	case run := <-ran:
+		assert.Equal(t, 2, run)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task scheduled while running did not run")
+	}
+
+	assert.Eventually(t, func() bool { return len(s.Pending()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	reopened, err := Open(path, zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Failed to open scheduler: %v", err)
+	}
+	if pending := reopened.Pending(); assert.Len(t, pending, 1) {
+		assert.JSONEq(t, "3", string(pending[0].Payload))
+	}
+}
+
+func TestScheduler_Retry(t *testing.T) {
+	s, err := Open(filepath.Join(t.TempDir(), "scheduler.json"), zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Failed to open scheduler: %v", err)
+	}
+	s.retryDelay = 10 * time.Millisecond
+	s.handlerTimeout = 50 * time.Millisecond
+
+	attempts := make(chan int, 2*DefaultMaxAttempts)
+	flaky := 0
+	s.Register("flaky", func(ctx context.Context, payload json.RawMessage) error {
+		attempts <- 1
+		if flaky++; flaky < 2 {
+			return errors.New("transient failure")
+		}
+		return nil
+	})
+	s.Register("stuck", func(ctx context.Context, payload json.RawMessage) error {
+		attempts <- 2
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	dropped := make(chan string, 2)
+	dropFunc := func(ctx context.Context, payload json.RawMessage, err error) {
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		var name string
+		assert.NoError(t, json.Unmarshal(payload, &name))
+		dropped <- name
+	}
+	s.RegisterDrop("flaky", dropFunc)
+	s.RegisterDrop("stuck", dropFunc)
+
+	assert.NoError(t, s.Schedule("flaky", time.Now(), "flaky"))
+	assert.NoError(t, s.Schedule("stuck", time.Now().Add(100*time.Millisecond), "stuck"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// the failed task is retried until it succeeds, and the stuck one until it ran out of attempts
+	assert.Eventually(t, func() bool { return len(s.Pending()) == 0 && len(attempts) == 2+DefaultMaxAttempts }, 5*time.Second, 10*time.Millisecond)
+	counts := make(map[int]int)
+	for len(attempts) > 0 {
+		counts[<-attempts]++
+	}
+	assert.Equal(t, map[int]int{1: 2, 2: DefaultMaxAttempts}, counts)
+
+	// only the task which ran out of attempts is dropped
+	assert.Eventually(t, func() bool { return len(dropped) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "stuck", <-dropped)
+}
+
+func TestScheduler_Concurrency(t *testing.T) {
+	s, err := Open("", zerolog.Nop())
+	if err != nil {
+		t.Fatalf("Failed to open scheduler: %v", err)
+	}
+
+	release := make(chan struct{})
+	ran := make(chan string, 2)
+	s.Register("slow", func(ctx context.Context, payload json.RawMessage) error {
+		<-release
+		ran <- "slow"
+		return nil
+	})
+	s.Register("fast", func(ctx context.Context, payload json.RawMessage) error {
+		ran <- "fast"
+		return nil
+	})
+
+	now := time.Now()
+	assert.NoError(t, s.Schedule("slow", now.Add(-time.Minute), nil))
+	assert.NoError(t, s.Schedule("fast", now.Add(50*time.Millisecond), nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	// a task which takes long does not hold back the others
+	select {
+	case name := <-ran:
+		assert.Equal(t, "fast", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Due task did not run while another one was running")
+	}
+	close(release)
+	assert.Eventually(t, func() bool { return len(s.Pending()) == 0 }, 5*time.Second, 10*time.Millisecond)
+}
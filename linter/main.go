@@ -7,10 +7,13 @@ import (
 	"fmt"
 	"os"
 	"regexp"
+	"slices"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
 	"github.com/hmdsefi/gograph"
 )
 
@@ -79,8 +82,14 @@ func parseAndValidate(path string) (*config.ArianeConfig, error) {
 		"allowed-teams":      true,
 		"rerun":              true,
 		"stages-config":      true,
+		"reviews":            true,
+		"triage":             true,
+		"known-flakes":       true,
+		"quarantine":         true,
 		"schedule":           true,
 		"replace-depends-on": true,
+		"pre-rerun-jobs":     true,
+		"checks":             true,
 	}
 	for key := range raw {
 		if !knownTopLevel[key] {
@@ -145,6 +154,41 @@ func validateConfig(cfg *config.ArianeConfig) []error {
 		if wfCfg.PathsRegex != "" && wfCfg.PathsIgnoreRegex != "" {
 			errs = append(errs, fmt.Errorf("workflow %q defines both paths-regex and paths-ignore-regex, which is unsupported", workflow))
 		}
+		if len(wfCfg.SkippedChecks) > 0 && wfCfg.SkippedChecksFromJobs {
+			errs = append(errs, fmt.Errorf("workflow %q defines both skipped-checks and skipped-checks-from-jobs, which is unsupported", workflow))
+		}
+	}
+
+	// Validate pre-rerun jobs
+	for workflow, jobs := range cfg.PreRerunJobs {
+		for i, job := range jobs {
+			if job.Job == "" {
+				errs = append(errs, fmt.Errorf("pre-rerun-jobs %q [%d] has no job", workflow, i))
+			} else if _, err := regexp.Compile(job.Job); err != nil {
+				errs = append(errs, fmt.Errorf("pre-rerun-jobs %q [%d] has invalid job %q: %v", workflow, i, job.Job, err))
+			}
+			if job.Delay < 0 || job.Timeout < 0 {
+				errs = append(errs, fmt.Errorf("pre-rerun-jobs %q [%d] delay and timeout must be non-negative", workflow, i))
+			}
+			if job.WaitForCompletion && job.Delay > 0 {
+				errs = append(errs, fmt.Errorf("pre-rerun-jobs %q [%d] waits for completion, its delay is ignored", workflow, i))
+			}
+		}
+	}
+
+	// Validate skipped checks
+	if cfg.ChecksConfig != nil && cfg.ChecksConfig.Skipped != "" && cfg.ChecksConfig.Skipped != config.SkippedChecksRequired && cfg.ChecksConfig.Skipped != config.SkippedChecksAll {
+		errs = append(errs, fmt.Errorf("checks skipped must be %q or %q, got %q", config.SkippedChecksRequired, config.SkippedChecksAll, cfg.ChecksConfig.Skipped))
+	}
+
+	// Validate merge group checks
+	if cfg.ChecksConfig != nil && cfg.ChecksConfig.MergeGroup != "" && cfg.ChecksConfig.MergeGroup != config.MergeGroupChecksSuccess && cfg.ChecksConfig.MergeGroup != config.MergeGroupChecksPaths {
+		errs = append(errs, fmt.Errorf("checks merge-group must be %q or %q, got %q", config.MergeGroupChecksSuccess, config.MergeGroupChecksPaths, cfg.ChecksConfig.MergeGroup))
+	}
+
+	// Validate aggregate check
+	if cfg.ChecksConfig != nil && cfg.ChecksConfig.Required != nil && len(cfg.ChecksConfig.Required.Workflows) == 0 {
+		errs = append(errs, fmt.Errorf("checks required has no workflows"))
 	}
 
 	// Validate rerun config
@@ -152,6 +196,77 @@ func validateConfig(cfg *config.ArianeConfig) []error {
 		if cfg.RerunConfig.MaxRetries < 0 {
 			errs = append(errs, fmt.Errorf("rerun max-retries must be non-negative, got %d", cfg.RerunConfig.MaxRetries))
 		}
+		if cfg.RerunConfig.Delay < 0 {
+			errs = append(errs, fmt.Errorf("rerun delay must be non-negative, got %s", cfg.RerunConfig.Delay))
+		}
+		if cfg.RerunConfig.BackoffFactor != 0 && cfg.RerunConfig.BackoffFactor < 1 {
+			errs = append(errs, fmt.Errorf("rerun backoff-factor must be at least 1, got %v", cfg.RerunConfig.BackoffFactor))
+		}
+		if cfg.RerunConfig.MaxDelay < 0 {
+			errs = append(errs, fmt.Errorf("rerun max-delay must be non-negative, got %s", cfg.RerunConfig.MaxDelay))
+		}
+		if cfg.RerunConfig.PRBudget < 0 {
+			errs = append(errs, fmt.Errorf("rerun pr-budget must be non-negative, got %d", cfg.RerunConfig.PRBudget))
+		}
+		for field, patterns := range map[string][]string{
+			"jobs":          cfg.RerunConfig.Jobs,
+			"exclude-jobs":  cfg.RerunConfig.ExcludeJobs,
+			"steps":         cfg.RerunConfig.Steps,
+			"exclude-steps": cfg.RerunConfig.ExcludeSteps,
+		} {
+			for _, pattern := range patterns {
+				if _, err := regexp.Compile(pattern); err != nil {
+					errs = append(errs, fmt.Errorf("rerun %s pattern %q is not a valid regex: %v", field, pattern, err))
+				}
+			}
+		}
+		for conclusion, policy := range cfg.RerunConfig.Conclusions {
+			if _, ok := config.DefaultConclusionPolicies[conclusion]; !ok {
+				errs = append(errs, fmt.Errorf("rerun conclusion %q is not a handled workflow run conclusion", conclusion))
+				continue
+			}
+			if !slices.Contains(config.ValidRerunPolicies, policy) {
+				errs = append(errs, fmt.Errorf("rerun policy %q for %q is not one of %s", policy, conclusion, strings.Join(config.ValidRerunPolicies, ", ")))
+			}
+		}
+	}
+
+	// Validate triage config
+	if cfg.TriageConfig != nil {
+		if cfg.TriageConfig.LogLines < 0 {
+			errs = append(errs, fmt.Errorf("triage log-lines must be non-negative, got %d", cfg.TriageConfig.LogLines))
+		}
+		if cfg.TriageConfig.MaxJobs < 0 {
+			errs = append(errs, fmt.Errorf("triage max-jobs must be non-negative, got %d", cfg.TriageConfig.MaxJobs))
+		}
+		for _, pattern := range cfg.TriageConfig.ErrorPatterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("triage error pattern %q is not a valid regex: %v", pattern, err))
+			}
+		}
+	}
+
+	// Validate known flakes
+	for i, flake := range cfg.KnownFlakes {
+		if flake.Name == "" {
+			errs = append(errs, fmt.Errorf("known-flakes[%d] has no name", i))
+		}
+		if _, err := regexp.Compile(flake.Pattern); err != nil || flake.Pattern == "" {
+			errs = append(errs, fmt.Errorf("known flake %q has an invalid pattern %q", flake.Name, flake.Pattern))
+		}
+	}
+
+	// Validate quarantine config
+	if cfg.QuarantineConfig != nil {
+		if cfg.QuarantineConfig.FlakeRate <= 0 || cfg.QuarantineConfig.FlakeRate > 1 {
+			errs = append(errs, fmt.Errorf("quarantine flake-rate must be between 0 (excluded) and 1, got %v", cfg.QuarantineConfig.FlakeRate))
+		}
+		if cfg.QuarantineConfig.MinRuns < 0 {
+			errs = append(errs, fmt.Errorf("quarantine min-runs must be non-negative, got %d", cfg.QuarantineConfig.MinRuns))
+		}
+		if _, err := flakes.ParsePeriod(cfg.GetQuarantinePeriod()); err != nil {
+			errs = append(errs, fmt.Errorf("quarantine period is invalid: %v", err))
+		}
 	}
 
 	// Validate stages config
@@ -166,5 +281,29 @@ func validateConfig(cfg *config.ArianeConfig) []error {
 		}
 	}
 
+	// Validate feedback templates and reactions
+	errs = append(errs, cfg.ValidateFeedback()...)
+
+	// Validate reviews config
+	if cfg.ReviewsConfig != nil && cfg.ReviewsConfig.OnApproval != "" {
+		if !matchesTrigger(cfg, cfg.ReviewsConfig.OnApproval) {
+			errs = append(errs, fmt.Errorf("reviews on-approval %q does not match any trigger", cfg.ReviewsConfig.OnApproval))
+		}
+	}
+
 	return errs
 }
+
+// matchesTrigger returns true if the given command matches any trigger of the configuration
+func matchesTrigger(cfg *config.ArianeConfig, command string) bool {
+	for trigger := range cfg.Triggers {
+		re, err := regexp.Compile(`^` + trigger + `$`)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(command) {
+			return true
+		}
+	}
+	return false
+}
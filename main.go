@@ -15,11 +15,14 @@ import (
 	"github.com/rs/zerolog"
 
 	"github.com/cilium/ariane/internal/config"
+	"github.com/cilium/ariane/internal/flakes"
 	"github.com/cilium/ariane/internal/handlers"
+	"github.com/cilium/ariane/internal/scheduler"
 )
 
 const (
 	DefaultHealthRoute = "/healthz"
+	DefaultFlakesRoute = "/flakes"
 	DefaultRoute       = "/"
 )
 
@@ -49,18 +52,52 @@ func main() {
 		panic(err)
 	}
 
-	prCommentHandler := &handlers.PRCommentHandler{
-		ClientCreator:    cc,
-		RunDelay:         serverConfig.Client.RunDelay,
-		MaxRetryAttempts: serverConfig.Client.MaxRetryAttempts,
+	// Ariane only edits and minimizes the comments of the bot user of its app
+	botLogin, err := appBotLogin(cc)
+	if err != nil {
+		panic(err)
+	}
+
+	flakeStore, err := flakes.Open(serverConfig.Flakes.StorePath)
+	if err != nil {
+		panic(err)
+	}
+	defer flakeStore.Close()
+
+	taskScheduler, err := scheduler.Open(serverConfig.Scheduler.StorePath, logger)
+	if err != nil {
+		panic(err)
+	}
+
+	dispatchedRuns, err := handlers.OpenDispatchedRuns(serverConfig.Dispatch.StorePath)
+	if err != nil {
+		panic(err)
 	}
-	mergeGroupHandler := &handlers.MergeGroupHandler{ClientCreator: cc}
-	workflowRunHandler := &handlers.WorkflowRunHandler{ClientCreator: cc}
-	pullRequestHandler := &handlers.PullRequestHandler{
+
+	handlerConfig := handlers.Config{
 		ClientCreator:    cc,
 		RunDelay:         serverConfig.Client.RunDelay,
 		MaxRetryAttempts: serverConfig.Client.MaxRetryAttempts,
+		FlakeStore:       flakeStore,
+		Scheduler:        taskScheduler,
+		DispatchedRuns:   dispatchedRuns,
+		AppID:            serverConfig.Github.App.IntegrationID,
+		BotLogin:         botLogin,
 	}
+	prCommentHandler := &handlers.PRCommentHandler{Config: handlerConfig}
+	mergeGroupHandler := &handlers.MergeGroupHandler{
+		ClientCreator: cc,
+		AppID:         serverConfig.Github.App.IntegrationID,
+	}
+	workflowRunHandler := &handlers.WorkflowRunHandler{
+		Config:           handlerConfig,
+		DailyRerunBudget: serverConfig.Reruns.DailyBudget,
+	}
+	workflowRunHandler.RegisterTasks()
+	go taskScheduler.Run(context.Background())
+	pullRequestHandler := &handlers.PullRequestHandler{Config: handlerConfig}
+	prReviewHandler := &handlers.PRReviewHandler{Config: handlerConfig}
+	prReviewCommentHandler := &handlers.PRReviewCommentHandler{Config: handlerConfig}
 
 	// Use AsyncScheduler to process webhooks asynchronously
 	// This allows the handler to respond with an acknowledgment immediately
@@ -77,7 +114,7 @@ func main() {
 	)
 
 	webhookHandler := githubapp.NewEventDispatcher(
-		[]githubapp.EventHandler{prCommentHandler, mergeGroupHandler, workflowRunHandler, pullRequestHandler},
+		[]githubapp.EventHandler{prCommentHandler, mergeGroupHandler, workflowRunHandler, pullRequestHandler, prReviewHandler, prReviewCommentHandler},
 		serverConfig.Github.App.WebhookSecret,
 		githubapp.WithScheduler(asyncScheduler),
 	)
@@ -93,6 +130,12 @@ func main() {
 		}
 	})
 
+	// expose the flake rates of workflows and jobs to authenticated clients, e.g.
+	// /flakes?repository=owner/repo&period=7d
+	if serverConfig.Flakes.APIToken != "" {
+		http.Handle(DefaultFlakesRoute, flakeStore.Handler(serverConfig.Flakes.APIToken))
+	}
+
 	// add a default route
 	http.HandleFunc(DefaultRoute, func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -109,3 +152,16 @@ func main() {
 		panic(err)
 	}
 }
+
+// appBotLogin returns the login of the bot user of the GitHub App, which authors the comments of Ariane
+func appBotLogin(cc githubapp.ClientCreator) (string, error) {
+	client, err := cc.NewAppClient()
+	if err != nil {
+		return "", fmt.Errorf("failed creating app client: %w", err)
+	}
+	app, _, err := client.Apps.Get(context.Background(), "")
+	if err != nil {
+		return "", fmt.Errorf("failed retrieving app: %w", err)
+	}
+	return app.GetSlug() + "[bot]", nil
+}